@@ -9,6 +9,7 @@ import (
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -69,19 +70,61 @@ func InitDB(config Config) error {
 
 // AutoMigrate runs database migrations
 func AutoMigrate() error {
+	// Replace plaintext API keys before the new columns get their constraints
+	if err := hashAPIKeys(); err != nil {
+		return fmt.Errorf("failed to hash API keys: %w", err)
+	}
+
+	// Keys and sessions created before scopes existed keep full access
+	if err := addScopes(); err != nil {
+		return fmt.Errorf("failed to add scopes: %w", err)
+	}
+
+	// Clients registered before email verification existed keep working
+	verifyExisting := DB.Migrator().HasTable("clients") && !DB.Migrator().HasColumn("clients", "email_verified_at")
+
+	// Logs recorded before normalization existed need a route template, once
+	templateExisting := DB.Migrator().HasTable("api_logs") && !DB.Migrator().HasColumn("api_logs", "endpoint_template")
+
 	err := DB.AutoMigrate(
+		&model.Plan{},
 		&model.Client{},
 		&model.APILog{},
+		&model.RouteTemplate{},
+		&model.LatencyRollup{},
+		&model.QuotaPeriod{},
+		&model.LimitBoost{},
+		&model.AuditLog{},
+		&model.RefreshToken{},
+		&model.APIKey{},
+		&model.EmailVerification{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
+	if verifyExisting {
+		if err := DB.Exec(`UPDATE clients SET email_verified_at = created_at WHERE email_verified_at IS NULL`).Error; err != nil {
+			return fmt.Errorf("failed to mark existing clients as verified: %w", err)
+		}
+		log.Println("Marked existing clients as verified")
+	}
+
+	// Move the single key of each client into api_keys
+	if err := moveAPIKeys(); err != nil {
+		return fmt.Errorf("failed to move API keys: %w", err)
+	}
+
 	// Create indexes for better query performance
 	if err := createIndexes(); err != nil {
 		return fmt.Errorf("failed to create indexes: %w", err)
 	}
 
+	// Fill columns added to existing tables
+	if err := backfillColumns(templateExisting); err != nil {
+		return fmt.Errorf("failed to backfill columns: %w", err)
+	}
+
 	log.Println("Database migrations completed successfully")
 	return nil
 }
@@ -112,6 +155,190 @@ func createIndexes() error {
 		return err
 	}
 
+	// Index for route template analytics
+	if err := DB.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_api_logs_client_template_timestamp 
+		ON api_logs(client_id, endpoint_template, timestamp DESC)
+	`).Error; err != nil {
+		return err
+	}
+
+	// Partial index for error rate analytics
+	if err := DB.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_api_logs_errors 
+		ON api_logs(client_id, timestamp DESC) WHERE status_code >= 400
+	`).Error; err != nil {
+		return err
+	}
+
+	// Index for latency percentile windows across all clients
+	if err := DB.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_latency_rollups_bucket_start 
+		ON latency_rollups(bucket_start DESC)
+	`).Error; err != nil {
+		return err
+	}
+
+	// Unique event IDs per client (idempotency fallback when Redis is unavailable)
+	if err := DB.Exec(`
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_api_logs_client_event 
+		ON api_logs(client_id, event_id) WHERE event_id IS NOT NULL
+	`).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// backfillColumns fills columns that were added after rows already existed.
+// The route templates of api_logs are only derived when templates is set,
+// that is when the migration just added the endpoint_template column.
+func backfillColumns(templates bool) error {
+	if !templates {
+		return nil
+	}
+
+	// Derive route templates for logs recorded before normalization existed,
+	// using the same automatic UUID/numeric detection as utils.NormalizeEndpoint
+	if err := DB.Exec(`
+		UPDATE api_logs
+		SET endpoint_template = regexp_replace(
+			regexp_replace(
+				split_part(split_part(endpoint, '?', 1), '#', 1),
+				'/[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}(?=/|$)', '/:uuid', 'g'),
+			'/[0-9]+(?=/|$)', '/:id', 'g')
+		WHERE endpoint_template = ''
+	`).Error; err != nil {
+		return err
+	}
+
+	log.Println("Derived route templates of existing logs")
+	return nil
+}
+
+// hashAPIKeys converts clients created while API keys were stored in plaintext:
+// the key is replaced by its SHA-256 hash and its public prefix (the first 8
+// characters, see utils.APIKeyPrefixLength), and the copies in api_logs are
+// dropped. It does nothing once the plaintext columns are gone.
+func hashAPIKeys() error {
+	migrator := DB.Migrator()
+
+	if migrator.HasTable("clients") && migrator.HasColumn("clients", "api_key") {
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			for _, stmt := range []string{
+				`ALTER TABLE clients
+					ADD COLUMN IF NOT EXISTS api_key_prefix varchar(16),
+					ADD COLUMN IF NOT EXISTS api_key_hash varchar(64)`,
+				`UPDATE clients
+					SET api_key_prefix = left(api_key, 8),
+						api_key_hash = encode(sha256(convert_to(api_key, 'UTF8')), 'hex')`,
+				`ALTER TABLE clients DROP COLUMN api_key`,
+			} {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		log.Println("Replaced plaintext API keys with hashes")
+	}
+
+	if migrator.HasTable("api_logs") && migrator.HasColumn("api_logs", "api_key") {
+		if err := DB.Exec(`ALTER TABLE api_logs DROP COLUMN api_key`).Error; err != nil {
+			return err
+		}
+		log.Println("Removed API keys from api_logs")
+	}
+
+	return nil
+}
+
+// addScopes adds the scopes column to api_keys and refresh_tokens that were
+// created before scopes existed. The rows already there get every scope, but
+// the column has no default, so new rows always name their scopes.
+func addScopes() error {
+	allScopes := model.JoinScopes(model.AllScopes)
+
+	for _, table := range []string{"api_keys", "refresh_tokens"} {
+		if !DB.Migrator().HasTable(table) || DB.Migrator().HasColumn(table, "scopes") {
+			continue
+		}
+
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			for _, stmt := range []string{
+				`ALTER TABLE ` + table + ` ADD COLUMN scopes varchar(255) NOT NULL DEFAULT '` + allScopes + `'`,
+				`ALTER TABLE ` + table + ` ALTER COLUMN scopes DROP DEFAULT`,
+			} {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("Granted all scopes to existing %s", table)
+	}
+
+	return nil
+}
+
+// moveAPIKeys copies the key hash kept on each client before clients could
+// have several keys into api_keys, labelled "default" and with all scopes,
+// and drops the old columns. The key takes the client's ID, so copying twice
+// is harmless.
+func moveAPIKeys() error {
+	if !DB.Migrator().HasColumn("clients", "api_key_hash") {
+		return nil
+	}
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			INSERT INTO api_keys (id, client_id, label, prefix, hash, scopes, created_at)
+			SELECT id, id, 'default', api_key_prefix, api_key_hash, ?, created_at
+			FROM clients
+			WHERE api_key_hash IS NOT NULL
+			ON CONFLICT DO NOTHING
+		`, model.JoinScopes(model.AllScopes)).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(`ALTER TABLE clients DROP COLUMN api_key_prefix, DROP COLUMN api_key_hash`).Error; err != nil {
+			return err
+		}
+
+		log.Println("Moved client API keys to api_keys")
+		return nil
+	})
+}
+
+// SeedPlans creates the built-in plans if they do not exist yet and assigns
+// the free plan to clients without one. The free plan only has the hourly
+// limit of defaultHourlyLimit and no quota, so existing clients moved onto it
+// keep their RATE_LIMIT_PER_HOUR and gain no caps they did not have before.
+func SeedPlans(defaultHourlyLimit int) error {
+	plans := []model.Plan{
+		{Name: model.PlanFree, HourlyLimit: defaultHourlyLimit, QuotaMode: model.QuotaSoft},
+		{Name: model.PlanPro, HourlyLimit: 10 * defaultHourlyLimit, DailyLimit: 200 * defaultHourlyLimit, MonthlyQuota: 3000 * defaultHourlyLimit, QuotaMode: model.QuotaSoft},
+		{Name: model.PlanEnterprise, HourlyLimit: 100 * defaultHourlyLimit, DailyLimit: 2000 * defaultHourlyLimit, QuotaMode: model.QuotaSoft},
+	}
+
+	if err := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&plans).Error; err != nil {
+		return fmt.Errorf("failed to seed plans: %w", err)
+	}
+
+	if err := DB.Exec(`
+		UPDATE clients
+		SET plan_id = (SELECT id FROM plans WHERE name = ?)
+		WHERE plan_id IS NULL
+	`, model.PlanFree).Error; err != nil {
+		return fmt.Errorf("failed to assign default plan: %w", err)
+	}
+
 	return nil
 }
 
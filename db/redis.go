@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -13,6 +15,23 @@ import (
 // RedisClient is the global Redis client instance
 var RedisClient *redis.Client
 
+const (
+	// redisProbeInterval is how often the health of Redis is checked
+	redisProbeInterval = time.Second
+	// redisProbeTimeout bounds a single health check
+	redisProbeTimeout = 500 * time.Millisecond
+)
+
+var (
+	// redisHealthy is the health of Redis as last seen by the prober
+	redisHealthy atomic.Bool
+	// stopRedisProbe stops the prober started by InitRedis
+	stopRedisProbe context.CancelFunc
+
+	recoveryMu    sync.Mutex
+	recoveryHooks []func()
+)
+
 // RedisConfig holds Redis configuration
 type RedisConfig struct {
 	Host     string
@@ -38,7 +57,16 @@ func InitRedis(config RedisConfig) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := RedisClient.Ping(ctx).Err(); err != nil {
+	err := RedisClient.Ping(ctx).Err()
+	redisHealthy.Store(err == nil)
+
+	// Keep checking in the background, so Redis can recover later and
+	// requests never wait for a ping
+	probeCtx, stop := context.WithCancel(context.Background())
+	stopRedisProbe = stop
+	go probeRedis(probeCtx, RedisClient)
+
+	if err != nil {
 		return fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
@@ -46,6 +74,52 @@ func InitRedis(config RedisConfig) error {
 	return nil
 }
 
+// probeRedis pings Redis every redisProbeInterval and records whether it
+// answered, until ctx is cancelled
+func probeRedis(ctx context.Context, client *redis.Client) {
+	ticker := time.NewTicker(redisProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, redisProbeTimeout)
+		err := client.Ping(pingCtx).Err()
+		cancel()
+
+		healthy := err == nil
+		if redisHealthy.Swap(healthy) != healthy {
+			if healthy {
+				log.Println("Redis is available again")
+				runRecoveryHooks()
+			} else {
+				log.Printf("Redis became unavailable: %v", err)
+			}
+		}
+	}
+}
+
+// OnRedisRecovered registers fn to be called whenever the prober sees Redis
+// become available again. Each call runs in its own goroutine.
+func OnRedisRecovered(fn func()) {
+	recoveryMu.Lock()
+	defer recoveryMu.Unlock()
+	recoveryHooks = append(recoveryHooks, fn)
+}
+
+// runRecoveryHooks starts the functions registered with OnRedisRecovered
+func runRecoveryHooks() {
+	recoveryMu.Lock()
+	defer recoveryMu.Unlock()
+	for _, fn := range recoveryHooks {
+		go fn()
+	}
+}
+
 // GetRedisConfig loads Redis configuration from environment variables
 func GetRedisConfig() RedisConfig {
 	return RedisConfig{
@@ -125,6 +199,39 @@ func IncrementCounter(ctx context.Context, key string) (int64, error) {
 	return RedisClient.Incr(ctx, key).Result()
 }
 
+// IncrementCounterWithTTL increments a counter in Redis and (re)sets its expiry,
+// so the counter disappears once it has not been incremented for ttl
+func IncrementCounterWithTTL(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	if RedisClient == nil {
+		return 0, fmt.Errorf("Redis client not initialized")
+	}
+
+	var incr *redis.IntCmd
+	_, err := RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return incr.Val(), nil
+}
+
+// GetTTL gets the remaining time to live of a key (0 when it does not exist or never expires)
+func GetTTL(ctx context.Context, key string) (time.Duration, error) {
+	if RedisClient == nil {
+		return 0, fmt.Errorf("Redis client not initialized")
+	}
+
+	ttl, err := RedisClient.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	return max(ttl, 0), nil
+}
+
 // GetCounter gets the current value of a counter
 func GetCounter(ctx context.Context, key string) (int64, error) {
 	if RedisClient == nil {
@@ -166,13 +273,16 @@ func CloseRedis() error {
 	if RedisClient == nil {
 		return nil
 	}
+	if stopRedisProbe != nil {
+		stopRedisProbe()
+	}
+	redisHealthy.Store(false)
 	return RedisClient.Close()
 }
 
-// IsRedisAvailable checks if Redis is available
+// IsRedisAvailable reports whether Redis answered its latest health check.
+// The state is kept up to date by a background prober, so callers never wait
+// for Redis while it is down.
 func IsRedisAvailable(ctx context.Context) bool {
-	if RedisClient == nil {
-		return false
-	}
-	return RedisClient.Ping(ctx).Err() == nil
+	return RedisClient != nil && redisHealthy.Load()
 }
@@ -0,0 +1,631 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"nexmedis-golang/model"
+	"nexmedis-golang/store"
+	"nexmedis-golang/utils"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// maxBoostDuration is the longest a temporary boost may last
+const maxBoostDuration = 90 * 24 * time.Hour
+
+// AdminHandler handles administrative requests
+type AdminHandler struct {
+	clientStore  *store.ClientStore
+	planStore    *store.PlanStore
+	quotaStore   *store.QuotaStore
+	boostStore   *store.LimitBoostStore
+	auditStore   *store.AuditStore
+	refreshStore *store.RefreshTokenStore
+	rateLimiter  *utils.RateLimiter
+}
+
+// NewAdminHandler creates a new AdminHandler
+func NewAdminHandler(clientStore *store.ClientStore, planStore *store.PlanStore, quotaStore *store.QuotaStore, boostStore *store.LimitBoostStore, auditStore *store.AuditStore, refreshStore *store.RefreshTokenStore, rateLimiter *utils.RateLimiter) *AdminHandler {
+	return &AdminHandler{
+		clientStore:  clientStore,
+		planStore:    planStore,
+		quotaStore:   quotaStore,
+		boostStore:   boostStore,
+		auditStore:   auditStore,
+		refreshStore: refreshStore,
+		rateLimiter:  rateLimiter,
+	}
+}
+
+// ListPlans returns all rate limit plans
+//
+//	@Summary		List plans
+//	@Description	List the plans with their hourly, daily and monthly rate limits and their monthly quota (0 means unlimited)
+//	@Tags			Admin
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Security		AdminToken
+//	@Success		200	{object}	object{success=bool,message=string,data=[]model.Plan}	"Plans retrieved successfully"
+//	@Failure		401	{object}	object{success=bool,message=string,error=string}	"Unauthorized - admin access token or admin token required"
+//	@Failure		403	{object}	object{success=bool,message=string,error=string}	"Forbidden - the client is not an admin"
+//	@Failure		500	{object}	object{success=bool,message=string,error=string}	"Failed to list plans"
+//	@Router			/api/admin/plans [get]
+func (h *AdminHandler) ListPlans(c echo.Context) error {
+	plans, err := h.planStore.List()
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to list plans", err.Error())
+	}
+
+	return utils.OKResponse(c, "Plans retrieved successfully", plans)
+}
+
+// GetClientLimits returns the plan, overrides and effective limits of a client
+//
+//	@Summary		Get client limits
+//	@Description	Show the plan, per-client overrides and effective rate limits of a client
+//	@Tags			Admin
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Security		AdminToken
+//	@Param			client_id	path		string	true	"Client ID"
+//	@Success		200			{object}	object{success=bool,message=string,data=model.ClientLimits}	"Client limits retrieved successfully"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - admin access token or admin token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Forbidden - the client is not an admin"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
+//	@Router			/api/admin/clients/{client_id}/limits [get]
+func (h *AdminHandler) GetClientLimits(c echo.Context) error {
+	client, err := h.clientStore.FindByClientIDWithPlan(c.Param("client_id"))
+	if err != nil {
+		return utils.NotFoundResponse(c, "Client not found")
+	}
+
+	return utils.OKResponse(c, "Client limits retrieved successfully", h.clientLimits(client))
+}
+
+// AssignPlan assigns a plan to a client
+//
+//	@Summary		Assign plan
+//	@Description	Move a client to another plan. Per-client overrides stay in place.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Security		AdminToken
+//	@Param			client_id	path		string					true	"Client ID"
+//	@Param			request		body		model.AssignPlanRequest	true	"Plan to assign"
+//	@Success		200			{object}	object{success=bool,message=string,data=model.ClientLimits}	"Plan assigned successfully"
+//	@Failure		400			{object}	object{success=bool,message=string,error=string}	"Invalid request body or unknown plan"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - admin access token or admin token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Forbidden - the client is not an admin"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
+//	@Failure		500			{object}	object{success=bool,message=string,error=string}	"Failed to assign plan"
+//	@Router			/api/admin/clients/{client_id}/plan [put]
+func (h *AdminHandler) AssignPlan(c echo.Context) error {
+	var req model.AssignPlanRequest
+	if err := c.Bind(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body")
+	}
+
+	if err := utils.ValidateRequired(req.Plan, "plan"); err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+
+	client, err := h.clientStore.FindByClientIDWithPlan(c.Param("client_id"))
+	if err != nil {
+		return utils.NotFoundResponse(c, "Client not found")
+	}
+
+	plan, err := h.planStore.FindByName(req.Plan)
+	if err != nil {
+		if errors.Is(err, store.ErrPlanNotFound) {
+			return utils.BadRequestResponse(c, "Unknown plan")
+		}
+		return utils.InternalServerErrorResponse(c, "Failed to find plan", err.Error())
+	}
+
+	if err := h.clientStore.AssignPlan(client.ID, plan.ID); err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to assign plan", err.Error())
+	}
+
+	previous := ""
+	if client.Plan != nil {
+		previous = client.Plan.Name
+	}
+	h.audit(c, model.AuditPlanAssign, client.ID, map[string]interface{}{"from": previous, "to": plan.Name})
+
+	client.PlanID = &plan.ID
+	client.Plan = plan
+	_ = h.rateLimiter.InvalidateLimits(c.Request().Context(), client.ID)
+	_ = h.quotaStore.InvalidateTerms(c.Request().Context(), client.ID)
+
+	return utils.OKResponse(c, "Plan assigned successfully", h.clientLimits(client))
+}
+
+// SetClientOverrides sets the per-client limit overrides of a client
+//
+//	@Summary		Set client limit overrides
+//	@Description	Replace the per-client limits that take precedence over the plan. A null or missing limit falls back to the plan, and 0 means unlimited.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Security		AdminToken
+//	@Param			client_id	path		string					true	"Client ID"
+//	@Param			request		body		model.LimitOverrides	true	"Limit overrides"
+//	@Success		200			{object}	object{success=bool,message=string,data=model.ClientLimits}	"Overrides updated successfully"
+//	@Failure		400			{object}	object{success=bool,message=string,error=string}	"Invalid request body"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - admin access token or admin token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Forbidden - the client is not an admin"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
+//	@Failure		500			{object}	object{success=bool,message=string,error=string}	"Failed to update overrides"
+//	@Router			/api/admin/clients/{client_id}/limits [put]
+func (h *AdminHandler) SetClientOverrides(c echo.Context) error {
+	var req model.LimitOverrides
+	if err := c.Bind(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body")
+	}
+
+	for _, limit := range []*int{req.Hourly, req.Daily, req.Monthly} {
+		if limit != nil && *limit < 0 {
+			return utils.BadRequestResponse(c, "limits must not be negative")
+		}
+	}
+
+	client, err := h.clientStore.FindByClientIDWithPlan(c.Param("client_id"))
+	if err != nil {
+		return utils.NotFoundResponse(c, "Client not found")
+	}
+
+	if err := h.clientStore.SetLimitOverrides(client.ID, req); err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to update overrides", err.Error())
+	}
+	h.audit(c, model.AuditLimitsOverride, client.ID, map[string]interface{}{"from": client.Overrides(), "to": req})
+
+	client.HourlyLimitOverride = req.Hourly
+	client.DailyLimitOverride = req.Daily
+	client.MonthlyLimitOverride = req.Monthly
+	_ = h.rateLimiter.InvalidateLimits(c.Request().Context(), client.ID)
+
+	return utils.OKResponse(c, "Overrides updated successfully", h.clientLimits(client))
+}
+
+// SetBillingAnchor moves the billing cycle of a client
+//
+//	@Summary		Set billing anchor
+//	@Description	Anchor a client's monthly billing periods to a date. Periods start on the anchor's day of the month (the last day in shorter months) at its time of day, in UTC. Quota consumption restarts in the new period that contains the current time.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Security		AdminToken
+//	@Param			client_id	path		string						true	"Client ID"
+//	@Param			request		body		model.BillingAnchorRequest	true	"Billing anchor"
+//	@Success		200			{object}	object{success=bool,message=string,data=model.QuotaUsage}	"Billing anchor updated successfully"
+//	@Failure		400			{object}	object{success=bool,message=string,error=string}	"Invalid request body"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - admin access token or admin token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Forbidden - the client is not an admin"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
+//	@Failure		500			{object}	object{success=bool,message=string,error=string}	"Failed to update billing anchor"
+//	@Router			/api/admin/clients/{client_id}/billing-anchor [put]
+func (h *AdminHandler) SetBillingAnchor(c echo.Context) error {
+	var req model.BillingAnchorRequest
+	if err := c.Bind(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body")
+	}
+
+	if req.BillingAnchor.IsZero() {
+		return utils.BadRequestResponse(c, "billing_anchor is required")
+	}
+
+	client, err := h.clientStore.FindByClientID(c.Param("client_id"))
+	if err != nil {
+		return utils.NotFoundResponse(c, "Client not found")
+	}
+
+	if err := h.clientStore.SetBillingAnchor(client.ID, req.BillingAnchor.UTC()); err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to update billing anchor", err.Error())
+	}
+	h.audit(c, model.AuditBillingAnchorSet, client.ID, map[string]interface{}{"from": client.BillingCycleAnchor(), "to": req.BillingAnchor.UTC()})
+	_ = h.quotaStore.InvalidateTerms(c.Request().Context(), client.ID)
+
+	period, err := h.quotaStore.Current(client.ID, time.Now().UTC())
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to get quota", err.Error())
+	}
+
+	return utils.OKResponse(c, "Billing anchor updated successfully", period.ToUsage())
+}
+
+// GetRateLimitState returns the current rate limit counters of a client
+//
+//	@Summary		Get client rate limit counters
+//	@Description	Show the current state of every rate limit window and rule of a client, together with its monthly quota consumption and active boosts. Nothing is charged. Rules scoped to an endpoint or source IP are included when ip and endpoint are given.
+//	@Tags			Admin
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Security		AdminToken
+//	@Param			client_id	path		string	true	"Client ID"
+//	@Param			ip			query		string	false	"Source IP, to include per-IP rules"
+//	@Param			endpoint	query		string	false	"Endpoint, to include per-endpoint rules"
+//	@Success		200			{object}	object{success=bool,message=string,data=model.ClientRateLimitState}	"Rate limit state retrieved successfully"
+//	@Failure		400			{object}	object{success=bool,message=string,error=string}	"Invalid query parameters"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - admin access token or admin token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Forbidden - the client is not an admin"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
+//	@Failure		503			{object}	object{success=bool,message=string,error=string}	"Rate limit counters are unavailable"
+//	@Router			/api/admin/clients/{client_id}/rate-limits [get]
+func (h *AdminHandler) GetRateLimitState(c echo.Context) error {
+	hit := utils.RateLimitHit{IP: c.QueryParam("ip"), Endpoint: c.QueryParam("endpoint")}
+	if hit.IP != "" {
+		if err := utils.ValidateIP(hit.IP); err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+	}
+	if hit.Endpoint != "" {
+		if err := utils.ValidateEndpoint(hit.Endpoint); err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+	}
+
+	client, err := h.clientStore.FindByClientIDWithPlan(c.Param("client_id"))
+	if err != nil {
+		return utils.NotFoundResponse(c, "Client not found")
+	}
+
+	return h.rateLimitStateResponse(c, client, hit, "Rate limit state retrieved successfully")
+}
+
+// ResetRateLimits resets the rate limit counters of a client
+//
+//	@Summary		Reset client rate limit counters
+//	@Description	Clear every rate limit counter of a client, including per-endpoint and per-IP rules, so the client starts from full limits. The monthly quota is not affected.
+//	@Tags			Admin
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Security		AdminToken
+//	@Param			client_id	path		string	true	"Client ID"
+//	@Success		200			{object}	object{success=bool,message=string,data=model.ClientRateLimitState}	"Rate limits reset successfully"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - admin access token or admin token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Forbidden - the client is not an admin"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
+//	@Failure		503			{object}	object{success=bool,message=string,error=string}	"Rate limit counters are unavailable"
+//	@Router			/api/admin/clients/{client_id}/rate-limits/reset [post]
+func (h *AdminHandler) ResetRateLimits(c echo.Context) error {
+	client, err := h.clientStore.FindByClientIDWithPlan(c.Param("client_id"))
+	if err != nil {
+		return utils.NotFoundResponse(c, "Client not found")
+	}
+
+	if err := h.rateLimiter.ResetLimit(c.Request().Context(), client.ID); err != nil {
+		return utils.ServiceUnavailableResponse(c, "Failed to reset rate limits: "+err.Error())
+	}
+	h.audit(c, model.AuditRateLimitsReset, client.ID, map[string]interface{}{})
+
+	return h.rateLimitStateResponse(c, client, utils.RateLimitHit{}, "Rate limits reset successfully")
+}
+
+// RevokeTokens revokes every token issued to a client
+//
+//	@Summary		Revoke client tokens
+//	@Description	Revoke every access and refresh token issued to a client so far, for example after its API key was compromised. Tokens issued afterwards are not affected.
+//	@Tags			Admin
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Security		AdminToken
+//	@Param			client_id	path		string	true	"Client ID"
+//	@Success		200			{object}	object{success=bool,message=string}	"Tokens revoked successfully"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - admin access token or admin token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Forbidden - the client is not an admin"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
+//	@Failure		500			{object}	object{success=bool,message=string,error=string}	"Failed to revoke tokens"
+//	@Failure		503			{object}	object{success=bool,message=string,error=string}	"Token denylist unavailable"
+//	@Router			/api/admin/clients/{client_id}/tokens/revoke [post]
+func (h *AdminHandler) RevokeTokens(c echo.Context) error {
+	client, err := h.clientStore.FindByClientID(c.Param("client_id"))
+	if err != nil {
+		return utils.NotFoundResponse(c, "Client not found")
+	}
+
+	if err := revokeClientSessions(c.Request().Context(), h.refreshStore, client.ID); err != nil {
+		return revokeFailedResponse(c, err)
+	}
+	h.audit(c, model.AuditTokensRevoke, client.ID, map[string]interface{}{})
+
+	return utils.OKResponse(c, "Tokens revoked successfully", nil)
+}
+
+// SetRole changes the role of a client
+//
+//	@Summary		Set client role
+//	@Description	Change the role of a client: admin (global analytics and lookups of any client), client (records hits and reads its own usage) or analyst (reads its own usage only). The client's access tokens are revoked so the new role applies at the next token refresh.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Security		AdminToken
+//	@Param			client_id	path		string					true	"Client ID"
+//	@Param			request		body		model.SetRoleRequest	true	"Role to assign"
+//	@Success		200			{object}	object{success=bool,message=string,data=model.ClientResponse}	"Role updated successfully"
+//	@Failure		400			{object}	object{success=bool,message=string,error=string}	"Invalid request body"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - admin access token or admin token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Forbidden - the client is not an admin"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
+//	@Failure		500			{object}	object{success=bool,message=string,error=string}	"Failed to update role"
+//	@Failure		503			{object}	object{success=bool,message=string,error=string}	"Token denylist unavailable"
+//	@Router			/api/admin/clients/{client_id}/role [put]
+func (h *AdminHandler) SetRole(c echo.Context) error {
+	var req model.SetRoleRequest
+	if err := c.Bind(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body")
+	}
+
+	role, err := model.ParseRole(req.Role)
+	if err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+
+	client, err := h.clientStore.FindByClientID(c.Param("client_id"))
+	if err != nil {
+		return utils.NotFoundResponse(c, "Client not found")
+	}
+
+	if err := h.clientStore.SetRole(client.ID, role); err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to update role", err.Error())
+	}
+	h.audit(c, model.AuditRoleSet, client.ID, map[string]interface{}{"from": client.Role, "to": role})
+
+	// Access tokens carry the role, so end them; refresh tokens stay valid
+	// and pick up the new role when they are next exchanged
+	if err := utils.RevokeClientTokens(c.Request().Context(), client.ID); err != nil {
+		return revokeFailedResponse(c, err)
+	}
+
+	client.Role = role
+	return utils.OKResponse(c, "Role updated successfully", client.ToResponse(false))
+}
+
+// GrantBoost grants a client a temporary limit and quota boost
+//
+//	@Summary		Grant temporary boost
+//	@Description	Add extra requests to a client's hourly, daily and monthly limits and to its monthly quota until the boost expires. Unlimited limits stay unlimited. Boosts stack and expire automatically.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Security		AdminToken
+//	@Param			client_id	path		string					true	"Client ID"
+//	@Param			request		body		model.GrantBoostRequest	true	"Boost to grant"
+//	@Success		201			{object}	object{success=bool,message=string,data=model.LimitBoost}	"Boost granted successfully"
+//	@Failure		400			{object}	object{success=bool,message=string,error=string}	"Invalid request body"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - admin access token or admin token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Forbidden - the client is not an admin"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
+//	@Failure		500			{object}	object{success=bool,message=string,error=string}	"Failed to grant boost"
+//	@Router			/api/admin/clients/{client_id}/boosts [post]
+func (h *AdminHandler) GrantBoost(c echo.Context) error {
+	var req model.GrantBoostRequest
+	if err := c.Bind(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body")
+	}
+
+	if req.Hourly < 0 || req.Daily < 0 || req.Monthly < 0 || req.Quota < 0 {
+		return utils.BadRequestResponse(c, "boosts must not be negative")
+	}
+	if req.Hourly == 0 && req.Daily == 0 && req.Monthly == 0 && req.Quota == 0 {
+		return utils.BadRequestResponse(c, "boost must raise at least one limit or the quota")
+	}
+
+	if err := utils.ValidateRequired(req.Duration, "duration"); err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+	duration, err := utils.ParseWindow(req.Duration, 0, maxBoostDuration)
+	if err != nil {
+		return utils.BadRequestResponse(c, "duration: "+err.Error())
+	}
+
+	client, err := h.clientStore.FindByClientID(c.Param("client_id"))
+	if err != nil {
+		return utils.NotFoundResponse(c, "Client not found")
+	}
+
+	boost := &model.LimitBoost{
+		ClientID:  client.ID,
+		Hourly:    req.Hourly,
+		Daily:     req.Daily,
+		Monthly:   req.Monthly,
+		Quota:     req.Quota,
+		Reason:    utils.TruncateString(utils.SanitizeString(req.Reason), 255),
+		ExpiresAt: time.Now().UTC().Add(duration),
+	}
+	if err := h.boostStore.Create(boost); err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to grant boost", err.Error())
+	}
+	h.audit(c, model.AuditBoostGrant, client.ID, boost)
+
+	_ = h.rateLimiter.InvalidateLimits(c.Request().Context(), client.ID)
+	_ = h.quotaStore.InvalidateTerms(c.Request().Context(), client.ID)
+
+	return utils.CreatedResponse(c, "Boost granted successfully", boost)
+}
+
+// ListBoosts returns the active boosts of a client
+//
+//	@Summary		List active boosts
+//	@Description	List the boosts of a client that have not expired yet, soonest expiry first
+//	@Tags			Admin
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Security		AdminToken
+//	@Param			client_id	path		string	true	"Client ID"
+//	@Success		200			{object}	object{success=bool,message=string,data=[]model.LimitBoost}	"Boosts retrieved successfully"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - admin access token or admin token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Forbidden - the client is not an admin"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
+//	@Failure		500			{object}	object{success=bool,message=string,error=string}	"Failed to list boosts"
+//	@Router			/api/admin/clients/{client_id}/boosts [get]
+func (h *AdminHandler) ListBoosts(c echo.Context) error {
+	client, err := h.clientStore.FindByClientID(c.Param("client_id"))
+	if err != nil {
+		return utils.NotFoundResponse(c, "Client not found")
+	}
+
+	boosts, err := h.boostStore.ListActive(client.ID)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to list boosts", err.Error())
+	}
+
+	return utils.OKResponse(c, "Boosts retrieved successfully", boosts)
+}
+
+// RevokeBoost ends an active boost of a client early
+//
+//	@Summary		Revoke boost
+//	@Description	End an active boost of a client right away
+//	@Tags			Admin
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Security		AdminToken
+//	@Param			client_id	path		string	true	"Client ID"
+//	@Param			boost_id	path		string	true	"Boost ID"
+//	@Success		200			{object}	object{success=bool,message=string,data=model.LimitBoost}	"Boost revoked successfully"
+//	@Failure		400			{object}	object{success=bool,message=string,error=string}	"Invalid boost ID"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - admin access token or admin token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Forbidden - the client is not an admin"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client or active boost not found"
+//	@Failure		500			{object}	object{success=bool,message=string,error=string}	"Failed to revoke boost"
+//	@Router			/api/admin/clients/{client_id}/boosts/{boost_id} [delete]
+func (h *AdminHandler) RevokeBoost(c echo.Context) error {
+	boostID, err := uuid.Parse(c.Param("boost_id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "Invalid boost ID")
+	}
+
+	client, err := h.clientStore.FindByClientID(c.Param("client_id"))
+	if err != nil {
+		return utils.NotFoundResponse(c, "Client not found")
+	}
+
+	boost, err := h.boostStore.Revoke(client.ID, boostID)
+	if err != nil {
+		if errors.Is(err, store.ErrBoostNotFound) {
+			return utils.NotFoundResponse(c, "Active boost not found")
+		}
+		return utils.InternalServerErrorResponse(c, "Failed to revoke boost", err.Error())
+	}
+	h.audit(c, model.AuditBoostRevoke, client.ID, map[string]interface{}{"boost_id": boost.ID})
+
+	_ = h.rateLimiter.InvalidateLimits(c.Request().Context(), client.ID)
+	_ = h.quotaStore.InvalidateTerms(c.Request().Context(), client.ID)
+
+	return utils.OKResponse(c, "Boost revoked successfully", boost)
+}
+
+// ListAuditLogs returns the admin audit trail
+//
+//	@Summary		List audit logs
+//	@Description	List the actions taken through the admin API, newest first. The actor is the admin who authenticated the request: "client:" and the client UUID for an admin access token, or the name of a bootstrap admin token.
+//	@Tags			Admin
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Security		AdminToken
+//	@Param			client_id	query		string	false	"Only include actions on this client"
+//	@Param			limit		query		int		false	"Number of entries (1-500, default 100)"
+//	@Success		200			{object}	object{success=bool,message=string,data=[]model.AuditLog}	"Audit logs retrieved successfully"
+//	@Failure		400			{object}	object{success=bool,message=string,error=string}	"Invalid query parameters"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - admin access token or admin token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Forbidden - the client is not an admin"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
+//	@Failure		500			{object}	object{success=bool,message=string,error=string}	"Failed to list audit logs"
+//	@Router			/api/admin/audit-logs [get]
+func (h *AdminHandler) ListAuditLogs(c echo.Context) error {
+	limit := 100
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			return utils.BadRequestResponse(c, "limit must be a number between 1 and 500")
+		}
+		limit = parsed
+	}
+
+	var clientID *uuid.UUID
+	if clientIDStr := c.QueryParam("client_id"); clientIDStr != "" {
+		client, err := h.clientStore.FindByClientID(clientIDStr)
+		if err != nil {
+			return utils.NotFoundResponse(c, "Client not found")
+		}
+		clientID = &client.ID
+	}
+
+	entries, err := h.auditStore.List(clientID, limit)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to list audit logs", err.Error())
+	}
+
+	return utils.OKResponse(c, "Audit logs retrieved successfully", entries)
+}
+
+// rateLimitStateResponse answers with the counters, quota and boosts of a client
+func (h *AdminHandler) rateLimitStateResponse(c echo.Context, client *model.Client, hit utils.RateLimitHit, message string) error {
+	ctx := c.Request().Context()
+
+	results, err := h.rateLimiter.Inspect(ctx, client.ID, hit)
+	if err != nil {
+		return utils.ServiceUnavailableResponse(c, fmt.Sprintf("Failed to read rate limit counters: %v", err))
+	}
+
+	period, err := h.quotaStore.Current(client.ID, time.Now().UTC())
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to get quota", err.Error())
+	}
+
+	now := time.Now().UTC()
+	state := model.ClientRateLimitState{
+		ClientLimits: h.clientLimits(client),
+		Counters:     make([]model.RateLimitCounter, len(results)),
+		Quota:        period.ToUsage(),
+		Boosts:       client.Boosts,
+	}
+	for i, r := range results {
+		state.Counters[i] = model.RateLimitCounter{
+			Name:          r.Policy,
+			Limit:         r.Limit,
+			WindowSeconds: int(r.Window / time.Second),
+			Remaining:     r.Remaining,
+			ResetAt:       now.Add(r.Reset),
+		}
+	}
+	if state.Boosts == nil {
+		state.Boosts = []model.LimitBoost{}
+	}
+
+	return utils.OKResponse(c, message, state)
+}
+
+// audit records an admin action in the audit trail under the admin that
+// AdminMiddleware authenticated. The action already took effect, so a failure
+// to record it is logged rather than returned.
+func (h *AdminHandler) audit(c echo.Context, action string, clientID uuid.UUID, details interface{}) {
+	actor, _ := c.Get("admin_actor").(string)
+	actor = utils.TruncateString(actor, 255)
+
+	if err := h.auditStore.Record(actor, c.RealIP(), action, &clientID, details); err != nil {
+		log.Printf("Failed to record audit log: %v", err)
+	}
+}
+
+// clientLimits describes the limits of a client
+func (h *AdminHandler) clientLimits(client *model.Client) model.ClientLimits {
+	limits := model.ClientLimits{
+		ClientID:  client.ClientID,
+		Overrides: client.Overrides(),
+		Effective: client.EffectiveLimits(h.rateLimiter.DefaultLimits()),
+	}
+	if client.Plan != nil {
+		limits.Plan = client.Plan.Name
+	}
+	return limits
+}
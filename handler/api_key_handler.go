@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"errors"
+	"nexmedis-golang/model"
+	"nexmedis-golang/store"
+	"nexmedis-golang/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// maxActiveAPIKeys is how many working keys a client may hold at once
+	maxActiveAPIKeys = 10
+	// maxAPIKeyLifetime is the longest expiry a new key may be given
+	maxAPIKeyLifetime = 365 * 24 * time.Hour
+	// defaultRotationGrace is how long a rotated key keeps working by default
+	defaultRotationGrace = 24 * time.Hour
+	// maxRotationGrace is the longest a rotated key may keep working
+	maxRotationGrace = 30 * 24 * time.Hour
+)
+
+// APIKeyHandler handles the API keys of the authenticated client
+type APIKeyHandler struct {
+	apiKeyStore *store.APIKeyStore
+}
+
+// NewAPIKeyHandler creates a new APIKeyHandler
+func NewAPIKeyHandler(apiKeyStore *store.APIKeyStore) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyStore: apiKeyStore}
+}
+
+// ListKeys returns the API keys of the authenticated client
+//
+//	@Summary		List API keys
+//	@Description	List all API keys of the authenticated client, newest first, including expired and revoked ones. Keys are identified by their prefix; the keys themselves are never shown again.
+//	@Tags			API Keys
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	object{success=bool,message=string,data=[]model.APIKeyResponse}	"API keys retrieved successfully"
+//	@Failure		401	{object}	object{success=bool,message=string,error=string}	"Client not found in context"
+//	@Failure		500	{object}	object{success=bool,message=string,error=string}	"Failed to list API keys"
+//	@Router			/api/keys [get]
+func (h *APIKeyHandler) ListKeys(c echo.Context) error {
+	clientID, ok := clientIDFromContext(c)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Client not found in context")
+	}
+
+	keys, err := h.apiKeyStore.ListByClient(clientID)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to list API keys", err.Error())
+	}
+
+	response := make([]*model.APIKeyResponse, 0, len(keys))
+	for i := range keys {
+		response = append(response, keys[i].ToResponse())
+	}
+
+	return utils.OKResponse(c, "API keys retrieved successfully", response)
+}
+
+// CreateKey creates an additional API key for the authenticated client
+//
+//	@Summary		Create API key
+//	@Description	Create an additional API key with a subset of the scopes of the current token (all of them when scopes is omitted). The key is only returned in this response. A client can hold up to 10 active keys.
+//	@Tags			API Keys
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			request	body		model.CreateAPIKeyRequest	true	"Key to create"
+//	@Success		201		{object}	object{success=bool,message=string,data=model.APIKeyResponse}	"API key created successfully"
+//	@Failure		400		{object}	object{success=bool,message=string,error=string}	"Invalid request body or too many active keys"
+//	@Failure		401		{object}	object{success=bool,message=string,error=string}	"Client not found in context"
+//	@Failure		403		{object}	object{success=bool,message=string,error=string}	"Requested scopes exceed the current token"
+//	@Failure		500		{object}	object{success=bool,message=string,error=string}	"Failed to create API key"
+//	@Router			/api/keys [post]
+func (h *APIKeyHandler) CreateKey(c echo.Context) error {
+	clientID, ok := clientIDFromContext(c)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Client not found in context")
+	}
+
+	var req model.CreateAPIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body")
+	}
+
+	label := utils.SanitizeString(req.Label)
+	if len(label) > 100 {
+		return utils.BadRequestResponse(c, "label must be at most 100 characters")
+	}
+
+	// A key never grants more than the token used to create it
+	granted, _ := c.Get("scopes").([]string)
+	scopes := granted
+	if len(req.Scopes) > 0 {
+		parsed, err := model.ParseScopes(req.Scopes)
+		if err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
+		if !model.HasScopes(granted, parsed...) {
+			return utils.ForbiddenResponse(c, "Cannot grant scopes the current token does not have")
+		}
+		scopes = parsed
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresIn != "" {
+		lifetime, err := utils.ParseWindow(req.ExpiresIn, 0, maxAPIKeyLifetime)
+		if err != nil {
+			return utils.BadRequestResponse(c, "expires_in: "+err.Error())
+		}
+		expiry := time.Now().Add(lifetime)
+		expiresAt = &expiry
+	}
+
+	active, err := h.apiKeyStore.CountActive(clientID)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to create API key", err.Error())
+	}
+	if active >= maxActiveAPIKeys {
+		return utils.BadRequestResponse(c, "too many active API keys, revoke one first")
+	}
+
+	key, err := newAPIKey(clientID, label, scopes, expiresAt)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to generate API key", err.Error())
+	}
+
+	if err := h.apiKeyStore.Create(key); err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to create API key", err.Error())
+	}
+
+	return utils.CreatedResponse(c, "API key created successfully", key.ToResponse())
+}
+
+// RotateKey replaces an API key with a new one
+//
+//	@Summary		Rotate API key
+//	@Description	Create a new key with the same label, scopes and lifetime to replace an active key. The current token must hold every scope of the key. The old key keeps working for the grace period (24h by default, up to 30d) so callers can switch without downtime, and refresh tokens obtained with it expire at the end of the grace period. The new key is only returned in this response.
+//	@Tags			API Keys
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			key_id	path		string						true	"API key ID"
+//	@Param			request	body		model.RotateAPIKeyRequest	false	"Grace period"
+//	@Success		201		{object}	object{success=bool,message=string,data=object{key=model.APIKeyResponse,previous=model.APIKeyResponse}}	"API key rotated successfully"
+//	@Failure		400		{object}	object{success=bool,message=string,error=string}	"Invalid request body, invalid grace period or the key is expired or revoked"
+//	@Failure		401		{object}	object{success=bool,message=string,error=string}	"Client not found in context"
+//	@Failure		403		{object}	object{success=bool,message=string,error=string}	"The key has scopes the current token does not have"
+//	@Failure		404		{object}	object{success=bool,message=string,error=string}	"API key not found"
+//	@Failure		500		{object}	object{success=bool,message=string,error=string}	"Failed to rotate API key"
+//	@Router			/api/keys/{key_id}/rotate [post]
+func (h *APIKeyHandler) RotateKey(c echo.Context) error {
+	clientID, ok := clientIDFromContext(c)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Client not found in context")
+	}
+
+	keyID, err := uuid.Parse(c.Param("key_id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "Invalid key ID")
+	}
+
+	// The body is optional, but a malformed one is refused
+	var req model.RotateAPIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body")
+	}
+
+	grace, err := utils.ParseWindow(req.GracePeriod, defaultRotationGrace, maxRotationGrace)
+	if err != nil {
+		return utils.BadRequestResponse(c, "grace_period: "+err.Error())
+	}
+
+	// The new key inherits the label, scopes and lifetime of the key it replaces
+	current, err := h.apiKeyStore.FindByID(clientID, keyID)
+	if err != nil {
+		return utils.NotFoundResponse(c, "API key not found")
+	}
+
+	// Like a created key, the new key never grants more than the current token
+	granted, _ := c.Get("scopes").([]string)
+	if !model.HasScopes(granted, current.ScopeList()...) {
+		return utils.ForbiddenResponse(c, "Cannot rotate a key with scopes the current token does not have")
+	}
+
+	var expiresAt *time.Time
+	if current.ExpiresAt != nil {
+		expiry := time.Now().Add(current.ExpiresAt.Sub(current.CreatedAt))
+		expiresAt = &expiry
+	}
+
+	next, err := newAPIKey(clientID, current.Label, current.ScopeList(), expiresAt)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to generate API key", err.Error())
+	}
+
+	previous, err := h.apiKeyStore.Rotate(clientID, keyID, next, grace)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrAPIKeyNotFound):
+			return utils.NotFoundResponse(c, "API key not found")
+		case errors.Is(err, store.ErrAPIKeyInactive):
+			return utils.BadRequestResponse(c, "Only active API keys can be rotated")
+		default:
+			return utils.InternalServerErrorResponse(c, "Failed to rotate API key", err.Error())
+		}
+	}
+
+	return utils.CreatedResponse(c, "API key rotated successfully", map[string]interface{}{
+		"key":      next.ToResponse(),
+		"previous": previous.ToResponse(),
+	})
+}
+
+// RevokeKey revokes an API key right away
+//
+//	@Summary		Revoke API key
+//	@Description	Revoke an API key. It stops working immediately, including during a rotation grace period, and the refresh tokens obtained with it are revoked. Access tokens obtained with it stay valid until they expire; use /api/auth/revoke-all to end them as well.
+//	@Tags			API Keys
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			key_id	path		string	true	"API key ID"
+//	@Success		200		{object}	object{success=bool,message=string,data=model.APIKeyResponse}	"API key revoked successfully"
+//	@Failure		400		{object}	object{success=bool,message=string,error=string}	"Invalid key ID"
+//	@Failure		401		{object}	object{success=bool,message=string,error=string}	"Client not found in context"
+//	@Failure		404		{object}	object{success=bool,message=string,error=string}	"API key not found"
+//	@Failure		500		{object}	object{success=bool,message=string,error=string}	"Failed to revoke API key"
+//	@Router			/api/keys/{key_id} [delete]
+func (h *APIKeyHandler) RevokeKey(c echo.Context) error {
+	clientID, ok := clientIDFromContext(c)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Client not found in context")
+	}
+
+	keyID, err := uuid.Parse(c.Param("key_id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "Invalid key ID")
+	}
+
+	key, err := h.apiKeyStore.Revoke(clientID, keyID)
+	if err != nil {
+		if errors.Is(err, store.ErrAPIKeyNotFound) {
+			return utils.NotFoundResponse(c, "API key not found")
+		}
+		return utils.InternalServerErrorResponse(c, "Failed to revoke API key", err.Error())
+	}
+
+	return utils.OKResponse(c, "API key revoked successfully", key.ToResponse())
+}
+
+// newAPIKey generates a key for a client. The plaintext is kept on the
+// returned key so it can be shown once.
+func newAPIKey(clientID uuid.UUID, label string, scopes []string, expiresAt *time.Time) (*model.APIKey, error) {
+	apiKey, err := utils.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.APIKey{
+		ClientID:  clientID,
+		Label:     label,
+		Prefix:    utils.APIKeyPrefix(apiKey),
+		Hash:      utils.HashToken(apiKey),
+		Scopes:    model.JoinScopes(scopes),
+		Key:       apiKey,
+		ExpiresAt: expiresAt,
+	}, nil
+}
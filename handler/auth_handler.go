@@ -1,37 +1,53 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
 	"nexmedis-golang/model"
 	"nexmedis-golang/store"
 	"nexmedis-golang/utils"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
 )
 
 // AuthHandler handles authentication-related requests
 type AuthHandler struct {
-	clientStore *store.ClientStore
+	clientStore  *store.ClientStore
+	apiKeyStore  *store.APIKeyStore
+	refreshStore *store.RefreshTokenStore
+	loginGuard   *utils.LoginGuard
 }
 
-// NewAuthHandler creates a new AuthHandler
-func NewAuthHandler(clientStore *store.ClientStore) *AuthHandler {
+// NewAuthHandler creates a new AuthHandler. loginGuard locks out source IPs
+// and API key prefixes after repeated failed logins.
+func NewAuthHandler(clientStore *store.ClientStore, apiKeyStore *store.APIKeyStore, refreshStore *store.RefreshTokenStore, loginGuard *utils.LoginGuard) *AuthHandler {
 	return &AuthHandler{
-		clientStore: clientStore,
+		clientStore:  clientStore,
+		apiKeyStore:  apiKeyStore,
+		refreshStore: refreshStore,
+		loginGuard:   loginGuard,
 	}
 }
 
-// Login handles client authentication and returns a JWT token
+// Login handles client authentication and returns an access and a refresh token
 //
 //	@Summary		Login to get JWT token
-//	@Description	Authenticate using API key and receive a JWT token for accessing protected endpoints
+//	@Description	Authenticate using API key and receive a short-lived JWT access token for protected endpoints and a refresh token to renew it. Both carry the scopes of the key. expires_in and refresh_expires_in are in seconds. Repeated failures lock out the source IP, for longer with every lockout. Further failures with a locked out API key prefix are answered with 429 as well, but a valid key still logs in.
 //	@Tags			Authentication
 //	@Accept			json
 //	@Produce		json
 //	@Param			request	body		model.LoginRequest	true	"Login credentials"
-//	@Success		200		{object}	object{success=bool,message=string,data=object{token=string,client_id=string,expires_in=string}}	"Login successful"
+//	@Success		200		{object}	object{success=bool,message=string,data=object{token=string,token_type=string,scope=string,expires_in=int,expires_at=string,refresh_token=string,refresh_expires_in=int,client_id=string,role=string}}	"Login successful"
 //	@Failure		400		{object}	object{success=bool,message=string,error=string}	"Invalid request body or API key format"
 //	@Failure		401		{object}	object{success=bool,message=string,error=string}	"Invalid API key"
+//	@Failure		403		{object}	object{success=bool,message=string,error=string}	"Email address not verified"
+//	@Failure		429		{object}	object{success=bool,message=string,error=string}	"Too many failed attempts, retry after the Retry-After header"
 //	@Failure		500		{object}	object{success=bool,message=string,error=string}	"Failed to generate token"
 //	@Router			/api/login [post]
 func (h *AuthHandler) Login(c echo.Context) error {
@@ -45,83 +61,163 @@ func (h *AuthHandler) Login(c echo.Context) error {
 		return utils.BadRequestResponse(c, err.Error())
 	}
 
+	// Refuse locked out source IPs. Key prefixes are public, so their lockout
+	// only applies to failed attempts and cannot lock the owner out.
+	ctx := c.Request().Context()
+	ip := c.RealIP()
+	keySubject := utils.GuardSubject{Kind: "key", Value: utils.APIKeyPrefix(req.APIKey), BackoffOnly: true}
+	subjects := []utils.GuardSubject{{Kind: "ip", Value: ip}, keySubject}
+	if locked := h.loginGuard.Check(ctx, subjects...); locked > 0 {
+		return lockedOutResponse(c, locked)
+	}
+
 	// Find client by API key
-	client, err := h.clientStore.FindByAPIKey(req.APIKey)
+	key, err := h.apiKeyStore.Authenticate(req.APIKey)
+	if errors.Is(err, store.ErrClientUnverified) {
+		return utils.ForbiddenResponse(c, "Email address not verified")
+	}
 	if err != nil {
+		if locked := h.loginGuard.Record(ctx, ip, subjects...); locked > 0 {
+			return lockedOutResponse(c, locked)
+		}
 		return utils.UnauthorizedResponse(c, "Invalid API key")
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateJWT(client.ID, client.Email)
+	client := key.Client
+
+	// The source IP keeps its count, so a valid key cannot be used to reset it
+	h.loginGuard.Reset(ctx, keySubject)
+
+	// The session inherits the scopes of the key
+	refreshToken, record, err := h.refreshStore.Issue(key, utils.RefreshTokenLifetime())
 	if err != nil {
 		return utils.InternalServerErrorResponse(c, "Failed to generate token", err.Error())
 	}
 
-	response := map[string]interface{}{
-		"token":      token,
-		"client_id":  client.ClientID,
-		"expires_in": "24h",
-	}
-
-	return utils.OKResponse(c, "Login successful", response)
+	return tokenResponse(c, "Login successful", client, refreshToken, record)
 }
 
-// RefreshToken handles JWT token refresh
+// RefreshToken exchanges a refresh token for a new access and refresh token
 //
 //	@Summary		Refresh JWT token
-//	@Description	Refresh an existing JWT token to extend the session
+//	@Description	Exchange a refresh token for a new access token and a new refresh token. Each refresh token can be used once. Presenting a used refresh token again revokes every refresh token descended from the same login. Refresh tokens stop working once the API key used to log in is revoked or expires, including at the end of a rotation grace period.
 //	@Tags			Authentication
 //	@Accept			json
 //	@Produce		json
-//	@Security		BearerAuth
-//	@Success		200	{object}	object{success=bool,message=string,data=object{token=string,expires_in=string}}	"Token refreshed successfully"
-//	@Failure		401	{object}	object{success=bool,message=string,error=string}	"Invalid or expired token"
+//	@Param			request	body		model.RefreshTokenRequest	true	"Refresh token"
+//	@Success		200		{object}	object{success=bool,message=string,data=object{token=string,token_type=string,scope=string,expires_in=int,expires_at=string,refresh_token=string,refresh_expires_in=int,client_id=string,role=string}}	"Token refreshed successfully"
+//	@Failure		400		{object}	object{success=bool,message=string,error=string}	"Invalid request body"
+//	@Failure		401		{object}	object{success=bool,message=string,error=string}	"Invalid, expired, revoked or reused refresh token, or its API key is no longer active"
+//	@Failure		500		{object}	object{success=bool,message=string,error=string}	"Failed to refresh token"
 //	@Router			/api/auth/refresh [post]
 func (h *AuthHandler) RefreshToken(c echo.Context) error {
-	// Get current token from Authorization header
-	authHeader := c.Request().Header.Get("Authorization")
-	if authHeader == "" {
-		return utils.UnauthorizedResponse(c, "Authorization header required")
+	var req model.RefreshTokenRequest
+	if err := c.Bind(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body")
 	}
 
-	// Extract token (assuming "Bearer <token>")
-	tokenString := ""
-	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-		tokenString = authHeader[7:]
-	} else {
-		return utils.UnauthorizedResponse(c, "Invalid authorization header format")
+	if err := utils.ValidateRequired(req.RefreshToken, "refresh_token"); err != nil {
+		return utils.BadRequestResponse(c, err.Error())
 	}
 
-	// Refresh token
-	newToken, err := utils.RefreshJWT(tokenString)
+	refreshToken, record, err := h.refreshStore.Rotate(req.RefreshToken, utils.RefreshTokenLifetime())
 	if err != nil {
-		return utils.UnauthorizedResponse(c, "Invalid or expired token")
+		switch {
+		case errors.Is(err, store.ErrRefreshTokenReused):
+			log.Warnf("Security event: refresh token reuse from %s, token family revoked", c.RealIP())
+			return utils.UnauthorizedResponse(c, "Refresh token was already used, log in again")
+		case errors.Is(err, store.ErrRefreshTokenInvalid):
+			return utils.UnauthorizedResponse(c, "Invalid or expired refresh token")
+		default:
+			return utils.InternalServerErrorResponse(c, "Failed to refresh token", err.Error())
+		}
 	}
 
-	response := map[string]interface{}{
-		"token":      newToken,
-		"expires_in": "24h",
+	client, err := h.clientStore.FindByID(record.ClientID)
+	if err != nil {
+		return utils.UnauthorizedResponse(c, "Client not found")
 	}
 
-	return utils.OKResponse(c, "Token refreshed successfully", response)
+	return tokenResponse(c, "Token refreshed successfully", client, refreshToken, record)
 }
 
-// Logout handles client logout (token invalidation would go here)
+// Logout revokes the tokens of the current session
 //
 //	@Summary		Logout
-//	@Description	Logout and invalidate the current session (token blacklisting would be implemented here)
+//	@Description	Logout and revoke the current access token. The token stays on the denylist until it would have expired. When a refresh token is sent, every refresh token descended from the same login is revoked as well.
 //	@Tags			Authentication
 //	@Accept			json
 //	@Produce		json
 //	@Security		BearerAuth
-//	@Success		200	{object}	object{success=bool,message=string}	"Logout successful"
+//	@Param			request	body		model.RefreshTokenRequest	false	"Refresh token of the session"
+//	@Success		200		{object}	object{success=bool,message=string}	"Logout successful"
+//	@Failure		401		{object}	object{success=bool,message=string,error=string}	"Invalid, expired or revoked token"
+//	@Failure		503		{object}	object{success=bool,message=string,error=string}	"Token denylist unavailable"
 //	@Router			/api/auth/logout [post]
 func (h *AuthHandler) Logout(c echo.Context) error {
-	// In a production system, you would invalidate the token here
-	// This could involve adding it to a blacklist in Redis
+	claims, ok := c.Get("jwt_claims").(*utils.JWTClaims)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Token not found in context")
+	}
+
+	// The body is optional, so a missing or malformed one only skips this step
+	var req model.RefreshTokenRequest
+	if err := c.Bind(&req); err == nil && req.RefreshToken != "" {
+		if err := h.refreshStore.RevokeFamily(req.RefreshToken); err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to revoke refresh token", err.Error())
+		}
+	}
+
+	// Tokens issued before jti was added can only be revoked all at once
+	revoke := utils.RevokeToken(c.Request().Context(), claims)
+	if claims.ID == "" {
+		revoke = utils.RevokeClientTokens(c.Request().Context(), claims.ClientID)
+	}
+	if revoke != nil {
+		return revokeFailedResponse(c, revoke)
+	}
+
 	return utils.OKResponse(c, "Logout successful", nil)
 }
 
+// RevokeAllTokens revokes every token issued to the authenticated client
+//
+//	@Summary		Revoke all tokens
+//	@Description	Revoke every access and refresh token issued to the authenticated client so far, including the current ones, for example after the API key leaked. Log in again to get new tokens.
+//	@Tags			Authentication
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	object{success=bool,message=string}	"All tokens revoked successfully"
+//	@Failure		401	{object}	object{success=bool,message=string,error=string}	"Invalid, expired or revoked token"
+//	@Failure		500	{object}	object{success=bool,message=string,error=string}	"Failed to revoke tokens"
+//	@Failure		503	{object}	object{success=bool,message=string,error=string}	"Token denylist unavailable"
+//	@Router			/api/auth/revoke-all [post]
+func (h *AuthHandler) RevokeAllTokens(c echo.Context) error {
+	clientID, ok := clientIDFromContext(c)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Client not found in context")
+	}
+
+	if err := revokeClientSessions(c.Request().Context(), h.refreshStore, clientID); err != nil {
+		return revokeFailedResponse(c, err)
+	}
+
+	return utils.OKResponse(c, "All tokens revoked successfully", nil)
+}
+
+// GetJWKS publishes the public keys that access tokens are verified with
+//
+//	@Summary		JSON Web Key Set
+//	@Description	Public keys for verifying access tokens without the signing key, as a JWKS (RFC 7517). Tokens name their key in the kid header. Keys still accepted after a rotation are listed as well. The set is empty when tokens are signed with an HS256 secret.
+//	@Tags			Authentication
+//	@Produce		json
+//	@Success		200	{object}	utils.JSONWebKeySet	"Key set"
+//	@Router			/.well-known/jwks.json [get]
+func (h *AuthHandler) GetJWKS(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, utils.JWKS())
+}
+
 // GetProfile returns the authenticated client's profile
 //
 //	@Summary		Get client profile
@@ -153,3 +249,49 @@ func (h *AuthHandler) GetProfile(c echo.Context) error {
 
 	return utils.OKResponse(c, "Profile retrieved successfully", client.ToResponse(false))
 }
+
+// tokenResponse issues an access token for a client and returns it together
+// with a refresh token. Lifetimes are reported in seconds from the real expiry.
+func tokenResponse(c echo.Context, message string, client *model.Client, refreshToken string, record *model.RefreshToken) error {
+	scopes := model.SplitScopes(record.Scopes)
+	token, expiresAt, err := utils.GenerateJWT(client.ID, client.Email, client.Role, scopes)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to generate token", err.Error())
+	}
+
+	response := map[string]interface{}{
+		"token":              token,
+		"token_type":         "Bearer",
+		"scope":              model.JoinScopes(scopes),
+		"expires_in":         int(time.Until(expiresAt).Seconds()),
+		"expires_at":         expiresAt.UTC(),
+		"refresh_token":      refreshToken,
+		"refresh_expires_in": int(time.Until(record.ExpiresAt).Seconds()),
+		"client_id":          client.ClientID,
+		"role":               client.Role,
+	}
+
+	return utils.OKResponse(c, message, response)
+}
+
+// revokeClientSessions revokes every refresh and access token of a client
+func revokeClientSessions(ctx context.Context, refreshStore *store.RefreshTokenStore, clientID uuid.UUID) error {
+	if err := refreshStore.RevokeByClient(clientID); err != nil {
+		return err
+	}
+	return utils.RevokeClientTokens(ctx, clientID)
+}
+
+// revokeFailedResponse reports a token revocation that could not be stored
+func revokeFailedResponse(c echo.Context, err error) error {
+	if errors.Is(err, utils.ErrDenylistUnavailable) {
+		return utils.ServiceUnavailableResponse(c, "Token revocation is temporarily unavailable")
+	}
+	return utils.InternalServerErrorResponse(c, "Failed to revoke token", err.Error())
+}
+
+// lockedOutResponse refuses a request from a locked out source IP or account
+func lockedOutResponse(c echo.Context, locked time.Duration) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(max(int(math.Ceil(locked.Seconds())), 1)))
+	return utils.TooManyRequestsResponse(c, "Too many attempts, try again later")
+}
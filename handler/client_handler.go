@@ -1,37 +1,68 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"net/url"
 	"nexmedis-golang/model"
 	"nexmedis-golang/store"
 	"nexmedis-golang/utils"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
 )
 
+// VerificationConfig controls the verification emails sent to new clients
+type VerificationConfig struct {
+	Lifetime time.Duration // How long a verification token can be used (default 24h)
+	LinkURL  string        // Optional page that receives the token in its token query parameter
+}
+
 // ClientHandler handles client-related requests
 type ClientHandler struct {
-	clientStore *store.ClientStore
+	clientStore       *store.ClientStore
+	planStore         *store.PlanStore
+	verificationStore *store.EmailVerificationStore
+	mailer            utils.Mailer
+	verification      VerificationConfig
+	registerGuard     *utils.LoginGuard
 }
 
-// NewClientHandler creates a new ClientHandler
-func NewClientHandler(clientStore *store.ClientStore) *ClientHandler {
+// NewClientHandler creates a new ClientHandler. New clients verify their email
+// address with a token sent through mailer. registerGuard limits the
+// registrations per source IP and the repeated attempts per email address.
+func NewClientHandler(clientStore *store.ClientStore, planStore *store.PlanStore, verificationStore *store.EmailVerificationStore, mailer utils.Mailer, verification VerificationConfig, registerGuard *utils.LoginGuard) *ClientHandler {
+	if verification.Lifetime <= 0 {
+		verification.Lifetime = 24 * time.Hour
+	}
+
 	return &ClientHandler{
-		clientStore: clientStore,
+		clientStore:       clientStore,
+		planStore:         planStore,
+		verificationStore: verificationStore,
+		mailer:            mailer,
+		verification:      verification,
+		registerGuard:     registerGuard,
 	}
 }
 
 // Register handles client registration
 //
 //	@Summary		Register a new client
-//	@Description	Register a new client and receive an API key for authentication
+//	@Description	Register a new client pending email verification. A verification token is sent to the email address; verify it with /api/verify-email to activate the client and receive its API key. Until then the client cannot log in or record hits. Registrations are limited per source IP, and repeated attempts for the same email address lead to a temporary lockout.
 //	@Tags			Clients
 //	@Accept			json
 //	@Produce		json
 //	@Param			request	body		model.RegisterRequest	true	"Client registration details"
-//	@Success		201		{object}	object{success=bool,message=string,data=model.ClientResponse}	"Client registered successfully"
+//	@Success		201		{object}	object{success=bool,message=string,data=model.ClientResponse}	"Client registered, verification email sent"
 //	@Failure		400		{object}	object{success=bool,message=string,error=string}	"Invalid request body or validation error"
 //	@Failure		409		{object}	object{success=bool,message=string,error=string}	"Email already registered"
+//	@Failure		429		{object}	object{success=bool,message=string,error=string}	"Too many attempts, retry after the Retry-After header"
 //	@Failure		500		{object}	object{success=bool,message=string,error=string}	"Failed to create client"
+//	@Failure		503		{object}	object{success=bool,message=string,error=string}	"Client registered but the verification email could not be sent"
 //	@Router			/api/register [post]
 func (h *ClientHandler) Register(c echo.Context) error {
 	var req model.RegisterRequest
@@ -39,6 +70,15 @@ func (h *ClientHandler) Register(c echo.Context) error {
 		return utils.BadRequestResponse(c, "Invalid request body")
 	}
 
+	// Refuse locked out source IPs and email addresses
+	ctx := c.Request().Context()
+	ip := c.RealIP()
+	ipSubject := utils.GuardSubject{Kind: "ip", Value: ip}
+	emailSubject := utils.GuardSubject{Kind: "email", Value: strings.ToLower(strings.TrimSpace(req.Email))}
+	if locked := h.registerGuard.Check(ctx, ipSubject, emailSubject); locked > 0 {
+		return lockedOutResponse(c, locked)
+	}
+
 	// Validate input
 	if err := utils.ValidateRequired(req.Name, "name"); err != nil {
 		return utils.BadRequestResponse(c, err.Error())
@@ -62,26 +102,147 @@ func (h *ClientHandler) Register(c echo.Context) error {
 		return utils.InternalServerErrorResponse(c, "Failed to check email", err.Error())
 	}
 	if exists {
+		if locked := h.registerGuard.Record(ctx, ip, ipSubject, emailSubject); locked > 0 {
+			return lockedOutResponse(c, locked)
+		}
 		return utils.ConflictResponse(c, "Email already registered")
 	}
 
-	// Generate API key
-	apiKey, err := utils.GenerateAPIKey()
-	if err != nil {
-		return utils.InternalServerErrorResponse(c, "Failed to generate API key", err.Error())
+	// The client gets its first API key once it verified its email address
+	client := &model.Client{
+		Name:  utils.SanitizeString(req.Name),
+		Email: utils.SanitizeString(req.Email),
 	}
 
-	// Create client
-	client := &model.Client{
-		Name:   utils.SanitizeString(req.Name),
-		Email:  utils.SanitizeString(req.Email),
-		APIKey: apiKey,
+	// New clients start on the free plan
+	if plan, err := h.planStore.FindByName(model.PlanFree); err == nil {
+		client.PlanID = &plan.ID
 	}
 
 	if err := h.clientStore.Create(client); err != nil {
 		return utils.InternalServerErrorResponse(c, "Failed to create client", err.Error())
 	}
 
+	// Every registration counts towards the limit of its source IP
+	h.registerGuard.Record(ctx, ip, ipSubject)
+
+	if err := h.sendVerification(ctx, client); err != nil {
+		log.Errorf("Failed to send verification email to client %s: %v", client.ClientID, err)
+		return utils.ServiceUnavailableResponse(c, "Client registered but the verification email could not be sent, request a new one at /api/verify-email/resend")
+	}
+
+	return utils.CreatedResponse(c, "Client registered, check your email to verify it and receive your API key", client.ToResponse(false))
+}
+
+// VerifyEmail verifies the email address of a new client and issues its API key
+//
+//	@Summary		Verify email address
+//	@Description	Verify the email address of a new client with the token from the verification email. The client is activated and receives its first API key, which is only shown in this response. Each token can be used once.
+//	@Tags			Clients
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		model.VerifyEmailRequest	true	"Verification token"
+//	@Success		200		{object}	object{success=bool,message=string,data=model.ClientResponse}	"Email verified successfully"
+//	@Failure		400		{object}	object{success=bool,message=string,error=string}	"Invalid or expired verification token"
+//	@Failure		500		{object}	object{success=bool,message=string,error=string}	"Failed to verify email"
+//	@Router			/api/verify-email [post]
+func (h *ClientHandler) VerifyEmail(c echo.Context) error {
+	var req model.VerifyEmailRequest
+	if err := c.Bind(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body")
+	}
+
+	if err := utils.ValidateRequired(req.Token, "token"); err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+
+	apiKey, err := newAPIKey(uuid.Nil, "default", model.AllScopes, nil)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to generate API key", err.Error())
+	}
+
+	client, err := h.verificationStore.Verify(req.Token, apiKey)
+	if err != nil {
+		if errors.Is(err, store.ErrVerificationTokenInvalid) {
+			return utils.BadRequestResponse(c, "Invalid or expired verification token")
+		}
+		return utils.InternalServerErrorResponse(c, "Failed to verify email", err.Error())
+	}
+
 	// Return response with API key
-	return utils.CreatedResponse(c, "Client registered successfully", client.ToResponse(true))
+	return utils.OKResponse(c, "Email verified successfully", client.ToResponse(true))
+}
+
+// ResendVerification sends a new verification email
+//
+//	@Summary		Resend verification email
+//	@Description	Send a new verification token to a client that has not verified its email address yet. Earlier tokens stop working. The response is the same whether or not the address is registered, and requests share the limits of /api/register.
+//	@Tags			Clients
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		model.ResendVerificationRequest	true	"Registered email address"
+//	@Success		202		{object}	object{success=bool,message=string}	"Verification email sent if the address is pending verification"
+//	@Failure		400		{object}	object{success=bool,message=string,error=string}	"Invalid request body or email"
+//	@Failure		429		{object}	object{success=bool,message=string,error=string}	"Too many attempts, retry after the Retry-After header"
+//	@Router			/api/verify-email/resend [post]
+func (h *ClientHandler) ResendVerification(c echo.Context) error {
+	var req model.ResendVerificationRequest
+	if err := c.Bind(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body")
+	}
+
+	if err := utils.ValidateEmail(req.Email); err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+
+	// Resends share the limits of registrations, so they cannot be used to
+	// flood an inbox
+	ctx := c.Request().Context()
+	ip := c.RealIP()
+	ipSubject := utils.GuardSubject{Kind: "ip", Value: ip}
+	emailSubject := utils.GuardSubject{Kind: "email", Value: strings.ToLower(strings.TrimSpace(req.Email))}
+	if locked := h.registerGuard.Check(ctx, ipSubject, emailSubject); locked > 0 {
+		return lockedOutResponse(c, locked)
+	}
+	h.registerGuard.Record(ctx, ip, ipSubject, emailSubject)
+
+	client, err := h.clientStore.FindByEmail(utils.SanitizeString(req.Email))
+	if err == nil && !client.Verified() {
+		if err := h.sendVerification(ctx, client); err != nil {
+			log.Errorf("Failed to send verification email to client %s: %v", client.ClientID, err)
+		}
+	}
+
+	return utils.AcceptedResponse(c, "If the email address is pending verification, a new verification email was sent", nil)
+}
+
+// sendVerification issues a verification token for a client and emails it.
+// The email does not repeat the client's name, since anyone can register
+// with any address.
+func (h *ClientHandler) sendVerification(ctx context.Context, client *model.Client) error {
+	token, err := h.verificationStore.Issue(client.ID, h.verification.Lifetime)
+	if err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	body.WriteString("Hello,\n\n")
+	body.WriteString("Someone registered an API client with this email address. To verify it and receive the API key, use this token:\n\n")
+	body.WriteString(token + "\n\n")
+	if h.verification.LinkURL != "" {
+		separator := "?"
+		if strings.Contains(h.verification.LinkURL, "?") {
+			separator = "&"
+		}
+		body.WriteString("Or open " + h.verification.LinkURL + separator + "token=" + url.QueryEscape(token) + "\n\n")
+	}
+	body.WriteString(`Send it as {"token": "..."} to POST /api/verify-email. `)
+	body.WriteString("The token expires at " + time.Now().Add(h.verification.Lifetime).UTC().Format(time.RFC1123) + ".\n\n")
+	body.WriteString("If you did not register, ignore this email.\n")
+
+	return h.mailer.Send(ctx, utils.MailMessage{
+		To:      client.Email,
+		Subject: "Verify your email address",
+		Body:    body.String(),
+	})
 }
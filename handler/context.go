@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"nexmedis-golang/model"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// apiClientFromContext returns the client and API key resolved by the API key middleware
+func apiClientFromContext(c echo.Context) (*model.Client, *model.APIKey, bool) {
+	client, ok := c.Get("api_client").(*model.Client)
+	if !ok {
+		return nil, nil, false
+	}
+
+	apiKey, ok := c.Get("api_key").(*model.APIKey)
+	if !ok {
+		return nil, nil, false
+	}
+	return client, apiKey, true
+}
+
+// clientIDFromContext returns the client UUID set by the JWT middleware
+func clientIDFromContext(c echo.Context) (uuid.UUID, bool) {
+	clientID, ok := c.Get("client_id").(string)
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	parsedID, err := uuid.Parse(clientID)
+	if err != nil {
+		return uuid.Nil, false
+	}
+
+	return parsedID, true
+}
+
+// canAccessClient reports whether the authenticated client may see the data
+// of clientID: its own, or any client's for admins
+func canAccessClient(c echo.Context, clientID uuid.UUID) bool {
+	if role, _ := c.Get("role").(string); role == model.RoleAdmin {
+		return true
+	}
+
+	own, ok := clientIDFromContext(c)
+	return ok && own == clientID
+}
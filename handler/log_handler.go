@@ -2,45 +2,77 @@ package handler
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
 	"nexmedis-golang/db"
 	"nexmedis-golang/model"
 	"nexmedis-golang/store"
 	"nexmedis-golang/utils"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
 )
 
+// maxBatchSize is the maximum number of entries accepted in a single batch request
+const maxBatchSize = 1000
+
 // LogHandler handles API log-related requests
 type LogHandler struct {
 	logStore    *store.LogStore
 	clientStore *store.ClientStore
 	rateLimiter *utils.RateLimiter
+	logQueue    *store.LogQueue
+	idempotency *utils.IdempotencyStore
+	routeStore  *store.RouteTemplateStore
+	quotaStore  *store.QuotaStore
 }
 
-// NewLogHandler creates a new LogHandler
-func NewLogHandler(logStore *store.LogStore, clientStore *store.ClientStore, rateLimiter *utils.RateLimiter) *LogHandler {
-	return &LogHandler{
+// NewLogHandler creates a new LogHandler. When logQueue is not nil, single
+// hits are written asynchronously through the queue.
+func NewLogHandler(logStore *store.LogStore, clientStore *store.ClientStore, routeStore *store.RouteTemplateStore, quotaStore *store.QuotaStore, rateLimiter *utils.RateLimiter, logQueue *store.LogQueue, idempotency *utils.IdempotencyStore) *LogHandler {
+	h := &LogHandler{
 		logStore:    logStore,
 		clientStore: clientStore,
+		routeStore:  routeStore,
+		quotaStore:  quotaStore,
 		rateLimiter: rateLimiter,
+		logQueue:    logQueue,
+		idempotency: idempotency,
+	}
+
+	if logQueue != nil {
+		logQueue.OnFlush(h.onLogsFlushed)
+		logQueue.OnSkip(h.onLogsSkipped)
+		logQueue.OnDrop(h.onLogsDropped)
 	}
+
+	return h
 }
 
 // RecordLog handles recording an API hit
 //
 //	@Summary		Record an API hit
-//	@Description	Record an API activity/hit with client identification, IP address, and endpoint information. This endpoint is rate-limited per client.
+//	@Description	Record an API activity/hit with client identification, IP address, and endpoint information. This endpoint is rate-limited per client and counts against the monthly quota of the client's plan. When the asynchronous write pipeline is enabled the hit is queued and written in bulk, and the endpoint answers 202. Retries carrying the same Idempotency-Key header (or event_id) return the original log_id without recording a duplicate or charging the rate limit again.
 //	@Tags			Logs
 //	@Accept			json
 //	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			Idempotency-Key	header	string	false	"Unique key used to deduplicate retries"
 //	@Param			request	body		model.LogRequest	true	"API log details"
+//	@Success		200		{object}	object{success=bool,message=string,data=object{log_id=string,replayed=bool}}	"API hit already recorded"
 //	@Success		201		{object}	object{success=bool,message=string,data=object{log_id=string,timestamp=string,remaining_requests=int}}	"API hit recorded successfully"
+//	@Success		202		{object}	object{success=bool,message=string,data=object{log_id=string,timestamp=string,remaining_requests=int}}	"API hit queued for recording"
 //	@Failure		400		{object}	object{success=bool,message=string,error=string}	"Invalid request body or validation error"
 //	@Failure		401		{object}	object{success=bool,message=string,error=string}	"Invalid API key"
-//	@Failure		429		{object}	object{success=bool,message=string,error=string}	"Rate limit exceeded"
+//	@Failure		429		{object}	object{success=bool,message=string,data=object{rule=string}}	"Rate limit or hard monthly quota exceeded, data.rule names the limit that triggered"
 //	@Failure		500		{object}	object{success=bool,message=string,error=string}	"Failed to record log"
+//	@Failure		503		{object}	object{success=bool,message=string,error=string}	"Ingestion queue is full or shutting down"
 //	@Router			/api/logs [post]
 func (h *LogHandler) RecordLog(c echo.Context) error {
 	var req model.LogRequest
@@ -48,11 +80,13 @@ func (h *LogHandler) RecordLog(c echo.Context) error {
 		return utils.BadRequestResponse(c, "Invalid request body")
 	}
 
-	// Validate input
-	if err := utils.ValidateAPIKey(req.APIKey); err != nil {
-		return utils.BadRequestResponse(c, err.Error())
+	// Get client from context (set by API key middleware)
+	client, apiKey, ok := apiClientFromContext(c)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Client not found in context")
 	}
 
+	// Validate input
 	if err := utils.ValidateIP(req.IP); err != nil {
 		return utils.BadRequestResponse(c, err.Error())
 	}
@@ -61,49 +95,630 @@ func (h *LogHandler) RecordLog(c echo.Context) error {
 		return utils.BadRequestResponse(c, err.Error())
 	}
 
-	// Find client by API key
-	client, err := h.clientStore.FindByAPIKey(req.APIKey)
-	if err != nil {
-		return utils.UnauthorizedResponse(c, "Invalid API key")
+	if err := validateLogDetails(req.LogDetails); err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+
+	// Resolve the idempotency key (header takes precedence over event_id)
+	eventID := c.Request().Header.Get("Idempotency-Key")
+	if eventID == "" {
+		eventID = req.EventID
+	}
+
+	if eventID != "" {
+		if err := utils.ValidateIdempotencyKey(eventID); err != nil {
+			return utils.BadRequestResponse(c, err.Error())
+		}
 	}
 
-	// Check rate limit
 	ctx := c.Request().Context()
-	allowed, remaining, err := h.rateLimiter.CheckLimit(ctx, client.ID)
+	logID := uuid.New()
+
+	// Replays return the original log without charging the rate limit again
+	if eventID != "" {
+		originalID, replayed, err := h.claimEventID(ctx, client.ID, eventID, logID)
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to check idempotency key", err.Error())
+		}
+		if replayed {
+			return replayResponse(c, originalID)
+		}
+	}
+
+	// Check every rate limit that applies to the hit
+	limit, err := h.rateLimiter.TakeHit(ctx, client.ID, utils.RateLimitHit{IP: req.IP, Endpoint: req.Endpoint}, 1)
 	if err != nil {
-		// Log error but continue (graceful degradation)
+		// Continue without rate limiting (graceful degradation)
+		log.Printf("Failed to apply rate limit to client %s: %v", client.ID, err)
 	}
+	c.Set("rate_limit", limit)
+	remaining := limit.Remaining
 
-	if !allowed {
-		return utils.TooManyRequestsResponse(c, "Rate limit exceeded")
+	if limit.Granted == 0 {
+		h.releaseEventID(ctx, client.ID, eventID)
+		return c.JSON(http.StatusTooManyRequests, utils.Response{
+			Success: false,
+			Message: "Rate limit exceeded",
+			Data:    map[string]interface{}{"rule": limit.Policy},
+		})
+	}
+
+	// Charge the monthly quota of the current billing period
+	charged, period, err := h.quotaStore.Consume(client.ID, 1, time.Now().UTC())
+	if err != nil {
+		h.releaseEventID(ctx, client.ID, eventID)
+		return utils.InternalServerErrorResponse(c, "Failed to check quota", err.Error())
+	}
+
+	if charged == 0 {
+		h.releaseEventID(ctx, client.ID, eventID)
+		return quotaExceededResponse(c, period)
 	}
 
 	// Create log entry
 	log := &model.APILog{
-		ClientID:  client.ID,
-		APIKey:    req.APIKey,
-		IP:        req.IP,
-		Endpoint:  req.Endpoint,
-		Timestamp: time.Now().UTC(),
+		ID:               logID,
+		ClientID:         client.ID,
+		APIKeyID:         &apiKey.ID,
+		IP:               req.IP,
+		Endpoint:         req.Endpoint,
+		EndpointTemplate: utils.NormalizeEndpoint(req.Endpoint, h.routePatterns(ctx, client.ID)),
+		Timestamp:        time.Now().UTC(),
+	}
+	if eventID != "" {
+		log.EventID = &eventID
+	}
+	applyLogDetails(log, req.LogDetails)
+
+	response := map[string]interface{}{
+		"log_id":             log.ID,
+		"timestamp":          log.Timestamp,
+		"remaining_requests": remaining,
+	}
+
+	// Hand the log over to the write pipeline when it is enabled
+	if h.logQueue != nil {
+		if err := h.logQueue.Enqueue(*log); err != nil {
+			h.releaseEventID(ctx, client.ID, eventID)
+			h.releaseQuota(client.ID, period, 1)
+			c.Response().Header().Set("Retry-After", "1")
+			return utils.ServiceUnavailableResponse(c, "Failed to queue log: "+err.Error())
+		}
+
+		return utils.AcceptedResponse(c, "API hit accepted for recording", response)
 	}
 
-	if err := h.logStore.Create(log); err != nil {
+	stored, err := h.logStore.Create(log)
+	if err != nil {
+		h.releaseEventID(ctx, client.ID, eventID)
+		h.releaseQuota(client.ID, period, 1)
 		return utils.InternalServerErrorResponse(c, "Failed to record log", err.Error())
 	}
 
+	// A concurrent request recorded the same event first
+	if stored.ID != log.ID {
+		h.releaseQuota(client.ID, period, 1)
+		return replayResponse(c, stored.ID)
+	}
+
 	// Invalidate cache for usage endpoints
 	go h.invalidateUsageCache(ctx, client.ID)
 
 	// Publish update via Redis Pub/Sub
-	go h.publishLogUpdate(ctx, log)
+	go h.publishLogUpdate(ctx, *log)
 
-	response := map[string]interface{}{
-		"log_id":             log.ID,
-		"timestamp":          log.Timestamp,
+	return utils.CreatedResponse(c, "API hit recorded successfully", response)
+}
+
+// RecordBatchLogs handles recording a batch of API hits for one client
+//
+//	@Summary		Record a batch of API hits
+//	@Description	Record up to 1000 API hits for one client in a single request. The body may be gzip-compressed (Content-Encoding: gzip). Valid entries are charged against the client's rate limits at once, grouped by the rules that apply to them, and then against the monthly quota, and the response reports acceptance per entry so only rejected entries need to be retried. Entries carrying an event_id that was already recorded are reported as replayed with their original log_id and are not charged again, and entries repeating an event_id within the batch share the outcome of its first entry.
+//	@Tags			Logs
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			request	body		model.BatchLogRequest	true	"Batch of API log details"
+//	@Success		201		{object}	object{success=bool,message=string,data=object{accepted=int,rejected=int,remaining_requests=int,results=[]model.BatchLogResult}}	"All entries recorded"
+//	@Success		200		{object}	object{success=bool,message=string,data=object{accepted=int,rejected=int,remaining_requests=int,results=[]model.BatchLogResult}}	"All entries already recorded"
+//	@Success		207		{object}	object{success=bool,message=string,data=object{accepted=int,rejected=int,remaining_requests=int,results=[]model.BatchLogResult}}	"Some entries recorded"
+//	@Failure		400		{object}	object{success=bool,message=string,error=string}	"Invalid request body or no valid entries"
+//	@Failure		401		{object}	object{success=bool,message=string,error=string}	"Invalid API key"
+//	@Failure		429		{object}	object{success=bool,message=string,data=object{accepted=int,rejected=int,remaining_requests=int,results=[]model.BatchLogResult}}	"Rate limit exceeded"
+//	@Failure		500		{object}	object{success=bool,message=string,error=string}	"Failed to record logs"
+//	@Router			/api/logs/batch [post]
+func (h *LogHandler) RecordBatchLogs(c echo.Context) error {
+	var req model.BatchLogRequest
+	if err := c.Bind(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body")
+	}
+
+	// Get client from context (set by API key middleware)
+	client, apiKey, ok := apiClientFromContext(c)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Client not found in context")
+	}
+
+	// Validate batch
+	if len(req.Logs) == 0 {
+		return utils.BadRequestResponse(c, "logs must contain at least one entry")
+	}
+
+	if len(req.Logs) > maxBatchSize {
+		return utils.BadRequestResponse(c, fmt.Sprintf("logs must not exceed %d entries", maxBatchSize))
+	}
+
+	// Validate each entry, keeping track of the valid ones
+	now := time.Now().UTC()
+	results := make([]model.BatchLogResult, len(req.Logs))
+	valid := make([]int, 0, len(req.Logs))
+	for i, entry := range req.Logs {
+		results[i].Index = i
+		if err := validateBatchEntry(entry); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		valid = append(valid, i)
+	}
+
+	if len(valid) == 0 {
+		return c.JSON(http.StatusBadRequest, utils.Response{
+			Success: false,
+			Message: "No valid log entries in batch",
+			Data:    batchResponse(results, 0),
+		})
+	}
+
+	// Entries replayed under a known event_id are reported with their original
+	// log and are not charged again. Repeats of an event_id within the batch
+	// are not reserved, they share the outcome of its first entry.
+	ctx := c.Request().Context()
+	logIDs := make(map[int]uuid.UUID, len(valid))
+	pending := make([]int, 0, len(valid))
+	firsts := make(map[string]int)
+	duplicates := make(map[int]int)
+	for _, i := range valid {
+		logIDs[i] = uuid.New()
+
+		eventID := req.Logs[i].EventID
+		if eventID == "" {
+			pending = append(pending, i)
+			continue
+		}
+
+		if first, ok := firsts[eventID]; ok {
+			duplicates[i] = first
+			continue
+		}
+		firsts[eventID] = i
+
+		originalID, replayed, err := h.claimEventID(ctx, client.ID, eventID, logIDs[i])
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to check idempotency keys", err.Error())
+		}
+		if replayed {
+			results[i].Accepted = true
+			results[i].Replayed = true
+			results[i].LogID = &originalID
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	if len(pending) == 0 {
+		resolveDuplicates(results, duplicates)
+		return utils.OKResponse(c, "Batch already recorded", batchResponse(results, 0))
+	}
+
+	// Charge the batch against the rate limits, once per group of entries that
+	// the same rules apply to
+	groups := make(map[string][]int)
+	order := make([]string, 0)
+	for _, i := range pending {
+		key := h.rateLimiter.RuleKey(utils.RateLimitHit{IP: req.Logs[i].IP, Endpoint: req.Logs[i].Endpoint})
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	granted := make(map[int]bool, len(pending))
+	var limit utils.RateLimitResult
+	for j, key := range order {
+		group := groups[key]
+		first := req.Logs[group[0]]
+
+		result, err := h.rateLimiter.TakeHit(ctx, client.ID, utils.RateLimitHit{IP: first.IP, Endpoint: first.Endpoint}, len(group))
+		if err != nil {
+			// Continue without rate limiting (graceful degradation)
+			log.Printf("Failed to apply rate limit to client %s: %v", client.ID, err)
+		}
+		if j == 0 || result.Remaining < limit.Remaining {
+			limit = result
+		}
+
+		for k, i := range group {
+			if k < result.Granted {
+				granted[i] = true
+				continue
+			}
+			results[i].Error = fmt.Sprintf("rate limit exceeded (rule %s)", result.Policy)
+			h.releaseEventID(ctx, client.ID, req.Logs[i].EventID)
+		}
+	}
+	c.Set("rate_limit", limit)
+	remaining := limit.Remaining
+
+	// Charge the entries that passed the rate limits against the monthly quota
+	allowed := make([]int, 0, len(granted))
+	for _, i := range pending {
+		if granted[i] {
+			allowed = append(allowed, i)
+		}
+	}
+
+	var period *model.QuotaPeriod
+	if len(allowed) > 0 {
+		charged, p, err := h.quotaStore.Consume(client.ID, len(allowed), now)
+		if err != nil {
+			for _, i := range allowed {
+				h.releaseEventID(ctx, client.ID, req.Logs[i].EventID)
+			}
+			return utils.InternalServerErrorResponse(c, "Failed to check quota", err.Error())
+		}
+		period = p
+
+		for _, i := range allowed[charged:] {
+			granted[i] = false
+			results[i].Error = "monthly quota exceeded"
+			h.releaseEventID(ctx, client.ID, req.Logs[i].EventID)
+		}
+	}
+
+	patterns := h.routePatterns(ctx, client.ID)
+	logs := make([]model.APILog, 0, len(granted))
+	recorded := make([]int, 0, len(granted))
+	for _, i := range pending {
+		if !granted[i] {
+			continue
+		}
+		entry := req.Logs[i]
+
+		timestamp := now
+		if entry.Timestamp != nil {
+			timestamp = entry.Timestamp.UTC()
+		}
+
+		apiLog := model.APILog{
+			ID:               logIDs[i],
+			ClientID:         client.ID,
+			APIKeyID:         &apiKey.ID,
+			IP:               entry.IP,
+			Endpoint:         entry.Endpoint,
+			EndpointTemplate: utils.NormalizeEndpoint(entry.Endpoint, patterns),
+			Timestamp:        timestamp,
+		}
+		if entry.EventID != "" {
+			eventID := entry.EventID
+			apiLog.EventID = &eventID
+		}
+		applyLogDetails(&apiLog, entry.LogDetails)
+		logs = append(logs, apiLog)
+		recorded = append(recorded, i)
+	}
+
+	if len(logs) == 0 {
+		message := "Rate limit exceeded"
+		if period != nil {
+			// Entries passed the rate limits but the hard quota is used up
+			message = "Monthly quota exceeded"
+			c.Response().Header().Set("Retry-After", strconv.Itoa(quotaRetryAfter(period)))
+		}
+
+		resolveDuplicates(results, duplicates)
+		return c.JSON(http.StatusTooManyRequests, utils.Response{
+			Success: false,
+			Message: message,
+			Data:    batchResponse(results, remaining),
+		})
+	}
+
+	skipped, err := h.logStore.BatchCreate(logs)
+	if err != nil {
+		for _, i := range recorded {
+			h.releaseEventID(ctx, client.ID, req.Logs[i].EventID)
+		}
+		h.releaseQuota(client.ID, period, len(recorded))
+		return utils.InternalServerErrorResponse(c, "Failed to record logs", err.Error())
+	}
+
+	// Entries whose event_id a concurrent request recorded first were skipped,
+	// they are reported with the existing log and not charged
+	stored := make([]model.APILog, 0, len(logs))
+	for k, i := range recorded {
+		logID := logIDs[i]
+		if existing, ok := skipped[logID]; ok {
+			logID = existing
+			results[i].Replayed = true
+		} else {
+			stored = append(stored, logs[k])
+		}
+		results[i].Accepted = true
+		results[i].LogID = &logID
+	}
+	h.releaseQuota(client.ID, period, len(logs)-len(stored))
+	resolveDuplicates(results, duplicates)
+
+	// Invalidate cache for usage endpoints
+	go h.invalidateUsageCache(ctx, client.ID)
+
+	// Publish updates via Redis Pub/Sub
+	go h.publishLogUpdate(ctx, stored...)
+
+	if len(logs) < len(pending) || len(valid) < len(req.Logs) {
+		return utils.SuccessResponse(c, http.StatusMultiStatus, "Batch partially recorded", batchResponse(results, remaining))
+	}
+
+	return utils.CreatedResponse(c, "Batch recorded successfully", batchResponse(results, remaining))
+}
+
+// routePatterns returns the route template patterns of a client, cached in Redis
+func (h *LogHandler) routePatterns(ctx context.Context, clientID uuid.UUID) []string {
+	cacheKey := routeTemplatesCacheKey(clientID)
+
+	// Try to get from cache
+	if db.IsRedisAvailable(ctx) {
+		var cachedPatterns []string
+		if err := db.CacheGet(ctx, cacheKey, &cachedPatterns); err == nil {
+			return cachedPatterns
+		}
+	}
+
+	// Get from database
+	templates, err := h.routeStore.ListByClient(clientID)
+	if err != nil {
+		log.Printf("Failed to load route templates: %v", err)
+		return nil
+	}
+
+	patterns := make([]string, 0, len(templates))
+	for _, t := range templates {
+		patterns = append(patterns, t.Pattern)
+	}
+
+	// Cache the result
+	if db.IsRedisAvailable(ctx) {
+		_ = db.CacheSet(ctx, cacheKey, patterns, routeTemplatesCacheTTL)
+	}
+
+	return patterns
+}
+
+// claimEventID reserves an event ID for logID. It reports whether the event was
+// already recorded, together with the original log ID. When Redis is not
+// available it falls back to the logs stored in Postgres.
+func (h *LogHandler) claimEventID(ctx context.Context, clientID uuid.UUID, eventID string, logID uuid.UUID) (uuid.UUID, bool, error) {
+	originalID, reserved, err := h.idempotency.Reserve(ctx, clientID, eventID, logID)
+	if err == nil {
+		return originalID, !reserved, nil
+	}
+
+	if !errors.Is(err, utils.ErrIdempotencyUnavailable) {
+		return uuid.Nil, false, err
+	}
+
+	existing, err := h.logStore.FindByEventID(clientID, eventID)
+	if err != nil {
+		if errors.Is(err, store.ErrLogNotFound) {
+			return logID, false, nil
+		}
+		return uuid.Nil, false, err
+	}
+
+	return existing.ID, true, nil
+}
+
+// releaseEventID frees an event ID whose request did not end up recording a log
+func (h *LogHandler) releaseEventID(ctx context.Context, clientID uuid.UUID, eventID string) {
+	if eventID == "" {
+		return
+	}
+
+	if err := h.idempotency.Release(ctx, clientID, eventID); err != nil {
+		log.Printf("Failed to release idempotency key: %v", err)
+	}
+}
+
+// releaseQuota gives back quota charged for hits that were not recorded
+func (h *LogHandler) releaseQuota(clientID uuid.UUID, period *model.QuotaPeriod, n int) {
+	if period == nil {
+		return
+	}
+
+	if err := h.quotaStore.Release(clientID, period.PeriodStart, n); err != nil {
+		log.Printf("Failed to release quota: %v", err)
+	}
+}
+
+// quotaExceededResponse refuses a hit because the hard monthly quota is used up
+func quotaExceededResponse(c echo.Context, period *model.QuotaPeriod) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(quotaRetryAfter(period)))
+
+	return c.JSON(http.StatusTooManyRequests, utils.Response{
+		Success: false,
+		Message: "Monthly quota exceeded",
+		Data: map[string]interface{}{
+			"rule":       "quota",
+			"quota":      period.Quota,
+			"period_end": period.PeriodEnd,
+		},
+	})
+}
+
+// quotaRetryAfter returns the seconds until the next billing period starts
+func quotaRetryAfter(period *model.QuotaPeriod) int {
+	return max(int(math.Ceil(time.Until(period.PeriodEnd).Seconds())), 1)
+}
+
+// replayResponse answers a retried request with the log it originally recorded
+func replayResponse(c echo.Context, logID uuid.UUID) error {
+	c.Response().Header().Set("Idempotent-Replayed", "true")
+
+	return utils.OKResponse(c, "API hit already recorded", map[string]interface{}{
+		"log_id":   logID,
+		"replayed": true,
+	})
+}
+
+// validateBatchEntry validates a single entry of a batch request
+func validateBatchEntry(entry model.BatchLogEntry) error {
+	if err := utils.ValidateIP(entry.IP); err != nil {
+		return err
+	}
+
+	if err := utils.ValidateEndpoint(entry.Endpoint); err != nil {
+		return err
+	}
+
+	if entry.Timestamp != nil {
+		if err := utils.ValidateTimestamp(*entry.Timestamp); err != nil {
+			return err
+		}
+	}
+
+	if entry.EventID != "" {
+		if err := utils.ValidateIdempotencyKey(entry.EventID); err != nil {
+			return err
+		}
+	}
+
+	return validateLogDetails(entry.LogDetails)
+}
+
+// validateLogDetails validates the optional HTTP details of a hit
+func validateLogDetails(details model.LogDetails) error {
+	if details.Method != "" {
+		if err := utils.ValidateHTTPMethod(details.Method); err != nil {
+			return err
+		}
+	}
+
+	if details.StatusCode != 0 {
+		if err := utils.ValidateStatusCode(details.StatusCode); err != nil {
+			return err
+		}
+	}
+
+	if details.RequestBytes < 0 || details.ResponseBytes < 0 {
+		return fmt.Errorf("byte counts must not be negative")
+	}
+
+	if details.DurationMs != nil {
+		if err := utils.ValidateDuration(*details.DurationMs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyLogDetails copies the optional HTTP details of a hit onto a log entry
+func applyLogDetails(apiLog *model.APILog, details model.LogDetails) {
+	apiLog.Method = strings.ToUpper(details.Method)
+	apiLog.StatusCode = details.StatusCode
+	apiLog.RequestBytes = details.RequestBytes
+	apiLog.ResponseBytes = details.ResponseBytes
+	apiLog.UserAgent = utils.TruncateString(utils.SanitizeString(details.UserAgent), 512)
+	apiLog.DurationMs = details.DurationMs
+}
+
+// batchResponse builds the response payload for a batch request
+func batchResponse(results []model.BatchLogResult, remaining int) map[string]interface{} {
+	accepted := 0
+	for _, r := range results {
+		if r.Accepted {
+			accepted++
+		}
+	}
+
+	return map[string]interface{}{
+		"accepted":           accepted,
+		"rejected":           len(results) - accepted,
 		"remaining_requests": remaining,
+		"results":            results,
 	}
+}
 
-	return utils.CreatedResponse(c, "API hit recorded successfully", response)
+// resolveDuplicates gives the entries repeating an event_id of the batch the
+// outcome of its first entry: a replay of the log it recorded, or its rejection
+func resolveDuplicates(results []model.BatchLogResult, duplicates map[int]int) {
+	for i, first := range duplicates {
+		results[i].Accepted = results[first].Accepted
+		results[i].Replayed = results[first].Accepted
+		results[i].LogID = results[first].LogID
+		results[i].Error = results[first].Error
+	}
+}
+
+// onLogsFlushed refreshes caches and notifies subscribers once queued logs are persisted
+func (h *LogHandler) onLogsFlushed(logs []model.APILog) {
+	seen := make(map[uuid.UUID]bool)
+	clientIDs := make([]uuid.UUID, 0)
+	for _, l := range logs {
+		if !seen[l.ClientID] {
+			seen[l.ClientID] = true
+			clientIDs = append(clientIDs, l.ClientID)
+		}
+	}
+
+	ctx := context.Background()
+	h.invalidateUsageCache(ctx, clientIDs)
+	h.publishLogUpdate(ctx, logs...)
+}
+
+// onLogsSkipped gives back the quota of queued hits that were not written
+// because a concurrent request recorded their event ID first, and points their
+// event IDs at the existing logs so retries are answered with those
+func (h *LogHandler) onLogsSkipped(logs []model.APILog, existing map[uuid.UUID]uuid.UUID) {
+	ctx := context.Background()
+	hits := make(map[uuid.UUID][]time.Time)
+	for _, l := range logs {
+		if l.EventID != nil {
+			h.releaseEventID(ctx, l.ClientID, *l.EventID)
+			if _, _, err := h.idempotency.Reserve(ctx, l.ClientID, *l.EventID, existing[l.ID]); err != nil {
+				log.Printf("Failed to record idempotency key of existing log: %v", err)
+			}
+		}
+		hits[l.ClientID] = append(hits[l.ClientID], l.Timestamp)
+	}
+
+	for clientID, at := range hits {
+		if err := h.quotaStore.ReleaseHits(clientID, at); err != nil {
+			log.Printf("Failed to release quota of skipped logs: %v", err)
+		}
+	}
+}
+
+// onLogsDropped gives back what queued hits were charged when their batch could
+// not be written: their event IDs can be recorded again and their quota is
+// released. Rate limit charges cannot be refunded, so they are logged per
+// client instead and show up as failed in the ingest metrics.
+func (h *LogHandler) onLogsDropped(logs []model.APILog) {
+	ctx := context.Background()
+	hits := make(map[uuid.UUID][]time.Time)
+	for _, l := range logs {
+		if l.EventID != nil {
+			h.releaseEventID(ctx, l.ClientID, *l.EventID)
+		}
+		hits[l.ClientID] = append(hits[l.ClientID], l.Timestamp)
+	}
+
+	for clientID, at := range hits {
+		if err := h.quotaStore.ReleaseHits(clientID, at); err != nil {
+			log.Printf("Failed to release quota of dropped logs: %v", err)
+		}
+		log.Warnf("Dropped %d queued logs of client %s, their rate limit charges were not refunded", len(at), clientID)
+	}
 }
 
 // invalidateUsageCache invalidates usage-related cache entries
@@ -115,8 +730,10 @@ func (h *LogHandler) invalidateUsageCache(ctx context.Context, clientID interfac
 		return
 	}
 
-	if err := db.CacheInvalidatePattern(bgCtx, "usage:daily:*"); err != nil {
-		log.Printf("Failed to invalidate daily usage cache: %v", err)
+	for _, pattern := range []string{"usage:daily:*", "usage:endpoints:*", "usage:errors:*", "usage:status:*", "usage:latency:*"} {
+		if err := db.CacheInvalidatePattern(bgCtx, pattern); err != nil {
+			log.Printf("Failed to invalidate %s cache: %v", pattern, err)
+		}
 	}
 
 	if err := db.CacheDelete(bgCtx, "usage:top:24h"); err != nil {
@@ -126,8 +743,8 @@ func (h *LogHandler) invalidateUsageCache(ctx context.Context, clientID interfac
 	log.Printf("Cache invalidated for client: %v", clientID)
 }
 
-// publishLogUpdate publishes a log update to Redis Pub/Sub
-func (h *LogHandler) publishLogUpdate(ctx context.Context, apiLog *model.APILog) {
+// publishLogUpdate publishes log updates to Redis Pub/Sub
+func (h *LogHandler) publishLogUpdate(ctx context.Context, apiLogs ...model.APILog) {
 	// Use background context instead of request context
 	bgCtx := context.Background()
 
@@ -135,13 +752,19 @@ func (h *LogHandler) publishLogUpdate(ctx context.Context, apiLog *model.APILog)
 		return
 	}
 
-	message := map[string]interface{}{
-		"client_id": apiLog.ClientID,
-		"endpoint":  apiLog.Endpoint,
-		"timestamp": apiLog.Timestamp,
-	}
+	for _, apiLog := range apiLogs {
+		message := map[string]interface{}{
+			"client_id":         apiLog.ClientID,
+			"endpoint":          apiLog.Endpoint,
+			"endpoint_template": apiLog.EndpointTemplate,
+			"method":            apiLog.Method,
+			"status_code":       apiLog.StatusCode,
+			"duration_ms":       apiLog.DurationMs,
+			"timestamp":         apiLog.Timestamp,
+		}
 
-	if err := db.PublishMessage(bgCtx, "api_logs:updates", message); err != nil {
-		log.Printf("Failed to publish log update: %v", err)
+		if err := db.PublishMessage(bgCtx, "api_logs:updates", message); err != nil {
+			log.Printf("Failed to publish log update: %v", err)
+		}
 	}
 }
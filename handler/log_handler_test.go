@@ -0,0 +1,280 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nexmedis-golang/db"
+	"nexmedis-golang/model"
+	"nexmedis-golang/store"
+	"nexmedis-golang/utils"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var (
+	testDBOnce sync.Once
+	testDBErr  error
+)
+
+// openTestDB connects db.DB to the Postgres named by TEST_DATABASE_URL and
+// migrates it. Tests use fresh clients, so nothing needs to be cleaned up.
+// Tests are skipped when it is unset; CI runs them against a Postgres service.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	testDBOnce.Do(func() {
+		db.DB, testDBErr = gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if testDBErr == nil {
+			testDBErr = db.AutoMigrate()
+		}
+		if testDBErr == nil {
+			testDBErr = db.SeedPlans(1000)
+		}
+	})
+	if testDBErr != nil {
+		t.Fatalf("failed to open the test database: %v", testDBErr)
+	}
+	return db.DB
+}
+
+// logTest records hits of one client through a LogHandler backed by the test
+// database and an in-memory Redis
+type logTest struct {
+	t       *testing.T
+	handler *LogHandler
+	store   *store.LogStore
+	client  *model.Client
+	apiKey  *model.APIKey
+}
+
+// newLogTest creates a client and a handler that writes synchronously and
+// grants the client limit hits per hour
+func newLogTest(t *testing.T, limit int) *logTest {
+	t.Helper()
+
+	gdb := openTestDB(t)
+
+	mr := miniredis.RunT(t)
+	if err := db.InitRedis(db.RedisConfig{Host: mr.Host(), Port: mr.Port()}); err != nil {
+		t.Fatalf("failed to connect to miniredis: %v", err)
+	}
+	t.Cleanup(func() { _ = db.CloseRedis() })
+
+	clientStore := store.NewClientStore(gdb)
+	client := &model.Client{Name: "Test", Email: uuid.NewString() + "@example.com", HourlyLimitOverride: &limit}
+	if err := clientStore.Create(client); err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	rateLimiter := utils.NewRateLimiter(utils.RateLimiterConfig{Limit: limit})
+	logStore := store.NewLogStore(gdb)
+	h := NewLogHandler(logStore, clientStore, store.NewRouteTemplateStore(gdb), store.NewQuotaStore(gdb), rateLimiter, nil, utils.NewIdempotencyStore(time.Hour))
+
+	return &logTest{
+		t:       t,
+		handler: h,
+		store:   logStore,
+		client:  client,
+		apiKey:  &model.APIKey{ID: uuid.New(), ClientID: client.ID, Scopes: model.JoinScopes(model.AllScopes)},
+	}
+}
+
+// testResponse is the envelope of handler responses
+type testResponse struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// batchData is the data of a batch response
+type batchData struct {
+	Accepted int                    `json:"accepted"`
+	Rejected int                    `json:"rejected"`
+	Results  []model.BatchLogResult `json:"results"`
+}
+
+// post calls a handler as the client with a JSON body and decodes the data
+// of the response into data
+func (lt *logTest) post(h echo.HandlerFunc, body string, header http.Header, data interface{}) int {
+	lt.t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+
+	c := echo.New().NewContext(req, rec)
+	c.Set("api_client", lt.client)
+	c.Set("api_key", lt.apiKey)
+	if err := h(c); err != nil {
+		lt.t.Fatalf("handler error = %v", err)
+	}
+
+	var resp testResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		lt.t.Fatalf("failed to decode response %q: %v", rec.Body.String(), err)
+	}
+	if data != nil && len(resp.Data) > 0 {
+		if err := json.Unmarshal(resp.Data, data); err != nil {
+			lt.t.Fatalf("failed to decode data %s: %v", resp.Data, err)
+		}
+	}
+	return rec.Code
+}
+
+// stored returns the number of logs recorded for the client
+func (lt *logTest) stored() int {
+	lt.t.Helper()
+
+	logs, err := lt.store.ListByClient(lt.client.ID, 0, 1000)
+	if err != nil {
+		lt.t.Fatalf("ListByClient() error = %v", err)
+	}
+	return len(logs)
+}
+
+func TestRecordBatchLogs(t *testing.T) {
+	lt := newLogTest(t, 1000)
+
+	var data batchData
+	code := lt.post(lt.handler.RecordBatchLogs, `{"logs": [
+		{"ip": "203.0.113.7", "endpoint": "/api/v1/users"},
+		{"ip": "not-an-ip", "endpoint": "/api/v1/users"},
+		{"ip": "203.0.113.8", "endpoint": "/api/v1/orders", "status_code": 201}
+	]}`, nil, &data)
+
+	if code != http.StatusMultiStatus {
+		t.Errorf("status = %d, want 207", code)
+	}
+	if data.Accepted != 2 || data.Rejected != 1 {
+		t.Errorf("accepted %d and rejected %d, want 2 and 1", data.Accepted, data.Rejected)
+	}
+	if !data.Results[0].Accepted || data.Results[1].Accepted || data.Results[1].Error == "" || !data.Results[2].Accepted {
+		t.Errorf("results = %+v, want only the entry with the invalid IP rejected", data.Results)
+	}
+	if got := lt.stored(); got != 2 {
+		t.Errorf("stored %d logs, want 2", got)
+	}
+}
+
+func TestRecordBatchLogsRejectsEntriesOverLimit(t *testing.T) {
+	lt := newLogTest(t, 2)
+
+	var data batchData
+	code := lt.post(lt.handler.RecordBatchLogs, `{"logs": [
+		{"ip": "203.0.113.7", "endpoint": "/a"},
+		{"ip": "203.0.113.7", "endpoint": "/b"},
+		{"ip": "203.0.113.7", "endpoint": "/c"}
+	]}`, nil, &data)
+
+	if code != http.StatusMultiStatus || data.Accepted != 2 {
+		t.Errorf("status %d with %d accepted, want 207 with the 2 that fit the limit", code, data.Accepted)
+	}
+	if data.Results[2].Accepted || !strings.Contains(data.Results[2].Error, "rate limit exceeded") {
+		t.Errorf("last result = %+v, want it rejected by the rate limit", data.Results[2])
+	}
+	if got := lt.stored(); got != 2 {
+		t.Errorf("stored %d logs, want 2", got)
+	}
+}
+
+func TestRecordBatchLogsEmpty(t *testing.T) {
+	lt := newLogTest(t, 1000)
+
+	if code := lt.post(lt.handler.RecordBatchLogs, `{"logs": []}`, nil, nil); code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", code)
+	}
+}
+
+func TestRecordLogIdempotencyKey(t *testing.T) {
+	lt := newLogTest(t, 1000)
+	header := http.Header{"Idempotency-Key": []string{"evt-" + uuid.NewString()}}
+
+	var first, retry struct {
+		LogID    uuid.UUID `json:"log_id"`
+		Replayed bool      `json:"replayed"`
+	}
+	if code := lt.post(lt.handler.RecordLog, `{"ip": "203.0.113.7", "endpoint": "/api/v1/users"}`, header, &first); code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201", code)
+	}
+	if code := lt.post(lt.handler.RecordLog, `{"ip": "203.0.113.7", "endpoint": "/api/v1/users"}`, header, &retry); code != http.StatusOK {
+		t.Errorf("retry status = %d, want 200", code)
+	}
+
+	if !retry.Replayed || retry.LogID != first.LogID {
+		t.Errorf("retry = %+v, want the original log %s replayed", retry, first.LogID)
+	}
+	if got := lt.stored(); got != 1 {
+		t.Errorf("stored %d logs, want 1", got)
+	}
+}
+
+func TestRecordLogInvalidIdempotencyKey(t *testing.T) {
+	lt := newLogTest(t, 1000)
+	header := http.Header{"Idempotency-Key": []string{strings.Repeat("k", 256)}}
+
+	if code := lt.post(lt.handler.RecordLog, `{"ip": "203.0.113.7", "endpoint": "/api/v1/users"}`, header, nil); code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", code)
+	}
+}
+
+func TestRecordBatchLogsEventIDs(t *testing.T) {
+	lt := newLogTest(t, 1000)
+	body := `{"logs": [
+		{"ip": "203.0.113.7", "endpoint": "/a", "event_id": "evt-a"},
+		{"ip": "203.0.113.7", "endpoint": "/a", "event_id": "evt-a"},
+		{"ip": "203.0.113.7", "endpoint": "/b", "event_id": "` + strings.Repeat("k", 256) + `"},
+		{"ip": "203.0.113.7", "endpoint": "/c", "event_id": "evt-c"}
+	]}`
+
+	var data batchData
+	if code := lt.post(lt.handler.RecordBatchLogs, body, nil, &data); code != http.StatusMultiStatus {
+		t.Errorf("status = %d, want 207", code)
+	}
+
+	// Repeats within the batch share the outcome of their first entry, and an
+	// invalid event ID only rejects its own entry
+	results := data.Results
+	if !results[0].Accepted || !results[1].Accepted || *results[1].LogID != *results[0].LogID {
+		t.Errorf("results = %+v, want the repeat of evt-a sharing its log", results)
+	}
+	if results[2].Accepted || results[2].Error == "" || !results[3].Accepted {
+		t.Errorf("results = %+v, want only the invalid event ID rejected", results)
+	}
+	if got := lt.stored(); got != 2 {
+		t.Errorf("stored %d logs, want 2", got)
+	}
+
+	// A retry of the whole batch is answered from the recorded events
+	var retry batchData
+	if code := lt.post(lt.handler.RecordBatchLogs, body, nil, &retry); code != http.StatusOK {
+		t.Errorf("retry status = %d, want 200", code)
+	}
+	for _, i := range []int{0, 1, 3} {
+		if !retry.Results[i].Replayed || *retry.Results[i].LogID != *results[i].LogID {
+			t.Errorf("retried result %d = %+v, want the original log replayed", i, retry.Results[i])
+		}
+	}
+	if got := lt.stored(); got != 2 {
+		t.Errorf("stored %d logs after the retry, want 2", got)
+	}
+}
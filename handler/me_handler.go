@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"fmt"
+	"nexmedis-golang/db"
+	"nexmedis-golang/model"
+	"nexmedis-golang/store"
+	"nexmedis-golang/utils"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MeHandler serves the usage of the authenticated client only. The client is
+// always taken from the access token, so per-customer dashboards never need
+// the global usage endpoints.
+type MeHandler struct {
+	logStore   *store.LogStore
+	quotaStore *store.QuotaStore
+	cacheTTL   time.Duration
+}
+
+// NewMeHandler creates a new MeHandler
+func NewMeHandler(logStore *store.LogStore, quotaStore *store.QuotaStore, cacheTTL time.Duration) *MeHandler {
+	return &MeHandler{
+		logStore:   logStore,
+		quotaStore: quotaStore,
+		cacheTTL:   cacheTTL,
+	}
+}
+
+// GetDailyUsage returns the daily usage of the authenticated client
+//
+//	@Summary		Get my daily usage
+//	@Description	Retrieve the daily API usage of the authenticated client for the last N days. Results are cached.
+//	@Tags			My Usage
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			days	query		int	false	"Number of days to include (1-90, default 7)"
+//	@Success		200		{object}	object{success=bool,message=string,data=[]model.DailyUsage}	"Daily usage retrieved successfully"
+//	@Failure		400		{object}	object{success=bool,message=string,error=string}	"Invalid query parameters"
+//	@Failure		401		{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		500		{object}	object{success=bool,message=string,error=string}	"Failed to get daily usage"
+//	@Router			/api/me/usage/daily [get]
+func (h *MeHandler) GetDailyUsage(c echo.Context) error {
+	clientID, ok := clientIDFromContext(c)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Client not found in context")
+	}
+
+	days, err := parseDays(c.QueryParam("days"))
+	if err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+
+	ctx := c.Request().Context()
+	cacheKey := fmt.Sprintf("usage:daily:client:%s:%ddays", clientID, days)
+
+	// Try to get from cache
+	if db.IsRedisAvailable(ctx) {
+		var cachedData []model.DailyUsage
+		if err := db.CacheGet(ctx, cacheKey, &cachedData); err == nil {
+			return utils.OKResponse(c, "Daily usage retrieved from cache", cachedData)
+		}
+	}
+
+	// Get from database
+	usage, err := h.logStore.GetDailyUsageByClient(clientID, days)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to get daily usage", err.Error())
+	}
+
+	// Cache the result
+	if db.IsRedisAvailable(ctx) {
+		_ = db.CacheSet(ctx, cacheKey, usage, h.cacheTTL)
+	}
+
+	return utils.OKResponse(c, "Daily usage retrieved successfully", usage)
+}
+
+// GetEndpointUsage returns the request counts of the authenticated client by route template
+//
+//	@Summary		Get my endpoint usage
+//	@Description	Retrieve the API request counts of the authenticated client grouped by normalized route template for the last N days. Use group_by=endpoint to group by the raw endpoint instead.
+//	@Tags			My Usage
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			days		query		int		false	"Number of days to include (1-90, default 7)"
+//	@Param			group_by	query		string	false	"template (default) or endpoint"
+//	@Success		200			{object}	object{success=bool,message=string,data=[]model.EndpointUsage}	"Endpoint usage retrieved successfully"
+//	@Failure		400			{object}	object{success=bool,message=string,error=string}	"Invalid query parameters"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		500			{object}	object{success=bool,message=string,error=string}	"Failed to get endpoint usage"
+//	@Router			/api/me/usage/endpoints [get]
+func (h *MeHandler) GetEndpointUsage(c echo.Context) error {
+	clientID, ok := clientIDFromContext(c)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Client not found in context")
+	}
+
+	days, err := parseDays(c.QueryParam("days"))
+	if err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+
+	groupBy := c.QueryParam("group_by")
+	if groupBy == "" {
+		groupBy = "template"
+	}
+	if groupBy != "template" && groupBy != "endpoint" {
+		return utils.BadRequestResponse(c, "group_by must be 'template' or 'endpoint'")
+	}
+
+	ctx := c.Request().Context()
+	cacheKey := fmt.Sprintf("usage:endpoints:client:%s:%s:%ddays", clientID, groupBy, days)
+
+	// Try to get from cache
+	if db.IsRedisAvailable(ctx) {
+		var cachedData []model.EndpointUsage
+		if err := db.CacheGet(ctx, cacheKey, &cachedData); err == nil {
+			return utils.OKResponse(c, "Endpoint usage retrieved from cache", cachedData)
+		}
+	}
+
+	// Get from database
+	end := time.Now().UTC()
+	start := end.AddDate(0, 0, -days)
+	usage, err := h.logStore.GetEndpointUsage(&clientID, start, end, groupBy == "template", 100)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to get endpoint usage", err.Error())
+	}
+
+	// Cache the result (shorter TTL, the window slides with time)
+	if db.IsRedisAvailable(ctx) {
+		_ = db.CacheSet(ctx, cacheKey, usage, 5*time.Minute)
+	}
+
+	return utils.OKResponse(c, "Endpoint usage retrieved successfully", usage)
+}
+
+// GetQuota returns the quota consumption of the authenticated client
+//
+//	@Summary		Get my quota consumption
+//	@Description	Retrieve the hits recorded in the current billing period of the authenticated client against the monthly quota of its plan. Hits are counted in Redis and persisted to Postgres every few seconds.
+//	@Tags			My Usage
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	object{success=bool,message=string,data=model.QuotaUsage}	"Quota retrieved successfully"
+//	@Failure		401	{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		500	{object}	object{success=bool,message=string,error=string}	"Failed to get quota"
+//	@Router			/api/me/quota [get]
+func (h *MeHandler) GetQuota(c echo.Context) error {
+	clientID, ok := clientIDFromContext(c)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Client not found in context")
+	}
+
+	period, err := h.quotaStore.Current(clientID, time.Now().UTC())
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to get quota", err.Error())
+	}
+
+	return utils.OKResponse(c, "Quota retrieved successfully", period.ToUsage())
+}
+
+// ListLogs returns the recorded API hits of the authenticated client
+//
+//	@Summary		List my API logs
+//	@Description	List the API hits recorded for the authenticated client, newest first
+//	@Tags			My Usage
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			limit	query		int	false	"Number of entries (1-500, default 100)"
+//	@Param			offset	query		int	false	"Number of entries to skip (default 0)"
+//	@Success		200		{object}	object{success=bool,message=string,data=[]model.APILog}	"Logs retrieved successfully"
+//	@Failure		400		{object}	object{success=bool,message=string,error=string}	"Invalid query parameters"
+//	@Failure		401		{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		500		{object}	object{success=bool,message=string,error=string}	"Failed to list logs"
+//	@Router			/api/me/logs [get]
+func (h *MeHandler) ListLogs(c echo.Context) error {
+	clientID, ok := clientIDFromContext(c)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Client not found in context")
+	}
+
+	limit := 100
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			return utils.BadRequestResponse(c, "limit must be a number between 1 and 500")
+		}
+		limit = parsed
+	}
+
+	offset := 0
+	if value := c.QueryParam("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return utils.BadRequestResponse(c, "offset must be a non-negative number")
+		}
+		offset = parsed
+	}
+
+	logs, err := h.logStore.ListByClient(clientID, offset, limit)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to list logs", err.Error())
+	}
+
+	return utils.OKResponse(c, "Logs retrieved successfully", logs)
+}
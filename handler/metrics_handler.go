@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"nexmedis-golang/store"
+	"nexmedis-golang/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MetricsHandler handles internal service metrics requests
+type MetricsHandler struct {
+	logQueue *store.LogQueue
+}
+
+// NewMetricsHandler creates a new MetricsHandler
+func NewMetricsHandler(logQueue *store.LogQueue) *MetricsHandler {
+	return &MetricsHandler{
+		logQueue: logQueue,
+	}
+}
+
+// GetIngestMetrics returns metrics of the asynchronous log write pipeline
+//
+//	@Summary		Get ingestion pipeline metrics
+//	@Description	Retrieve queue depth, throughput and flush latency of the asynchronous log write pipeline
+//	@Tags			Metrics
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Security		AdminToken
+//	@Success		200	{object}	object{success=bool,message=string,data=store.LogQueueStats}	"Ingestion metrics retrieved successfully"
+//	@Failure		401	{object}	object{success=bool,message=string,error=string}	"Unauthorized - admin access token or admin token required"
+//	@Failure		403	{object}	object{success=bool,message=string,error=string}	"Forbidden - the client is not an admin"
+//	@Failure		503	{object}	object{success=bool,message=string,error=string}	"Asynchronous ingestion is disabled"
+//	@Router			/metrics/ingest [get]
+func (h *MetricsHandler) GetIngestMetrics(c echo.Context) error {
+	if h.logQueue == nil {
+		return utils.ServiceUnavailableResponse(c, "Asynchronous ingestion is disabled")
+	}
+
+	return utils.OKResponse(c, "Ingestion metrics retrieved successfully", h.logQueue.Stats())
+}
@@ -0,0 +1,394 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"nexmedis-golang/model"
+	"nexmedis-golang/store"
+	"nexmedis-golang/utils"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// OAuthHandler implements the OAuth 2.0 client credentials grant (RFC 6749)
+// with token introspection (RFC 7662) and revocation (RFC 7009). The client
+// secret is one of the client's API keys.
+type OAuthHandler struct {
+	clientStore  *store.ClientStore
+	apiKeyStore  *store.APIKeyStore
+	refreshStore *store.RefreshTokenStore
+	loginGuard   *utils.LoginGuard
+}
+
+// NewOAuthHandler creates a new OAuthHandler. loginGuard is shared with
+// /api/login, so failed attempts on either endpoint count towards the same
+// lockouts.
+func NewOAuthHandler(clientStore *store.ClientStore, apiKeyStore *store.APIKeyStore, refreshStore *store.RefreshTokenStore, loginGuard *utils.LoginGuard) *OAuthHandler {
+	return &OAuthHandler{
+		clientStore:  clientStore,
+		apiKeyStore:  apiKeyStore,
+		refreshStore: refreshStore,
+		loginGuard:   loginGuard,
+	}
+}
+
+// oauthError is an error response of the OAuth endpoints
+type oauthError struct {
+	status      int
+	code        string
+	description string
+	retryAfter  time.Duration
+}
+
+// Token issues an access token with the client credentials grant
+//
+//	@Summary		OAuth 2.0 token endpoint
+//	@Description	Issue an access token with the client_credentials grant (RFC 6749 section 4.4). Authenticate with HTTP Basic authentication or with client_id and client_secret form parameters, where the secret is an API key of the client. scope may narrow the scopes of the key and defaults to all of them. The token is the same JWT as from /api/login; no refresh token is issued. Failed attempts share the lockouts of /api/login.
+//	@Tags			OAuth
+//	@Accept			x-www-form-urlencoded
+//	@Produce		json
+//	@Security		ClientBasicAuth
+//	@Param			grant_type		formData	string	true	"client_credentials"
+//	@Param			scope			formData	string	false	"Space-separated scopes to request"
+//	@Param			client_id		formData	string	false	"Client ID, when not using Basic authentication"
+//	@Param			client_secret	formData	string	false	"API key, when not using Basic authentication"
+//	@Success		200				{object}	model.OAuthTokenResponse	"Access token"
+//	@Failure		400				{object}	model.OAuthErrorResponse	"invalid_request, unauthorized_client, unsupported_grant_type or invalid_scope"
+//	@Failure		401				{object}	model.OAuthErrorResponse	"invalid_client"
+//	@Failure		429				{object}	model.OAuthErrorResponse	"Too many failed attempts, retry after the Retry-After header"
+//	@Failure		500				{object}	model.OAuthErrorResponse	"server_error"
+//	@Router			/oauth/token [post]
+func (h *OAuthHandler) Token(c echo.Context) error {
+	key, oerr := h.authenticateClient(c)
+	if oerr != nil {
+		return oauthErrorResponse(c, oerr)
+	}
+
+	switch c.FormValue("grant_type") {
+	case "client_credentials":
+	case "":
+		return oauthErrorResponse(c, &oauthError{status: http.StatusBadRequest, code: model.OAuthInvalidRequest, description: "grant_type is required"})
+	default:
+		return oauthErrorResponse(c, &oauthError{status: http.StatusBadRequest, code: model.OAuthUnsupportedGrantType, description: "Only the client_credentials grant is supported"})
+	}
+
+	// The token never grants more than the key
+	scopes := key.ScopeList()
+	if requested := model.SplitScopes(c.FormValue("scope")); len(requested) > 0 {
+		parsed, err := model.ParseScopes(requested)
+		if err != nil {
+			return oauthErrorResponse(c, &oauthError{status: http.StatusBadRequest, code: model.OAuthInvalidScope, description: err.Error()})
+		}
+		if !model.HasScopes(scopes, parsed...) {
+			return oauthErrorResponse(c, &oauthError{status: http.StatusBadRequest, code: model.OAuthInvalidScope, description: "Requested scopes exceed the scopes of the client secret"})
+		}
+		scopes = parsed
+	}
+
+	client := key.Client
+	token, expiresAt, err := utils.GenerateJWT(client.ID, client.Email, client.Role, scopes)
+	if err != nil {
+		log.Errorf("Failed to generate OAuth access token: %v", err)
+		return oauthErrorResponse(c, &oauthError{status: http.StatusInternalServerError, code: model.OAuthServerError, description: "Failed to generate token"})
+	}
+
+	noStore(c)
+	return c.JSON(http.StatusOK, model.OAuthTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(time.Until(expiresAt).Seconds()),
+		Scope:       model.JoinScopes(scopes),
+	})
+}
+
+// Introspect reports whether a token is active
+//
+//	@Summary		OAuth 2.0 token introspection
+//	@Description	Describe an access or refresh token (RFC 7662). Requires the same client authentication as /oauth/token. Tokens that are invalid, expired, revoked or issued to another client are reported as inactive; admins can introspect the tokens of any client.
+//	@Tags			OAuth
+//	@Accept			x-www-form-urlencoded
+//	@Produce		json
+//	@Security		ClientBasicAuth
+//	@Param			token			formData	string	true	"Token to introspect"
+//	@Param			token_type_hint	formData	string	false	"access_token or refresh_token"
+//	@Success		200				{object}	model.IntrospectionResponse	"Token state"
+//	@Failure		400				{object}	model.OAuthErrorResponse	"invalid_request or unauthorized_client"
+//	@Failure		401				{object}	model.OAuthErrorResponse	"invalid_client"
+//	@Failure		429				{object}	model.OAuthErrorResponse	"Too many failed attempts, retry after the Retry-After header"
+//	@Failure		500				{object}	model.OAuthErrorResponse	"server_error"
+//	@Router			/oauth/introspect [post]
+func (h *OAuthHandler) Introspect(c echo.Context) error {
+	key, oerr := h.authenticateClient(c)
+	if oerr != nil {
+		return oauthErrorResponse(c, oerr)
+	}
+
+	token := c.FormValue("token")
+	if token == "" {
+		return oauthErrorResponse(c, &oauthError{status: http.StatusBadRequest, code: model.OAuthInvalidRequest, description: "token is required"})
+	}
+
+	// Try the hinted token type first, then the other one
+	lookups := []func(context.Context, *model.APIKey, string) (*model.IntrospectionResponse, error){h.introspectAccessToken, h.introspectRefreshToken}
+	if c.FormValue("token_type_hint") == "refresh_token" {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	noStore(c)
+	for _, lookup := range lookups {
+		response, err := lookup(c.Request().Context(), key, token)
+		if err != nil {
+			log.Errorf("Failed to introspect token: %v", err)
+			return oauthErrorResponse(c, &oauthError{status: http.StatusInternalServerError, code: model.OAuthServerError, description: "Failed to introspect token"})
+		}
+		if response != nil {
+			return c.JSON(http.StatusOK, response)
+		}
+	}
+
+	return c.JSON(http.StatusOK, model.IntrospectionResponse{Active: false})
+}
+
+// Revoke revokes an access or refresh token
+//
+//	@Summary		OAuth 2.0 token revocation
+//	@Description	Revoke an access or refresh token of the authenticated client (RFC 7009). Revoking a refresh token revokes every refresh token descended from the same login. Unknown tokens and tokens of other clients are ignored, so the response is 200 either way.
+//	@Tags			OAuth
+//	@Accept			x-www-form-urlencoded
+//	@Produce		json
+//	@Security		ClientBasicAuth
+//	@Param			token			formData	string	true	"Token to revoke"
+//	@Param			token_type_hint	formData	string	false	"access_token or refresh_token"
+//	@Success		200				"Token revoked or unknown"
+//	@Failure		400				{object}	model.OAuthErrorResponse	"invalid_request or unauthorized_client"
+//	@Failure		401				{object}	model.OAuthErrorResponse	"invalid_client"
+//	@Failure		429				{object}	model.OAuthErrorResponse	"Too many failed attempts, retry after the Retry-After header"
+//	@Failure		500				{object}	model.OAuthErrorResponse	"server_error"
+//	@Failure		503				{object}	model.OAuthErrorResponse	"temporarily_unavailable"
+//	@Router			/oauth/revoke [post]
+func (h *OAuthHandler) Revoke(c echo.Context) error {
+	key, oerr := h.authenticateClient(c)
+	if oerr != nil {
+		return oauthErrorResponse(c, oerr)
+	}
+
+	token := c.FormValue("token")
+	if token == "" {
+		return oauthErrorResponse(c, &oauthError{status: http.StatusBadRequest, code: model.OAuthInvalidRequest, description: "token is required"})
+	}
+
+	// Access tokens are JWTs and cannot be mistaken for refresh tokens, so
+	// the hint is not needed to find the token
+	if claims, err := utils.ValidateJWT(token); err == nil {
+		if claims.ClientID != key.ClientID {
+			return c.NoContent(http.StatusOK)
+		}
+
+		// Tokens issued before jti was added can only be revoked all at once
+		revoke := utils.RevokeToken(c.Request().Context(), claims)
+		if claims.ID == "" {
+			revoke = utils.RevokeClientTokens(c.Request().Context(), claims.ClientID)
+		}
+		if revoke != nil {
+			if errors.Is(revoke, utils.ErrDenylistUnavailable) {
+				return oauthErrorResponse(c, &oauthError{status: http.StatusServiceUnavailable, code: model.OAuthTemporarilyUnavailable, description: "Token revocation is temporarily unavailable", retryAfter: time.Minute})
+			}
+			log.Errorf("Failed to revoke access token: %v", revoke)
+			return oauthErrorResponse(c, &oauthError{status: http.StatusInternalServerError, code: model.OAuthServerError, description: "Failed to revoke token"})
+		}
+		return c.NoContent(http.StatusOK)
+	}
+
+	record, err := h.refreshStore.Find(token)
+	if err != nil {
+		if errors.Is(err, store.ErrRefreshTokenInvalid) {
+			return c.NoContent(http.StatusOK)
+		}
+		log.Errorf("Failed to look up refresh token: %v", err)
+		return oauthErrorResponse(c, &oauthError{status: http.StatusInternalServerError, code: model.OAuthServerError, description: "Failed to revoke token"})
+	}
+
+	if record.ClientID == key.ClientID {
+		if err := h.refreshStore.RevokeFamily(token); err != nil {
+			log.Errorf("Failed to revoke refresh token: %v", err)
+			return oauthErrorResponse(c, &oauthError{status: http.StatusInternalServerError, code: model.OAuthServerError, description: "Failed to revoke token"})
+		}
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// authenticateClient resolves the client credentials of an OAuth request,
+// sent with HTTP Basic authentication or as client_id and client_secret form
+// parameters, to the API key used as the secret. Failures count towards the
+// login lockouts.
+func (h *OAuthHandler) authenticateClient(c echo.Context) (*model.APIKey, *oauthError) {
+	clientID, secret, basic := c.Request().BasicAuth()
+	formID, formSecret := c.FormValue("client_id"), c.FormValue("client_secret")
+
+	switch {
+	case basic && (formID != "" || formSecret != ""):
+		return nil, &oauthError{status: http.StatusBadRequest, code: model.OAuthInvalidRequest, description: "Use only one client authentication method"}
+	case basic:
+		// Credentials are form-encoded before they are put in the header (RFC 6749 section 2.3.1)
+		var errID, errSecret error
+		clientID, errID = url.QueryUnescape(clientID)
+		secret, errSecret = url.QueryUnescape(secret)
+		if errID != nil || errSecret != nil {
+			return nil, &oauthError{status: http.StatusBadRequest, code: model.OAuthInvalidRequest, description: "Malformed client credentials"}
+		}
+	default:
+		clientID, secret = formID, formSecret
+	}
+
+	if clientID == "" || secret == "" {
+		return nil, &oauthError{status: http.StatusUnauthorized, code: model.OAuthInvalidClient, description: "Client authentication required"}
+	}
+	if err := utils.ValidateAPIKey(secret); err != nil {
+		return nil, &oauthError{status: http.StatusUnauthorized, code: model.OAuthInvalidClient, description: "Invalid client credentials"}
+	}
+
+	// Refuse locked out source IPs; key prefix lockouts only apply to failures
+	ctx := c.Request().Context()
+	ip := c.RealIP()
+	keySubject := utils.GuardSubject{Kind: "key", Value: utils.APIKeyPrefix(secret), BackoffOnly: true}
+	subjects := []utils.GuardSubject{{Kind: "ip", Value: ip}, keySubject}
+	if locked := h.loginGuard.Check(ctx, subjects...); locked > 0 {
+		return nil, lockedOutError(locked)
+	}
+
+	key, err := h.apiKeyStore.Authenticate(secret)
+	if errors.Is(err, store.ErrClientUnverified) {
+		return nil, &oauthError{status: http.StatusBadRequest, code: model.OAuthUnauthorizedClient, description: "Email address not verified"}
+	}
+	if err != nil || key.Client.ClientID != clientID {
+		if locked := h.loginGuard.Record(ctx, ip, subjects...); locked > 0 {
+			return nil, lockedOutError(locked)
+		}
+		return nil, &oauthError{status: http.StatusUnauthorized, code: model.OAuthInvalidClient, description: "Invalid client credentials"}
+	}
+
+	// The source IP keeps its count, so a valid key cannot be used to reset it
+	h.loginGuard.Reset(ctx, keySubject)
+
+	return key, nil
+}
+
+// introspectAccessToken describes an access token, or returns nil when token
+// is not an active access token that the caller may see
+func (h *OAuthHandler) introspectAccessToken(ctx context.Context, caller *model.APIKey, token string) (*model.IntrospectionResponse, error) {
+	claims, err := utils.ValidateJWT(token)
+	if err != nil {
+		return nil, nil
+	}
+	if claims.ClientID != caller.ClientID && caller.Client.Role != model.RoleAdmin {
+		return nil, nil
+	}
+
+	// Like JWTMiddleware, accept tokens when the denylist cannot be consulted
+	revoked, err := utils.IsTokenRevoked(ctx, claims)
+	if err != nil {
+		log.Warnf("Failed to check token revocation: %v", err)
+	}
+	if revoked {
+		return nil, nil
+	}
+
+	owner, err := h.clientStore.FindByID(claims.ClientID)
+	if err != nil {
+		return nil, nil
+	}
+
+	response := &model.IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  owner.ClientID,
+		TokenType: "Bearer",
+		Sub:       claims.ClientID.String(),
+		Jti:       claims.ID,
+		Role:      claims.RoleName(),
+	}
+	if claims.ExpiresAt != nil {
+		response.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		response.Iat = claims.IssuedAt.Unix()
+	}
+	if claims.NotBefore != nil {
+		response.Nbf = claims.NotBefore.Unix()
+	}
+	return response, nil
+}
+
+// introspectRefreshToken describes a refresh token, or returns nil when token
+// is not an active refresh token that the caller may see
+func (h *OAuthHandler) introspectRefreshToken(_ context.Context, caller *model.APIKey, token string) (*model.IntrospectionResponse, error) {
+	record, err := h.refreshStore.Find(token)
+	if err != nil {
+		if errors.Is(err, store.ErrRefreshTokenInvalid) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !record.ActiveAt(time.Now()) {
+		return nil, nil
+	}
+	if record.ClientID != caller.ClientID && caller.Client.Role != model.RoleAdmin {
+		return nil, nil
+	}
+
+	owner, err := h.clientStore.FindByID(record.ClientID)
+	if err != nil {
+		return nil, nil
+	}
+
+	return &model.IntrospectionResponse{
+		Active:    true,
+		Scope:     record.Scopes,
+		ClientID:  owner.ClientID,
+		TokenType: "refresh_token",
+		Exp:       record.ExpiresAt.Unix(),
+		Iat:       record.CreatedAt.Unix(),
+		Sub:       record.ClientID.String(),
+		Role:      owner.Role,
+	}, nil
+}
+
+// oauthErrorResponse writes an OAuth error response (RFC 6749 section 5.2)
+func oauthErrorResponse(c echo.Context, oerr *oauthError) error {
+	header := c.Response().Header()
+	if oerr.status == http.StatusUnauthorized {
+		header.Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	if oerr.retryAfter > 0 {
+		header.Set("Retry-After", strconv.Itoa(max(int(math.Ceil(oerr.retryAfter.Seconds())), 1)))
+	}
+	noStore(c)
+
+	return c.JSON(oerr.status, model.OAuthErrorResponse{
+		Error:            oerr.code,
+		ErrorDescription: oerr.description,
+	})
+}
+
+// lockedOutError refuses client authentication from a locked out source IP or key
+func lockedOutError(locked time.Duration) *oauthError {
+	return &oauthError{
+		status:      http.StatusTooManyRequests,
+		code:        model.OAuthInvalidClient,
+		description: "Too many failed attempts, try again later",
+		retryAfter:  locked,
+	}
+}
+
+// noStore keeps token responses out of caches (RFC 6749 section 5.1)
+func noStore(c echo.Context) {
+	c.Response().Header().Set("Cache-Control", "no-store")
+	c.Response().Header().Set("Pragma", "no-cache")
+}
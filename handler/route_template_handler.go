@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"fmt"
+	"nexmedis-golang/db"
+	"nexmedis-golang/model"
+	"nexmedis-golang/store"
+	"nexmedis-golang/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// routeTemplatesCacheTTL is how long a client's route templates are cached for ingestion
+const routeTemplatesCacheTTL = 5 * time.Minute
+
+// maxRouteTemplates is the number of route templates a client can have, which
+// bounds the templates tried for every logged endpoint
+const maxRouteTemplates = 100
+
+// RouteTemplateHandler handles route template requests
+type RouteTemplateHandler struct {
+	routeStore *store.RouteTemplateStore
+}
+
+// NewRouteTemplateHandler creates a new RouteTemplateHandler
+func NewRouteTemplateHandler(routeStore *store.RouteTemplateStore) *RouteTemplateHandler {
+	return &RouteTemplateHandler{
+		routeStore: routeStore,
+	}
+}
+
+// ListTemplates returns the route templates of the authenticated client
+//
+//	@Summary		List route templates
+//	@Description	List the route template rules used to normalize the endpoints of the authenticated client's logs
+//	@Tags			Routes
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	object{success=bool,message=string,data=[]model.RouteTemplate}	"Route templates retrieved successfully"
+//	@Failure		401	{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		403	{object}	object{success=bool,message=string,error=string}	"Token lacks the usage:read scope"
+//	@Failure		500	{object}	object{success=bool,message=string,error=string}	"Failed to list route templates"
+//	@Router			/api/routes [get]
+func (h *RouteTemplateHandler) ListTemplates(c echo.Context) error {
+	clientID, ok := clientIDFromContext(c)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Client not found in context")
+	}
+
+	templates, err := h.routeStore.ListByClient(clientID)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to list route templates", err.Error())
+	}
+
+	return utils.OKResponse(c, "Route templates retrieved successfully", templates)
+}
+
+// CreateTemplate adds a route template for the authenticated client
+//
+//	@Summary		Create route template
+//	@Description	Add a route template rule such as /api/v1/users/:id. Logged endpoints matching the rule are grouped under the template; ":name" matches one path segment and a trailing "*" matches the rest of the path. A client can have up to 100 route templates.
+//	@Tags			Routes
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			request	body		model.RouteTemplateRequest	true	"Route template"
+//	@Success		201		{object}	object{success=bool,message=string,data=model.RouteTemplate}	"Route template created successfully"
+//	@Failure		400		{object}	object{success=bool,message=string,error=string}	"Invalid pattern or route template limit reached"
+//	@Failure		401		{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		403		{object}	object{success=bool,message=string,error=string}	"Read-only analysts cannot change route templates"
+//	@Failure		409		{object}	object{success=bool,message=string,error=string}	"Route template already exists"
+//	@Failure		500		{object}	object{success=bool,message=string,error=string}	"Failed to create route template"
+//	@Router			/api/routes [post]
+func (h *RouteTemplateHandler) CreateTemplate(c echo.Context) error {
+	clientID, ok := clientIDFromContext(c)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Client not found in context")
+	}
+
+	var req model.RouteTemplateRequest
+	if err := c.Bind(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body")
+	}
+
+	pattern := utils.SanitizeString(req.Pattern)
+	if err := utils.ValidateRoutePattern(pattern); err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+
+	exists, err := h.routeStore.ExistsByPattern(clientID, pattern)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to check route template", err.Error())
+	}
+	if exists {
+		return utils.ConflictResponse(c, "Route template already exists")
+	}
+
+	count, err := h.routeStore.CountByClient(clientID)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to count route templates", err.Error())
+	}
+	if count >= maxRouteTemplates {
+		return utils.BadRequestResponse(c, fmt.Sprintf("A client can have at most %d route templates", maxRouteTemplates))
+	}
+
+	template := &model.RouteTemplate{
+		ClientID: clientID,
+		Pattern:  pattern,
+	}
+
+	if err := h.routeStore.Create(template); err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to create route template", err.Error())
+	}
+
+	h.invalidateTemplatesCache(c, clientID)
+
+	return utils.CreatedResponse(c, "Route template created successfully", template)
+}
+
+// DeleteTemplate removes a route template of the authenticated client
+//
+//	@Summary		Delete route template
+//	@Description	Remove a route template rule. Logs already recorded keep their template.
+//	@Tags			Routes
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			id	path		string	true	"Route template ID"
+//	@Success		200	{object}	object{success=bool,message=string}	"Route template deleted successfully"
+//	@Failure		400	{object}	object{success=bool,message=string,error=string}	"Invalid route template ID"
+//	@Failure		401	{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		403	{object}	object{success=bool,message=string,error=string}	"Read-only analysts cannot change route templates"
+//	@Failure		404	{object}	object{success=bool,message=string,error=string}	"Route template not found"
+//	@Router			/api/routes/{id} [delete]
+func (h *RouteTemplateHandler) DeleteTemplate(c echo.Context) error {
+	clientID, ok := clientIDFromContext(c)
+	if !ok {
+		return utils.UnauthorizedResponse(c, "Client not found in context")
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return utils.BadRequestResponse(c, "Invalid route template ID")
+	}
+
+	if err := h.routeStore.Delete(clientID, id); err != nil {
+		return utils.NotFoundResponse(c, "Route template not found")
+	}
+
+	h.invalidateTemplatesCache(c, clientID)
+
+	return utils.OKResponse(c, "Route template deleted successfully", nil)
+}
+
+// invalidateTemplatesCache drops the cached route templates of a client
+func (h *RouteTemplateHandler) invalidateTemplatesCache(c echo.Context, clientID uuid.UUID) {
+	ctx := c.Request().Context()
+	if db.IsRedisAvailable(ctx) {
+		_ = db.CacheDelete(ctx, routeTemplatesCacheKey(clientID))
+	}
+}
+
+// routeTemplatesCacheKey generates the cache key for a client's route templates
+func routeTemplatesCacheKey(clientID uuid.UUID) string {
+	return "route_templates:" + clientID.String()
+}
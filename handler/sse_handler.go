@@ -28,6 +28,7 @@ func NewSSEHandler() *SSEHandler {
 //	@Security		BearerAuth
 //	@Success		200	{string}	string	"Event stream connection established"
 //	@Failure		401	{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		403	{object}	object{success=bool,message=string,error=string}	"Admin role required"
 //	@Failure		503	{object}	object{success=bool,message=string,error=string}	"Redis not available for SSE"
 //	@Router			/api/stream/usage [get]
 func (h *SSEHandler) StreamUsageUpdates(c echo.Context) error {
@@ -117,6 +118,7 @@ func (h *SSEHandler) StreamUsageUpdates(c echo.Context) error {
 //	@Security		BearerAuth
 //	@Success		200	{string}	string	"Event stream connection established"
 //	@Failure		401	{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		403	{object}	object{success=bool,message=string,error=string}	"Admin role required"
 //	@Router			/api/stream/top [get]
 func (h *SSEHandler) StreamTopClients(c echo.Context) error {
 	ctx := c.Request().Context()
@@ -2,12 +2,15 @@ package handler
 
 import (
 	"context"
+	"fmt"
 	"nexmedis-golang/db"
 	"nexmedis-golang/model"
 	"nexmedis-golang/store"
 	"nexmedis-golang/utils"
+	"strconv"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
@@ -15,14 +18,16 @@ import (
 type UsageHandler struct {
 	logStore    *store.LogStore
 	clientStore *store.ClientStore
+	quotaStore  *store.QuotaStore
 	cacheTTL    time.Duration
 }
 
 // NewUsageHandler creates a new UsageHandler
-func NewUsageHandler(logStore *store.LogStore, clientStore *store.ClientStore, cacheTTL time.Duration) *UsageHandler {
+func NewUsageHandler(logStore *store.LogStore, clientStore *store.ClientStore, quotaStore *store.QuotaStore, cacheTTL time.Duration) *UsageHandler {
 	return &UsageHandler{
 		logStore:    logStore,
 		clientStore: clientStore,
+		quotaStore:  quotaStore,
 		cacheTTL:    cacheTTL,
 	}
 }
@@ -36,6 +41,7 @@ func NewUsageHandler(logStore *store.LogStore, clientStore *store.ClientStore, c
 //	@Security		BearerAuth
 //	@Success		200	{object}	object{success=bool,message=string,data=[]model.DailyUsage}	"Daily usage retrieved successfully"
 //	@Failure		401	{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		403	{object}	object{success=bool,message=string,error=string}	"Admin role required"
 //	@Failure		500	{object}	object{success=bool,message=string,error=string}	"Failed to get daily usage"
 //	@Router			/api/usage/daily [get]
 func (h *UsageHandler) GetDailyUsage(c echo.Context) error {
@@ -73,6 +79,7 @@ func (h *UsageHandler) GetDailyUsage(c echo.Context) error {
 //	@Security		BearerAuth
 //	@Success		200	{object}	object{success=bool,message=string,data=[]model.TopClient}	"Top clients retrieved successfully"
 //	@Failure		401	{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		403	{object}	object{success=bool,message=string,error=string}	"Admin role required"
 //	@Failure		500	{object}	object{success=bool,message=string,error=string}	"Failed to get top clients"
 //	@Router			/api/usage/top [get]
 func (h *UsageHandler) GetTopClients(c echo.Context) error {
@@ -136,6 +143,7 @@ func (h *UsageHandler) prefetchTopClients(ctx context.Context, cacheKey string)
 //	@Success		200			{object}	object{success=bool,message=string,data=[]model.DailyUsage}	"Client usage retrieved successfully"
 //	@Failure		400			{object}	object{success=bool,message=string,error=string}	"Client ID is required"
 //	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Admin role required"
 //	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
 //	@Failure		500			{object}	object{success=bool,message=string,error=string}	"Failed to get client usage"
 //	@Router			/api/usage/client/{client_id} [get]
@@ -185,6 +193,7 @@ func (h *UsageHandler) GetClientUsage(c echo.Context) error {
 //	@Security		BearerAuth
 //	@Success		200	{object}	object{success=bool,message=string,data=object{total_requests_24h=int,total_requests_7d=int,total_clients=int,timestamp=string}}	"Usage stats retrieved successfully"
 //	@Failure		401	{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		403	{object}	object{success=bool,message=string,error=string}	"Admin role required"
 //	@Failure		500	{object}	object{success=bool,message=string,error=string}	"Failed to get usage stats"
 //	@Router			/api/usage/stats [get]
 func (h *UsageHandler) GetUsageStats(c echo.Context) error {
@@ -234,3 +243,454 @@ func (h *UsageHandler) GetUsageStats(c echo.Context) error {
 
 	return utils.OKResponse(c, "Usage stats retrieved successfully", stats)
 }
+
+// GetEndpointUsage returns request counts grouped by route template
+//
+//	@Summary		Get endpoint usage statistics
+//	@Description	Retrieve API request counts grouped by normalized route template (e.g. /api/v1/users/:id) for the last N days, optionally for a single client. Use group_by=endpoint to group by the raw endpoint instead.
+//	@Tags			Usage
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			days		query		int		false	"Number of days to include (1-90, default 7)"
+//	@Param			client_id	query		string	false	"Only include this client"
+//	@Param			group_by	query		string	false	"template (default) or endpoint"
+//	@Success		200			{object}	object{success=bool,message=string,data=[]model.EndpointUsage}	"Endpoint usage retrieved successfully"
+//	@Failure		400			{object}	object{success=bool,message=string,error=string}	"Invalid query parameters"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Admin role required"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
+//	@Failure		500			{object}	object{success=bool,message=string,error=string}	"Failed to get endpoint usage"
+//	@Router			/api/usage/endpoints [get]
+func (h *UsageHandler) GetEndpointUsage(c echo.Context) error {
+	days, err := parseDays(c.QueryParam("days"))
+	if err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+
+	groupBy := c.QueryParam("group_by")
+	if groupBy == "" {
+		groupBy = "template"
+	}
+	if groupBy != "template" && groupBy != "endpoint" {
+		return utils.BadRequestResponse(c, "group_by must be 'template' or 'endpoint'")
+	}
+
+	clientIDStr := c.QueryParam("client_id")
+	clientID, err := h.clientFilter(clientIDStr)
+	if err != nil {
+		return utils.NotFoundResponse(c, "Client not found")
+	}
+
+	ctx := c.Request().Context()
+	cacheKey := fmt.Sprintf("usage:endpoints:%s:%s:%ddays", groupBy, clientIDStr, days)
+
+	// Try to get from cache
+	if db.IsRedisAvailable(ctx) {
+		var cachedData []model.EndpointUsage
+		if err := db.CacheGet(ctx, cacheKey, &cachedData); err == nil {
+			return utils.OKResponse(c, "Endpoint usage retrieved from cache", cachedData)
+		}
+	}
+
+	// Get from database
+	end := time.Now().UTC()
+	start := end.AddDate(0, 0, -days)
+	usage, err := h.logStore.GetEndpointUsage(clientID, start, end, groupBy == "template", 100)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to get endpoint usage", err.Error())
+	}
+
+	// Cache the result (shorter TTL, the window slides with time)
+	if db.IsRedisAvailable(ctx) {
+		_ = db.CacheSet(ctx, cacheKey, usage, 5*time.Minute)
+	}
+
+	return utils.OKResponse(c, "Endpoint usage retrieved successfully", usage)
+}
+
+// GetClientErrorRates returns the error rate of each client
+//
+//	@Summary		Get error rate per client
+//	@Description	Retrieve the share of 4xx and 5xx responses of each client for the last N days, highest first. Hits logged without a status code are not counted.
+//	@Tags			Usage
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			days	query		int	false	"Number of days to include (1-90, default 7)"
+//	@Success		200		{object}	object{success=bool,message=string,data=[]model.ClientErrorRate}	"Client error rates retrieved successfully"
+//	@Failure		400		{object}	object{success=bool,message=string,error=string}	"Invalid query parameters"
+//	@Failure		401		{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		403		{object}	object{success=bool,message=string,error=string}	"Admin role required"
+//	@Failure		500		{object}	object{success=bool,message=string,error=string}	"Failed to get client error rates"
+//	@Router			/api/usage/errors/clients [get]
+func (h *UsageHandler) GetClientErrorRates(c echo.Context) error {
+	days, err := parseDays(c.QueryParam("days"))
+	if err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+
+	ctx := c.Request().Context()
+	cacheKey := fmt.Sprintf("usage:errors:clients:%ddays", days)
+
+	// Try to get from cache
+	if db.IsRedisAvailable(ctx) {
+		var cachedData []model.ClientErrorRate
+		if err := db.CacheGet(ctx, cacheKey, &cachedData); err == nil {
+			return utils.OKResponse(c, "Client error rates retrieved from cache", cachedData)
+		}
+	}
+
+	// Get from database
+	end := time.Now().UTC()
+	rates, err := h.logStore.GetErrorRateByClient(end.AddDate(0, 0, -days), end, 100)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to get client error rates", err.Error())
+	}
+
+	// Cache the result
+	if db.IsRedisAvailable(ctx) {
+		_ = db.CacheSet(ctx, cacheKey, rates, 5*time.Minute)
+	}
+
+	return utils.OKResponse(c, "Client error rates retrieved successfully", rates)
+}
+
+// GetEndpointErrorRates returns the error rate of each route template
+//
+//	@Summary		Get error rate per endpoint
+//	@Description	Retrieve the share of 4xx and 5xx responses of each route template for the last N days, highest first, optionally for a single client. Hits logged without a status code are not counted.
+//	@Tags			Usage
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			days		query		int		false	"Number of days to include (1-90, default 7)"
+//	@Param			client_id	query		string	false	"Only include this client"
+//	@Success		200			{object}	object{success=bool,message=string,data=[]model.EndpointErrorRate}	"Endpoint error rates retrieved successfully"
+//	@Failure		400			{object}	object{success=bool,message=string,error=string}	"Invalid query parameters"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Admin role required"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
+//	@Failure		500			{object}	object{success=bool,message=string,error=string}	"Failed to get endpoint error rates"
+//	@Router			/api/usage/errors/endpoints [get]
+func (h *UsageHandler) GetEndpointErrorRates(c echo.Context) error {
+	days, err := parseDays(c.QueryParam("days"))
+	if err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+
+	clientIDStr := c.QueryParam("client_id")
+	clientID, err := h.clientFilter(clientIDStr)
+	if err != nil {
+		return utils.NotFoundResponse(c, "Client not found")
+	}
+
+	ctx := c.Request().Context()
+	cacheKey := fmt.Sprintf("usage:errors:endpoints:%s:%ddays", clientIDStr, days)
+
+	// Try to get from cache
+	if db.IsRedisAvailable(ctx) {
+		var cachedData []model.EndpointErrorRate
+		if err := db.CacheGet(ctx, cacheKey, &cachedData); err == nil {
+			return utils.OKResponse(c, "Endpoint error rates retrieved from cache", cachedData)
+		}
+	}
+
+	// Get from database
+	end := time.Now().UTC()
+	rates, err := h.logStore.GetErrorRateByEndpoint(clientID, end.AddDate(0, 0, -days), end, 100)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to get endpoint error rates", err.Error())
+	}
+
+	// Cache the result
+	if db.IsRedisAvailable(ctx) {
+		_ = db.CacheSet(ctx, cacheKey, rates, 5*time.Minute)
+	}
+
+	return utils.OKResponse(c, "Endpoint error rates retrieved successfully", rates)
+}
+
+// GetStatusBreakdown returns the number of hits per status class
+//
+//	@Summary		Get status class breakdown
+//	@Description	Retrieve the number and share of API hits per status class (2xx, 3xx, 4xx, 5xx, unknown) for the last N days, optionally for a single client
+//	@Tags			Usage
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			days		query		int		false	"Number of days to include (1-90, default 7)"
+//	@Param			client_id	query		string	false	"Only include this client"
+//	@Success		200			{object}	object{success=bool,message=string,data=[]model.StatusClassCount}	"Status breakdown retrieved successfully"
+//	@Failure		400			{object}	object{success=bool,message=string,error=string}	"Invalid query parameters"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Admin role required"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
+//	@Failure		500			{object}	object{success=bool,message=string,error=string}	"Failed to get status breakdown"
+//	@Router			/api/usage/status [get]
+func (h *UsageHandler) GetStatusBreakdown(c echo.Context) error {
+	days, err := parseDays(c.QueryParam("days"))
+	if err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+
+	clientIDStr := c.QueryParam("client_id")
+	clientID, err := h.clientFilter(clientIDStr)
+	if err != nil {
+		return utils.NotFoundResponse(c, "Client not found")
+	}
+
+	ctx := c.Request().Context()
+	cacheKey := fmt.Sprintf("usage:status:%s:%ddays", clientIDStr, days)
+
+	// Try to get from cache
+	if db.IsRedisAvailable(ctx) {
+		var cachedData []model.StatusClassCount
+		if err := db.CacheGet(ctx, cacheKey, &cachedData); err == nil {
+			return utils.OKResponse(c, "Status breakdown retrieved from cache", cachedData)
+		}
+	}
+
+	// Get from database
+	end := time.Now().UTC()
+	breakdown, err := h.logStore.GetStatusClassBreakdown(clientID, end.AddDate(0, 0, -days), end)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to get status breakdown", err.Error())
+	}
+
+	// Cache the result
+	if db.IsRedisAvailable(ctx) {
+		_ = db.CacheSet(ctx, cacheKey, breakdown, 5*time.Minute)
+	}
+
+	return utils.OKResponse(c, "Status breakdown retrieved successfully", breakdown)
+}
+
+// GetClientLatency returns the latency percentiles of each client
+//
+//	@Summary		Get latency percentiles per client
+//	@Description	Retrieve p50/p90/p99 request durations of each client over a window, slowest first. Only hits logged with a duration_ms are counted. Percentiles come from hourly histogram rollups and are accurate to within 1%.
+//	@Tags			Usage
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			window	query		string	false	"Lookback window such as 1h, 24h or 7d (max 90d, default 24h)"
+//	@Success		200		{object}	object{success=bool,message=string,data=[]model.ClientLatency}	"Client latency retrieved successfully"
+//	@Failure		400		{object}	object{success=bool,message=string,error=string}	"Invalid query parameters"
+//	@Failure		401		{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		403		{object}	object{success=bool,message=string,error=string}	"Admin role required"
+//	@Failure		500		{object}	object{success=bool,message=string,error=string}	"Failed to get client latency"
+//	@Router			/api/usage/latency/clients [get]
+func (h *UsageHandler) GetClientLatency(c echo.Context) error {
+	window, err := parseWindow(c.QueryParam("window"))
+	if err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+
+	ctx := c.Request().Context()
+	cacheKey := fmt.Sprintf("usage:latency:clients:%dh", int(window.Hours()))
+
+	// Try to get from cache
+	if db.IsRedisAvailable(ctx) {
+		var cachedData []model.ClientLatency
+		if err := db.CacheGet(ctx, cacheKey, &cachedData); err == nil {
+			return utils.OKResponse(c, "Client latency retrieved from cache", cachedData)
+		}
+	}
+
+	// Get from database
+	latency, err := h.logStore.GetLatencyByClient(time.Now().UTC().Add(-window), 100)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to get client latency", err.Error())
+	}
+
+	// Cache the result
+	if db.IsRedisAvailable(ctx) {
+		_ = db.CacheSet(ctx, cacheKey, latency, 5*time.Minute)
+	}
+
+	return utils.OKResponse(c, "Client latency retrieved successfully", latency)
+}
+
+// GetEndpointLatency returns the latency percentiles of each route template
+//
+//	@Summary		Get latency percentiles per endpoint
+//	@Description	Retrieve p50/p90/p99 request durations of each route template over a window, slowest first, optionally for a single client. Only hits logged with a duration_ms are counted. Percentiles come from hourly histogram rollups and are accurate to within 1%.
+//	@Tags			Usage
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			window		query		string	false	"Lookback window such as 1h, 24h or 7d (max 90d, default 24h)"
+//	@Param			client_id	query		string	false	"Only include this client"
+//	@Success		200			{object}	object{success=bool,message=string,data=[]model.EndpointLatency}	"Endpoint latency retrieved successfully"
+//	@Failure		400			{object}	object{success=bool,message=string,error=string}	"Invalid query parameters"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Admin role required"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
+//	@Failure		500			{object}	object{success=bool,message=string,error=string}	"Failed to get endpoint latency"
+//	@Router			/api/usage/latency/endpoints [get]
+func (h *UsageHandler) GetEndpointLatency(c echo.Context) error {
+	window, err := parseWindow(c.QueryParam("window"))
+	if err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+
+	clientIDStr := c.QueryParam("client_id")
+	clientID, err := h.clientFilter(clientIDStr)
+	if err != nil {
+		return utils.NotFoundResponse(c, "Client not found")
+	}
+
+	ctx := c.Request().Context()
+	cacheKey := fmt.Sprintf("usage:latency:endpoints:%s:%dh", clientIDStr, int(window.Hours()))
+
+	// Try to get from cache
+	if db.IsRedisAvailable(ctx) {
+		var cachedData []model.EndpointLatency
+		if err := db.CacheGet(ctx, cacheKey, &cachedData); err == nil {
+			return utils.OKResponse(c, "Endpoint latency retrieved from cache", cachedData)
+		}
+	}
+
+	// Get from database
+	latency, err := h.logStore.GetLatencyByEndpoint(clientID, time.Now().UTC().Add(-window), 100)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to get endpoint latency", err.Error())
+	}
+
+	// Cache the result
+	if db.IsRedisAvailable(ctx) {
+		_ = db.CacheSet(ctx, cacheKey, latency, 5*time.Minute)
+	}
+
+	return utils.OKResponse(c, "Endpoint latency retrieved successfully", latency)
+}
+
+// GetQuota returns the quota consumption of the current billing period
+//
+//	@Summary		Get current quota consumption
+//	@Description	Retrieve the hits recorded in the current billing period against the monthly quota of the client's plan. Billing periods start on the client's billing anchor day each month. Defaults to the authenticated client. Hits are counted in Redis and persisted to Postgres every few seconds.
+//	@Tags			Usage
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			client_id	query		string	false	"Client ID (defaults to the authenticated client, other clients require the admin role)"
+//	@Success		200			{object}	object{success=bool,message=string,data=model.QuotaUsage}	"Quota retrieved successfully"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Admin role required for other clients"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
+//	@Failure		500			{object}	object{success=bool,message=string,error=string}	"Failed to get quota"
+//	@Router			/api/usage/quota [get]
+func (h *UsageHandler) GetQuota(c echo.Context) error {
+	clientID, ok := h.quotaClient(c)
+	if !ok {
+		return utils.NotFoundResponse(c, "Client not found")
+	}
+	if !canAccessClient(c, clientID) {
+		return utils.ForbiddenResponse(c, "Only admins can view the quota of other clients")
+	}
+
+	period, err := h.quotaStore.Current(clientID, time.Now().UTC())
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to get quota", err.Error())
+	}
+
+	return utils.OKResponse(c, "Quota retrieved successfully", period.ToUsage())
+}
+
+// GetQuotaHistory returns the quota consumption and overage of past billing periods
+//
+//	@Summary		Get quota history
+//	@Description	Retrieve the consumption and overage of the client's billing periods, newest first. Periods without any hits are not listed. Defaults to the authenticated client.
+//	@Tags			Usage
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Param			client_id	query		string	false	"Client ID (defaults to the authenticated client, other clients require the admin role)"
+//	@Param			periods		query		int		false	"Number of billing periods (1-36, default 12)"
+//	@Success		200			{object}	object{success=bool,message=string,data=[]model.QuotaUsage}	"Quota history retrieved successfully"
+//	@Failure		400			{object}	object{success=bool,message=string,error=string}	"Invalid query parameters"
+//	@Failure		401			{object}	object{success=bool,message=string,error=string}	"Unauthorized - JWT token required"
+//	@Failure		403			{object}	object{success=bool,message=string,error=string}	"Admin role required for other clients"
+//	@Failure		404			{object}	object{success=bool,message=string,error=string}	"Client not found"
+//	@Failure		500			{object}	object{success=bool,message=string,error=string}	"Failed to get quota history"
+//	@Router			/api/usage/quota/history [get]
+func (h *UsageHandler) GetQuotaHistory(c echo.Context) error {
+	periods, err := parsePeriods(c.QueryParam("periods"))
+	if err != nil {
+		return utils.BadRequestResponse(c, err.Error())
+	}
+
+	clientID, ok := h.quotaClient(c)
+	if !ok {
+		return utils.NotFoundResponse(c, "Client not found")
+	}
+	if !canAccessClient(c, clientID) {
+		return utils.ForbiddenResponse(c, "Only admins can view the quota of other clients")
+	}
+
+	history, err := h.quotaStore.ListByClient(clientID, periods)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to get quota history", err.Error())
+	}
+
+	usage := make([]model.QuotaUsage, len(history))
+	for i := range history {
+		usage[i] = history[i].ToUsage()
+	}
+
+	return utils.OKResponse(c, "Quota history retrieved successfully", usage)
+}
+
+// quotaClient resolves the client of a quota request: the client_id query
+// parameter, or else the authenticated client
+func (h *UsageHandler) quotaClient(c echo.Context) (uuid.UUID, bool) {
+	if clientIDStr := c.QueryParam("client_id"); clientIDStr != "" {
+		clientID, err := h.clientFilter(clientIDStr)
+		if err != nil {
+			return uuid.Nil, false
+		}
+		return *clientID, true
+	}
+
+	return clientIDFromContext(c)
+}
+
+// clientFilter resolves an optional client_id query parameter to a client UUID
+func (h *UsageHandler) clientFilter(clientIDStr string) (*uuid.UUID, error) {
+	if clientIDStr == "" {
+		return nil, nil
+	}
+
+	client, err := h.clientStore.FindByClientID(clientIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client.ID, nil
+}
+
+// parseDays parses the days query parameter (1-90, default 7)
+func parseDays(value string) (int, error) {
+	if value == "" {
+		return 7, nil
+	}
+
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 1 || days > 90 {
+		return 0, fmt.Errorf("days must be a number between 1 and 90")
+	}
+
+	return days, nil
+}
+
+// parsePeriods parses the periods query parameter (1-36, default 12)
+func parsePeriods(value string) (int, error) {
+	if value == "" {
+		return 12, nil
+	}
+
+	periods, err := strconv.Atoi(value)
+	if err != nil || periods < 1 || periods > 36 {
+		return 0, fmt.Errorf("periods must be a number between 1 and 36")
+	}
+
+	return periods, nil
+}
+
+// parseWindow parses the window query parameter of latency endpoints
+func parseWindow(value string) (time.Duration, error) {
+	return utils.ParseWindow(value, 24*time.Hour, 90*24*time.Hour)
+}
@@ -6,11 +6,15 @@ import (
 	"net/http"
 	"nexmedis-golang/db"
 	_ "nexmedis-golang/docs" // Import docs for Swagger
+	"nexmedis-golang/handler"
 	"nexmedis-golang/router"
+	"nexmedis-golang/store"
 	"nexmedis-golang/utils"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -42,10 +46,20 @@ import (
 //	@name						Authorization
 //	@description				Type "Bearer" followed by a space and JWT token
 //
+//	@securityDefinitions.apikey	AdminToken
+//	@in							header
+//	@name						X-Admin-Token
+//	@description				Bootstrap admin token (ADMIN_API_TOKENS or ADMIN_API_TOKEN), accepted instead of an admin access token
+//
+//	@securityDefinitions.basic	ClientBasicAuth
+//	@description				OAuth client credentials: the client ID as username and an API key as password
+//
 //	@schemes					http https
 func main() {
 	// Initialize JWT
-	utils.InitJWT()
+	if err := utils.InitJWT(); err != nil {
+		log.Fatalf("Failed to initialize JWT keys: %v", err)
+	}
 
 	// Initialize database
 	dbConfig := db.GetDBConfig()
@@ -59,6 +73,11 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	// Create the built-in rate limit plans
+	if err := db.SeedPlans(getRateLimit()); err != nil {
+		log.Fatalf("Failed to seed plans: %v", err)
+	}
+
 	// Initialize Redis
 	redisConfig := db.GetRedisConfig()
 	if err := db.InitRedis(redisConfig); err != nil {
@@ -77,21 +96,58 @@ func main() {
 
 	// Get configuration
 	cacheTTL := getCacheTTL()
-	rateLimitPerHour := getRateLimit()
 
 	// Initialize rate limiter
-	rateLimiter := utils.NewRateLimiter(rateLimitPerHour)
+	rateLimiter := utils.NewRateLimiter(getRateLimiterConfig())
+	log.Printf("Rate limiting with the %s algorithm (%s when Redis is unavailable)", rateLimiter.Algorithm(), rateLimiter.FailureMode())
+
+	// Initialize idempotency key store
+	idempotency := utils.NewIdempotencyStore(getIdempotencyWindow())
+
+	// Initialize asynchronous log write pipeline
+	var logQueue *store.LogQueue
+	if getEnv("INGEST_ASYNC", "true") == "true" {
+		logQueue = store.NewLogQueue(store.NewLogStore(db.DB), getLogQueueConfig())
+	}
+
+	// Count quotas in Redis and persist them to Postgres in batches
+	quotaStore := store.NewQuotaStore(db.DB)
+	quotaStore.Start(getEnvDuration("QUOTA_FLUSH_INTERVAL", 5*time.Second))
+
+	// Accepting the API key in the request body is deprecated in favour of X-API-Key
+	allowBodyAPIKey := getEnv("ALLOW_BODY_API_KEY", "true") == "true"
+	if allowBodyAPIKey {
+		log.Println("Warning: api_key in the log request body is deprecated, set ALLOW_BODY_API_KEY=false once clients send X-API-Key")
+	}
 
 	// Setup routes
 	routerConfig := router.Config{
 		DB:                db.DB,
 		RateLimiter:       rateLimiter,
+		LogQueue:          logQueue,
+		QuotaStore:        quotaStore,
+		Idempotency:       idempotency,
 		CacheTTL:          cacheTTL,
 		EnableIPWhitelist: false, // Set to true and configure AllowedIPs for IP whitelisting
 		AllowedIPs:        []string{},
+		TrustedProxies:    getTrustedProxies(),
+		AllowBodyAPIKey:   allowBodyAPIKey,
+		AdminTokens:       getAdminTokens(),
+		LoginGuard:        utils.NewLoginGuard("login", getLoginGuardConfig("LOGIN", 5, 15*time.Minute, time.Minute)),
+		RegisterGuard:     utils.NewLoginGuard("register", getLoginGuardConfig("REGISTER", 5, time.Hour, 15*time.Minute)),
+		Mailer:            getMailer(),
+		Verification: handler.VerificationConfig{
+			Lifetime: getEnvDuration("EMAIL_VERIFICATION_EXPIRATION", 24*time.Hour),
+			LinkURL:  getEnv("EMAIL_VERIFICATION_URL", ""),
+		},
 	}
 	router.Setup(e, routerConfig)
 
+	// Start flush workers once the handlers have registered their callbacks
+	if logQueue != nil {
+		logQueue.Start()
+	}
+
 	// Get server configuration
 	serverHost := getEnv("SERVER_HOST", "0.0.0.0")
 	serverPort := getEnv("SERVER_PORT", "8080")
@@ -106,9 +162,9 @@ func main() {
 		}
 	}()
 
-	// Wait for interrupt signal
+	// Wait for interrupt or termination signal
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
 
 	// Graceful shutdown
@@ -117,7 +173,22 @@ func main() {
 	defer cancel()
 
 	if err := e.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+
+	// Drain queued logs before closing the database
+	if logQueue != nil {
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer drainCancel()
+
+		if err := logQueue.Close(drainCtx); err != nil {
+			log.Printf("Failed to drain log queue: %v", err)
+		}
+	}
+
+	// Persist the quota counts still held in Redis
+	if err := quotaStore.Close(); err != nil {
+		log.Printf("Failed to persist quota counts: %v", err)
 	}
 
 	log.Println("Server stopped gracefully")
@@ -131,6 +202,39 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getTrustedProxies gets the proxies allowed to set X-Forwarded-For from environment
+func getTrustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(getEnv("TRUSTED_PROXIES", ""), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// getAdminTokens gets the bootstrap admin tokens from environment.
+// ADMIN_API_TOKENS names one token per admin as "name:token,...", and the
+// shared ADMIN_API_TOKEN is recorded as "admin" in the audit trail.
+func getAdminTokens() map[string]string {
+	tokens := make(map[string]string)
+	if token := getEnv("ADMIN_API_TOKEN", ""); token != "" {
+		tokens["admin"] = token
+	}
+	for _, entry := range strings.Split(getEnv("ADMIN_API_TOKENS", ""), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, token, ok := strings.Cut(entry, ":")
+		if !ok || name == "" || token == "" {
+			log.Printf("Warning: ignoring admin token without a name, expected name:token")
+			continue
+		}
+		tokens[name] = token
+	}
+	return tokens
+}
+
 // getCacheTTL gets cache TTL from environment
 func getCacheTTL() time.Duration {
 	ttlStr := getEnv("CACHE_TTL", "3600")
@@ -149,4 +253,113 @@ func getRateLimit() int {
 		return 1000
 	}
 	return limit
-}
\ No newline at end of file
+}
+
+// getRateLimiterConfig gets rate limiter configuration from environment
+func getRateLimiterConfig() utils.RateLimiterConfig {
+	algorithm, err := utils.ParseRateLimitAlgorithm(getEnv("RATE_LIMIT_ALGORITHM", string(utils.SlidingWindow)))
+	if err != nil {
+		log.Printf("Warning: %v, falling back to sliding", err)
+		algorithm = utils.SlidingWindow
+	}
+
+	failureMode, err := utils.ParseRateLimitFailureMode(getEnv("RATE_LIMIT_FAILURE_MODE", string(utils.FailLocal)))
+	if err != nil {
+		log.Printf("Warning: %v, falling back to local", err)
+		failureMode = utils.FailLocal
+	}
+
+	rules, err := utils.ParseRateLimitRules(getEnv("RATE_LIMIT_RULES", ""))
+	if err != nil {
+		log.Printf("Warning: %v, ignoring rate limit rules", err)
+		rules = nil
+	}
+
+	return utils.RateLimiterConfig{
+		Limit:       getRateLimit(),
+		Algorithm:   algorithm,
+		Burst:       getEnvInt("RATE_LIMIT_BURST", 0),
+		FailureMode: failureMode,
+		Instances:   getEnvInt("RATE_LIMIT_INSTANCES", 1),
+		Rules:       rules,
+	}
+}
+
+// getIdempotencyWindow gets how long idempotency keys are remembered from environment
+func getIdempotencyWindow() time.Duration {
+	window, err := time.ParseDuration(getEnv("IDEMPOTENCY_WINDOW", "24h"))
+	if err != nil || window <= 0 {
+		return 24 * time.Hour
+	}
+	return window
+}
+
+// getEnvInt gets an integer environment variable with default value
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(getEnv(key, strconv.Itoa(defaultValue)))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getLoginGuardConfig gets the brute-force thresholds of a public route from
+// environment variables with the given prefix
+func getLoginGuardConfig(prefix string, maxAttempts int, window, lockout time.Duration) utils.LoginGuardConfig {
+	return utils.LoginGuardConfig{
+		MaxFailures: getEnvInt(prefix+"_MAX_ATTEMPTS", maxAttempts),
+		Window:      getEnvDuration(prefix+"_ATTEMPT_WINDOW", window),
+		Lockout:     getEnvDuration(prefix+"_LOCKOUT", lockout),
+		MaxLockout:  getEnvDuration(prefix+"_MAX_LOCKOUT", 24*time.Hour),
+	}
+}
+
+// getEnvDuration gets a duration environment variable with default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, defaultValue.String()))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// getMailer gets the outbound email configuration from environment. MAIL_DRIVER
+// selects smtp or outbox, which writes messages to MAIL_OUTBOX_DIR instead of
+// sending them.
+func getMailer() utils.Mailer {
+	from := getEnv("MAIL_FROM", "no-reply@localhost")
+
+	switch driver := getEnv("MAIL_DRIVER", "outbox"); driver {
+	case "smtp":
+		host := getEnv("SMTP_HOST", "")
+		if host == "" {
+			log.Fatalf("SMTP_HOST is required when MAIL_DRIVER=smtp")
+		}
+		return utils.NewSMTPMailer(utils.SMTPConfig{
+			Host:     host,
+			Port:     getEnvInt("SMTP_PORT", 587),
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			From:     from,
+		})
+	case "outbox":
+		dir := getEnv("MAIL_OUTBOX_DIR", "outbox")
+		if utils.IsProduction() {
+			log.Printf("Warning: MAIL_DRIVER=outbox in production, verification emails are written to %s instead of being sent", dir)
+		}
+		return utils.NewOutboxMailer(dir, from)
+	default:
+		log.Fatalf("Unknown MAIL_DRIVER %q, use smtp or outbox", driver)
+		return nil
+	}
+}
+
+// getLogQueueConfig gets the asynchronous log write pipeline configuration from environment
+func getLogQueueConfig() store.LogQueueConfig {
+	return store.LogQueueConfig{
+		Capacity:      getEnvInt("INGEST_QUEUE_SIZE", 10000),
+		BatchSize:     getEnvInt("INGEST_BATCH_SIZE", 500),
+		FlushInterval: time.Duration(getEnvInt("INGEST_FLUSH_INTERVAL_MS", 1000)) * time.Millisecond,
+		Workers:       getEnvInt("INGEST_WORKERS", 4),
+	}
+}
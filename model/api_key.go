@@ -0,0 +1,108 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// API key states reported in responses
+const (
+	APIKeyActive  = "active"
+	APIKeyExpired = "expired"
+	APIKeyRevoked = "revoked"
+)
+
+// APIKey is one of the API keys of a client. Only a SHA-256 hash of the key
+// is stored; the public prefix narrows the lookup down before the hashes are
+// compared. A key stops working when it expires or is revoked, and it only
+// grants its scopes.
+type APIKey struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	ClientID   uuid.UUID  `gorm:"type:uuid;not null;index" json:"client_id"`
+	Client     *Client    `gorm:"foreignKey:ClientID" json:"-"`
+	Label      string     `gorm:"size:100;not null;default:''" json:"label"`
+	Prefix     string     `gorm:"size:16;not null;index" json:"prefix"`
+	Hash       string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Scopes     string     `gorm:"size:255;not null;check:chk_api_keys_scopes,scopes <> ''" json:"scopes"` // Space-separated scopes
+	Key        string     `gorm:"-" json:"-"`                                                             // Plaintext key, only set right after it was generated
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// BeforeCreate hook to generate UUID
+func (k *APIKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName specifies the table name for APIKey
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// ScopeList returns the scopes granted by the key
+func (k *APIKey) ScopeList() []string {
+	return SplitScopes(k.Scopes)
+}
+
+// StatusAt returns whether the key is active, expired or revoked at t
+func (k *APIKey) StatusAt(t time.Time) string {
+	if k.RevokedAt != nil {
+		return APIKeyRevoked
+	}
+	if k.ExpiresAt != nil && !k.ExpiresAt.After(t) {
+		return APIKeyExpired
+	}
+	return APIKeyActive
+}
+
+// APIKeyResponse represents an API key in API responses
+// @Description API key of a client. The key itself is only shown when it is created.
+type APIKeyResponse struct {
+	ID         uuid.UUID  `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"` // Key ID
+	Label      string     `json:"label" example:"production"`                        // Label of the key
+	Prefix     string     `json:"prefix" example:"Xk3_9aQz"`                         // Public prefix identifying the key
+	Key        string     `json:"key,omitempty" example:"Xk3_9aQz..."`               // API key (only shown when created)
+	Scopes     []string   `json:"scopes" example:"logs:write,usage:read"`            // Scopes granted by the key
+	Status     string     `json:"status" example:"active"`                           // active, expired or revoked
+	CreatedAt  time.Time  `json:"created_at" example:"2025-01-15T10:30:00Z"`         // Creation timestamp
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`                            // Last time the key authenticated a request
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`                              // When the key stops working
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`                              // When the key was revoked
+}
+
+// ToResponse converts APIKey to APIKeyResponse
+func (k *APIKey) ToResponse() *APIKeyResponse {
+	return &APIKeyResponse{
+		ID:         k.ID,
+		Label:      k.Label,
+		Prefix:     k.Prefix,
+		Key:        k.Key,
+		Scopes:     k.ScopeList(),
+		Status:     k.StatusAt(time.Now()),
+		CreatedAt:  k.CreatedAt,
+		LastUsedAt: k.LastUsedAt,
+		ExpiresAt:  k.ExpiresAt,
+		RevokedAt:  k.RevokedAt,
+	}
+}
+
+// CreateAPIKeyRequest represents the request body for creating an API key
+// @Description Request body for creating an additional API key
+type CreateAPIKeyRequest struct {
+	Label     string   `json:"label" example:"production"`  // Label to tell keys apart (up to 100 characters)
+	Scopes    []string `json:"scopes" example:"logs:write"` // Scopes to grant (defaults to the scopes of the caller's token)
+	ExpiresIn string   `json:"expires_in" example:"90d"`    // Optional lifetime such as 24h or 90d (up to 365d)
+}
+
+// RotateAPIKeyRequest represents the request body for rotating an API key
+// @Description Request body for rotating an API key
+type RotateAPIKeyRequest struct {
+	GracePeriod string `json:"grace_period" example:"24h"` // How long the old key keeps working, such as 1h or 7d (defaults to 24h, up to 30d)
+}
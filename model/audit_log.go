@@ -0,0 +1,45 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Audited admin actions
+const (
+	AuditPlanAssign       = "plan.assign"
+	AuditLimitsOverride   = "limits.override"
+	AuditBillingAnchorSet = "billing_anchor.set"
+	AuditRateLimitsReset  = "rate_limits.reset"
+	AuditBoostGrant       = "boost.grant"
+	AuditBoostRevoke      = "boost.revoke"
+	AuditTokensRevoke     = "tokens.revoke"
+	AuditRoleSet          = "role.set"
+)
+
+// AuditLog records an action taken through the admin API
+type AuditLog struct {
+	ID        uuid.UUID       `gorm:"type:uuid;primaryKey" json:"id"`
+	Actor     string          `gorm:"size:255;not null" json:"actor"`
+	IP        string          `gorm:"not null;default:''" json:"ip"`
+	Action    string          `gorm:"size:64;not null;index" json:"action"`
+	ClientID  *uuid.UUID      `gorm:"type:uuid;index" json:"client_id,omitempty"`
+	Details   json.RawMessage `gorm:"type:jsonb;not null;default:'{}'" json:"details" swaggertype:"object"`
+	CreatedAt time.Time       `gorm:"index" json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (a *AuditLog) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName specifies the table name for AuditLog
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
@@ -13,13 +13,33 @@ type Client struct {
 	ClientID  string         `gorm:"uniqueIndex;not null" json:"client_id"`
 	Name      string         `gorm:"not null" json:"name"`
 	Email     string         `gorm:"uniqueIndex;not null" json:"email"`
-	APIKey    string         `gorm:"uniqueIndex;not null" json:"-"` // Don't expose in JSON
+	Role      string         `gorm:"size:20;not null;default:'client'" json:"role"`
+	PlanID    *uuid.UUID     `gorm:"type:uuid;index" json:"plan_id,omitempty"`
+	Plan      *Plan          `gorm:"foreignKey:PlanID" json:"plan,omitempty"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// API keys, loaded only when needed
+	APIKeys []APIKey `gorm:"foreignKey:ClientID" json:"-"`
+
+	// Set once the client proved it controls its email address. Unverified
+	// clients have no API key and cannot log in or record hits.
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+
+	// Start of the first billing period (registration date when unset)
+	BillingAnchor *time.Time `json:"billing_anchor,omitempty"`
+
+	// Temporary boosts, loaded only with the plan
+	Boosts []LimitBoost `gorm:"foreignKey:ClientID" json:"-"`
+
+	// Per-client overrides of the plan's limits
+	HourlyLimitOverride  *int `json:"hourly_limit_override,omitempty"`
+	DailyLimitOverride   *int `json:"daily_limit_override,omitempty"`
+	MonthlyLimitOverride *int `json:"monthly_limit_override,omitempty"`
 }
 
-// BeforeCreate hook to generate UUID and ClientID
+// BeforeCreate hook to generate UUID and ClientID and to default the role
 func (c *Client) BeforeCreate(tx *gorm.DB) error {
 	if c.ID == uuid.Nil {
 		c.ID = uuid.New()
@@ -27,9 +47,105 @@ func (c *Client) BeforeCreate(tx *gorm.DB) error {
 	if c.ClientID == "" {
 		c.ClientID = "client_" + uuid.New().String()[:8]
 	}
+	if c.Role == "" {
+		c.Role = RoleClient
+	}
 	return nil
 }
 
+// Verified reports whether the client verified its email address
+func (c *Client) Verified() bool {
+	return c.EmailVerifiedAt != nil
+}
+
+// Overrides returns the per-client limit overrides
+func (c *Client) Overrides() LimitOverrides {
+	return LimitOverrides{
+		Hourly:  c.HourlyLimitOverride,
+		Daily:   c.DailyLimitOverride,
+		Monthly: c.MonthlyLimitOverride,
+	}
+}
+
+// EffectiveLimits returns the limits enforced for the client: the plan's limits
+// (or defaults when no plan is loaded) with the per-client overrides and the
+// active boosts applied
+func (c *Client) EffectiveLimits(defaults RateLimits) RateLimits {
+	limits := defaults
+	if c.Plan != nil {
+		limits = c.Plan.Limits()
+	}
+
+	if c.HourlyLimitOverride != nil {
+		limits.Hourly = *c.HourlyLimitOverride
+	}
+	if c.DailyLimitOverride != nil {
+		limits.Daily = *c.DailyLimitOverride
+	}
+	if c.MonthlyLimitOverride != nil {
+		limits.Monthly = *c.MonthlyLimitOverride
+	}
+
+	// Boosts raise limits but never turn unlimited ones into limited ones
+	now := time.Now()
+	for _, b := range c.Boosts {
+		if !b.ActiveAt(now) {
+			continue
+		}
+		if limits.Hourly > 0 {
+			limits.Hourly += b.Hourly
+		}
+		if limits.Daily > 0 {
+			limits.Daily += b.Daily
+		}
+		if limits.Monthly > 0 {
+			limits.Monthly += b.Monthly
+		}
+	}
+
+	return limits
+}
+
+// NextBoostExpiry returns when the first active boost of the client expires
+func (c *Client) NextBoostExpiry() (time.Time, bool) {
+	var next time.Time
+	now := time.Now()
+	for _, b := range c.Boosts {
+		if b.ActiveAt(now) && (next.IsZero() || b.ExpiresAt.Before(next)) {
+			next = b.ExpiresAt
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// BillingCycleAnchor returns the date the client's monthly billing periods are anchored to
+func (c *Client) BillingCycleAnchor() time.Time {
+	if c.BillingAnchor != nil {
+		return *c.BillingAnchor
+	}
+	return c.CreatedAt
+}
+
+// Quota returns the monthly quota of the client's plan, raised by the active
+// boosts, and how it is enforced. Clients without a plan have no quota.
+func (c *Client) Quota() (int, QuotaMode) {
+	if c.Plan == nil {
+		return 0, QuotaSoft
+	}
+
+	quota := c.Plan.MonthlyQuota
+	if quota > 0 {
+		now := time.Now()
+		for _, b := range c.Boosts {
+			if b.ActiveAt(now) {
+				quota += b.Quota
+			}
+		}
+	}
+
+	return quota, c.Plan.QuotaMode
+}
+
 // TableName specifies the table name for Client
 func (Client) TableName() string {
 	return "clients"
@@ -42,7 +158,10 @@ type ClientResponse struct {
 	ClientID  string    `json:"client_id" example:"client_abc12345"`               // Human-readable client ID
 	Name      string    `json:"name" example:"John Doe"`                           // Client name
 	Email     string    `json:"email" example:"john.doe@example.com"`              // Client email
-	APIKey    string    `json:"api_key,omitempty" example:"sk_live_abcdef123456"`  // API key (only shown on registration)
+	Role      string    `json:"role" example:"client"`                             // admin, client or analyst
+	Verified  bool      `json:"email_verified" example:"true"`                     // Whether the email address was verified
+	APIKey    string    `json:"api_key,omitempty" example:"sk_live_abcdef123456"`  // API key (only shown once the email address is verified)
+	KeyPrefix string    `json:"api_key_prefix,omitempty" example:"sk_live_"`       // Public prefix of the API key (only shown once the email address is verified)
 	CreatedAt time.Time `json:"created_at" example:"2025-01-15T10:30:00Z"`         // Creation timestamp
 }
 
@@ -53,10 +172,13 @@ func (c *Client) ToResponse(includeAPIKey bool) *ClientResponse {
 		ClientID:  c.ClientID,
 		Name:      c.Name,
 		Email:     c.Email,
+		Role:      c.Role,
+		Verified:  c.Verified(),
 		CreatedAt: c.CreatedAt,
 	}
-	if includeAPIKey {
-		resp.APIKey = c.APIKey
+	if includeAPIKey && len(c.APIKeys) > 0 {
+		resp.APIKey = c.APIKeys[0].Key
+		resp.KeyPrefix = c.APIKeys[0].Prefix
 	}
 	return resp
 }
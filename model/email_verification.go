@@ -0,0 +1,44 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EmailVerification is a single-use token sent to the email address of a new
+// client. Only the hash of the token is stored.
+type EmailVerification struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	ClientID  uuid.UUID  `gorm:"type:uuid;not null;index" json:"client_id"`
+	TokenHash string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (v *EmailVerification) BeforeCreate(tx *gorm.DB) error {
+	if v.ID == uuid.Nil {
+		v.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName specifies the table name for EmailVerification
+func (EmailVerification) TableName() string {
+	return "email_verifications"
+}
+
+// VerifyEmailRequest represents the request body for verifying an email address
+// @Description Request body for verifying the email address of a new client
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required" example:"q8Zk3..."` // Token from the verification email
+}
+
+// ResendVerificationRequest represents the request body for resending a verification email
+// @Description Request body for requesting a new verification email
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email" example:"john.doe@example.com"` // Email address used to register
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LatencyRollup counts the hits of a route template that fell into one latency
+// bucket during one hour. Rows are mergeable histograms: percentiles over any
+// window are computed by summing the counts of its hours.
+type LatencyRollup struct {
+	ClientID         uuid.UUID `gorm:"type:uuid;primaryKey" json:"client_id"`
+	EndpointTemplate string    `gorm:"primaryKey" json:"endpoint_template"`
+	BucketStart      time.Time `gorm:"primaryKey" json:"bucket_start"`
+	Bucket           int       `gorm:"primaryKey;autoIncrement:false" json:"bucket"`
+	Count            int64     `gorm:"not null;default:0" json:"count"`
+}
+
+// TableName specifies the table name for LatencyRollup
+func (LatencyRollup) TableName() string {
+	return "latency_rollups"
+}
+
+// ClientLatency represents the latency percentiles of a client
+// @Description Latency percentiles of a client over a window
+type ClientLatency struct {
+	ClientID   uuid.UUID `json:"client_id" example:"550e8400-e29b-41d4-a716-446655440000"` // Client UUID
+	ClientName string    `json:"client_name" example:"John Doe"`                           // Client name
+	Count      int64     `json:"count" example:"1000"`                                     // Hits with a reported duration
+	P50        float64   `json:"p50_ms" example:"42.1"`                                    // Median duration in milliseconds
+	P90        float64   `json:"p90_ms" example:"120.4"`                                   // 90th percentile duration in milliseconds
+	P99        float64   `json:"p99_ms" example:"480.9"`                                   // 99th percentile duration in milliseconds
+}
+
+// EndpointLatency represents the latency percentiles of a route template
+// @Description Latency percentiles of a route template over a window
+type EndpointLatency struct {
+	Endpoint string  `json:"endpoint" example:"/api/v1/users/:id"` // Route template
+	Count    int64   `json:"count" example:"1000"`                 // Hits with a reported duration
+	P50      float64 `json:"p50_ms" example:"42.1"`                // Median duration in milliseconds
+	P90      float64 `json:"p90_ms" example:"120.4"`               // 90th percentile duration in milliseconds
+	P99      float64 `json:"p99_ms" example:"480.9"`               // 99th percentile duration in milliseconds
+}
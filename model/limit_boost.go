@@ -0,0 +1,52 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LimitBoost temporarily raises the limits and monthly quota of a client. The
+// extra requests are added to every limit that is not unlimited until the
+// boost expires.
+type LimitBoost struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	ClientID  uuid.UUID `gorm:"type:uuid;not null;index" json:"client_id"`
+	Hourly    int       `gorm:"not null;default:0" json:"hourly"`
+	Daily     int       `gorm:"not null;default:0" json:"daily"`
+	Monthly   int       `gorm:"not null;default:0" json:"monthly"`
+	Quota     int       `gorm:"not null;default:0" json:"quota"`
+	Reason    string    `gorm:"size:255;not null;default:''" json:"reason"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (b *LimitBoost) BeforeCreate(tx *gorm.DB) error {
+	if b.ID == uuid.Nil {
+		b.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName specifies the table name for LimitBoost
+func (LimitBoost) TableName() string {
+	return "limit_boosts"
+}
+
+// ActiveAt reports whether the boost applies at t
+func (b *LimitBoost) ActiveAt(t time.Time) bool {
+	return b.ExpiresAt.After(t)
+}
+
+// GrantBoostRequest represents the request body for granting a temporary boost
+// @Description Request body for granting a temporary limit and quota boost
+type GrantBoostRequest struct {
+	Hourly   int    `json:"hourly" example:"1000"`                            // Extra requests per hour
+	Daily    int    `json:"daily" example:"10000"`                            // Extra requests per day
+	Monthly  int    `json:"monthly" example:"0"`                              // Extra requests per 30 days
+	Quota    int    `json:"quota" example:"50000"`                            // Extra hits in the monthly quota
+	Duration string `json:"duration" validate:"required" example:"24h"`       // How long the boost lasts, such as 1h, 24h or 7d (max 90d)
+	Reason   string `json:"reason" example:"Wrongly throttled during launch"` // Why the boost was granted
+}
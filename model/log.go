@@ -9,13 +9,21 @@ import (
 
 // APILog represents an API request log entry
 type APILog struct {
-	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
-	ClientID  uuid.UUID `gorm:"type:uuid;index:idx_client_timestamp;not null" json:"client_id"`
-	APIKey    string    `gorm:"index;not null" json:"-"`
-	IP        string    `gorm:"not null" json:"ip"`
-	Endpoint  string    `gorm:"index;not null" json:"endpoint"`
-	Timestamp time.Time `gorm:"index:idx_client_timestamp;not null" json:"timestamp"`
-	CreatedAt time.Time `json:"created_at"`
+	ID               uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	ClientID         uuid.UUID  `gorm:"type:uuid;index:idx_client_timestamp;not null" json:"client_id"`
+	APIKeyID         *uuid.UUID `gorm:"type:uuid;index" json:"api_key_id,omitempty"`
+	IP               string     `gorm:"not null" json:"ip"`
+	Endpoint         string     `gorm:"index;not null" json:"endpoint"`
+	EndpointTemplate string     `gorm:"not null;default:''" json:"endpoint_template"`
+	EventID          *string    `gorm:"size:255" json:"event_id,omitempty"`
+	Method           string     `gorm:"size:10;not null;default:''" json:"method,omitempty"`
+	StatusCode       int        `gorm:"not null;default:0" json:"status_code,omitempty"`
+	RequestBytes     int64      `gorm:"not null;default:0" json:"request_bytes"`
+	ResponseBytes    int64      `gorm:"not null;default:0" json:"response_bytes"`
+	UserAgent        string     `gorm:"size:512;not null;default:''" json:"user_agent,omitempty"`
+	DurationMs       *float64   `json:"duration_ms,omitempty"`
+	Timestamp        time.Time  `gorm:"index:idx_client_timestamp;not null" json:"timestamp"`
+	CreatedAt        time.Time  `json:"created_at"`
 }
 
 // BeforeCreate hook to generate UUID and set timestamp
@@ -51,3 +59,49 @@ type TopClient struct {
 	Email         string    `json:"email" example:"john.doe@example.com"`                     // Client email
 	TotalRequests int64     `json:"total_requests" example:"500"`                             // Total API requests
 }
+
+// EndpointUsage represents the request count of an endpoint or route template
+// @Description API usage of an endpoint or route template
+type EndpointUsage struct {
+	Endpoint string `json:"endpoint" example:"/api/v1/users/:id"` // Route template (or raw endpoint)
+	Count    int64  `json:"count" example:"1520"`                 // Number of API requests
+}
+
+// ClientErrorRate represents the error rate of a client
+// @Description Error rate of a client (hits without a status code are not counted)
+type ClientErrorRate struct {
+	ClientID      uuid.UUID `json:"client_id" example:"550e8400-e29b-41d4-a716-446655440000"` // Client UUID
+	ClientName    string    `json:"client_name" example:"John Doe"`                           // Client name
+	TotalRequests int64     `json:"total_requests" example:"1000"`                            // Requests with a known status code
+	ClientErrors  int64     `json:"client_errors" example:"40"`                               // 4xx responses
+	ServerErrors  int64     `json:"server_errors" example:"10"`                               // 5xx responses
+	ErrorRate     float64   `json:"error_rate" example:"0.05"`                                // (4xx + 5xx) / total
+}
+
+// EndpointErrorRate represents the error rate of a route template
+// @Description Error rate of a route template (hits without a status code are not counted)
+type EndpointErrorRate struct {
+	Endpoint      string  `json:"endpoint" example:"/api/v1/users/:id"` // Route template
+	TotalRequests int64   `json:"total_requests" example:"1000"`        // Requests with a known status code
+	ClientErrors  int64   `json:"client_errors" example:"40"`           // 4xx responses
+	ServerErrors  int64   `json:"server_errors" example:"10"`           // 5xx responses
+	ErrorRate     float64 `json:"error_rate" example:"0.05"`            // (4xx + 5xx) / total
+}
+
+// StatusClassCount represents the number of hits in a status class
+// @Description Number of API hits per status class
+type StatusClassCount struct {
+	Class      string  `json:"class" example:"2xx"`     // Status class (1xx-5xx, or unknown)
+	Count      int64   `json:"count" example:"950"`     // Number of API requests
+	Percentage float64 `json:"percentage" example:"95"` // Share of all requests in the window
+}
+
+// BatchLogResult reports the outcome of a single entry in a batch log request
+// @Description Outcome of a single entry in a batch log request
+type BatchLogResult struct {
+	Index    int        `json:"index" example:"0"`                                               // Position of the entry in the request
+	Accepted bool       `json:"accepted" example:"true"`                                         // Whether the entry was recorded
+	Replayed bool       `json:"replayed,omitempty" example:"false"`                              // Whether the entry had already been recorded under its event_id
+	LogID    *uuid.UUID `json:"log_id,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"` // ID of the recorded log (accepted entries only)
+	Error    string     `json:"error,omitempty" example:"invalid IP address format"`             // Reason the entry was rejected
+}
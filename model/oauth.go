@@ -0,0 +1,43 @@
+package model
+
+// OAuth 2.0 error codes (RFC 6749 section 5.2, RFC 7009 section 2.2.1)
+const (
+	OAuthInvalidRequest         = "invalid_request"
+	OAuthInvalidClient          = "invalid_client"
+	OAuthInvalidScope           = "invalid_scope"
+	OAuthUnauthorizedClient     = "unauthorized_client"
+	OAuthUnsupportedGrantType   = "unsupported_grant_type"
+	OAuthServerError            = "server_error"
+	OAuthTemporarilyUnavailable = "temporarily_unavailable"
+)
+
+// OAuthTokenResponse is a successful response of the OAuth token endpoint (RFC 6749 section 5.1)
+// @Description Access token issued by the OAuth token endpoint
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token" example:"eyJhbGciOiJSUzI1NiIs..."` // JWT access token
+	TokenType   string `json:"token_type" example:"Bearer"`                    // Always Bearer
+	ExpiresIn   int    `json:"expires_in" example:"900"`                       // Lifetime of the access token in seconds
+	Scope       string `json:"scope" example:"logs:write usage:read"`          // Space-separated scopes granted
+}
+
+// OAuthErrorResponse is an error response of the OAuth endpoints (RFC 6749 section 5.2)
+// @Description Error returned by the OAuth endpoints
+type OAuthErrorResponse struct {
+	Error            string `json:"error" example:"invalid_client"`                                   // Error code
+	ErrorDescription string `json:"error_description,omitempty" example:"Invalid client credentials"` // Human-readable description
+}
+
+// IntrospectionResponse describes a token as returned by the introspection endpoint (RFC 7662 section 2.2)
+// @Description State of a token. Only active is set for inactive tokens.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active" example:"true"`                                        // Whether the token is currently usable
+	Scope     string `json:"scope,omitempty" example:"logs:write usage:read"`              // Space-separated scopes of the token
+	ClientID  string `json:"client_id,omitempty" example:"client_abc12345"`                // Client the token was issued to
+	TokenType string `json:"token_type,omitempty" example:"Bearer"`                        // Bearer or refresh_token
+	Exp       int64  `json:"exp,omitempty" example:"1736937000"`                           // Expiry as a Unix timestamp
+	Iat       int64  `json:"iat,omitempty" example:"1736936100"`                           // Issue time as a Unix timestamp
+	Nbf       int64  `json:"nbf,omitempty" example:"1736936100"`                           // Not valid before, as a Unix timestamp
+	Sub       string `json:"sub,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"` // Client UUID
+	Jti       string `json:"jti,omitempty" example:"6f1c2a1e-8a4b-4f0e-9d55-2b1a2c3d4e5f"` // Token ID
+	Role      string `json:"role,omitempty" example:"client"`                              // Role of the client
+}
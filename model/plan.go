@@ -0,0 +1,110 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Built-in plan names
+const (
+	PlanFree       = "free"
+	PlanPro        = "pro"
+	PlanEnterprise = "enterprise"
+)
+
+// QuotaMode decides what happens once a client has used up its monthly quota
+type QuotaMode string
+
+// Quota modes
+const (
+	QuotaHard QuotaMode = "hard" // Refuse hits beyond the quota
+	QuotaSoft QuotaMode = "soft" // Accept hits beyond the quota and record them as overage
+)
+
+// Plan is a pricing tier with its rate limits and monthly quota. A limit or
+// quota of 0 means unlimited.
+type Plan struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	Name         string    `gorm:"uniqueIndex;not null" json:"name"`
+	HourlyLimit  int       `gorm:"not null;default:0" json:"hourly_limit"`
+	DailyLimit   int       `gorm:"not null;default:0" json:"daily_limit"`
+	MonthlyLimit int       `gorm:"not null;default:0" json:"monthly_limit"`
+	MonthlyQuota int       `gorm:"not null;default:0" json:"monthly_quota"` // Hits per billing period
+	QuotaMode    QuotaMode `gorm:"not null;default:hard" json:"quota_mode"` // hard or soft
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (p *Plan) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName specifies the table name for Plan
+func (Plan) TableName() string {
+	return "plans"
+}
+
+// Limits returns the rate limits of the plan
+func (p *Plan) Limits() RateLimits {
+	return RateLimits{
+		Hourly:  p.HourlyLimit,
+		Daily:   p.DailyLimit,
+		Monthly: p.MonthlyLimit,
+	}
+}
+
+// RateLimits holds the request limits of a client per window. A limit of 0 means unlimited.
+// @Description Request limits per window (0 means unlimited)
+type RateLimits struct {
+	Hourly  int `json:"hourly" example:"1000"`    // Requests per hour
+	Daily   int `json:"daily" example:"10000"`    // Requests per day
+	Monthly int `json:"monthly" example:"100000"` // Requests per 30 days
+}
+
+// LimitOverrides holds per-client limits that replace the plan's. Nil leaves the plan's limit in place.
+// @Description Per-client limits that replace the plan's (null keeps the plan's limit, 0 means unlimited)
+type LimitOverrides struct {
+	Hourly  *int `json:"hourly" example:"5000"`  // Requests per hour
+	Daily   *int `json:"daily" example:"50000"`  // Requests per day
+	Monthly *int `json:"monthly" example:"null"` // Requests per 30 days
+}
+
+// ClientLimits describes how a client's effective limits are derived
+// @Description Plan, overrides and effective rate limits of a client
+type ClientLimits struct {
+	ClientID  string         `json:"client_id" example:"client_abc12345"` // Human-readable client ID
+	Plan      string         `json:"plan" example:"pro"`                  // Assigned plan (empty when none)
+	Overrides LimitOverrides `json:"overrides"`                           // Per-client overrides
+	Effective RateLimits     `json:"effective"`                           // Limits enforced for the client
+}
+
+// RateLimitCounter is the current state of one of a client's rate limits
+// @Description Current state of a rate limit window or rule
+type RateLimitCounter struct {
+	Name          string    `json:"name" example:"hour"`                     // Plan window (hour, day or month) or rule name
+	Limit         int       `json:"limit" example:"1000"`                    // Maximum requests per window
+	WindowSeconds int       `json:"window_seconds" example:"3600"`           // Length of the window in seconds
+	Remaining     int       `json:"remaining" example:"998"`                 // Requests still available
+	ResetAt       time.Time `json:"reset_at" example:"2025-01-15T11:30:00Z"` // When the window is fully available again
+}
+
+// ClientRateLimitState describes the counters, quota and boosts of a client
+// @Description Current rate limit counters, monthly quota and active boosts of a client
+type ClientRateLimitState struct {
+	ClientLimits
+	Counters []RateLimitCounter `json:"counters"` // State of every limit that applies
+	Quota    QuotaUsage         `json:"quota"`    // Consumption of the current billing period
+	Boosts   []LimitBoost       `json:"boosts"`   // Active boosts
+}
+
+// AssignPlanRequest represents the request body for assigning a plan to a client
+// @Description Request body for assigning a plan to a client
+type AssignPlanRequest struct {
+	Plan string `json:"plan" validate:"required" example:"pro"` // Plan name (free, pro or enterprise)
+}
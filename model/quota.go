@@ -0,0 +1,71 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// QuotaPeriod tracks the hits a client recorded during one billing period. The
+// quota and mode are those of the client's plan when the period was last charged.
+type QuotaPeriod struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	ClientID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_quota_periods_client_start" json:"client_id"`
+	PeriodStart time.Time `gorm:"not null;uniqueIndex:idx_quota_periods_client_start" json:"period_start"`
+	PeriodEnd   time.Time `gorm:"not null" json:"period_end"`
+	Quota       int       `gorm:"not null;default:0" json:"quota"`
+	Mode        QuotaMode `gorm:"not null;default:hard" json:"mode"`
+	Used        int64     `gorm:"not null;default:0" json:"used"`
+	Overage     int64     `gorm:"not null;default:0" json:"overage"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (q *QuotaPeriod) BeforeCreate(tx *gorm.DB) error {
+	if q.ID == uuid.Nil {
+		q.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName specifies the table name for QuotaPeriod
+func (QuotaPeriod) TableName() string {
+	return "quota_periods"
+}
+
+// ToUsage converts QuotaPeriod to QuotaUsage
+func (q *QuotaPeriod) ToUsage() QuotaUsage {
+	usage := QuotaUsage{
+		PeriodStart: q.PeriodStart,
+		PeriodEnd:   q.PeriodEnd,
+		Quota:       q.Quota,
+		Mode:        q.Mode,
+		Used:        q.Used,
+		Overage:     q.Overage,
+	}
+	if q.Quota > 0 {
+		remaining := max(int64(q.Quota)-q.Used, 0)
+		usage.Remaining = &remaining
+	}
+	return usage
+}
+
+// QuotaUsage represents the consumption of a client during one billing period
+// @Description Quota consumption during a billing period
+type QuotaUsage struct {
+	PeriodStart time.Time `json:"period_start" example:"2025-01-15T10:30:00Z"` // Start of the billing period
+	PeriodEnd   time.Time `json:"period_end" example:"2025-02-15T10:30:00Z"`   // End of the billing period (exclusive)
+	Quota       int       `json:"quota" example:"100000"`                      // Hits included in the period (0 means unlimited)
+	Mode        QuotaMode `json:"mode" example:"soft"`                         // hard (refuse hits beyond the quota) or soft (record overage)
+	Used        int64     `json:"used" example:"104250"`                       // Hits recorded in the period
+	Remaining   *int64    `json:"remaining" example:"0"`                       // Hits left in the quota (null when unlimited)
+	Overage     int64     `json:"overage" example:"4250"`                      // Hits beyond a soft quota
+}
+
+// BillingAnchorRequest represents the request body for moving a client's billing cycle
+// @Description Request body for moving a client's billing cycle
+type BillingAnchorRequest struct {
+	BillingAnchor time.Time `json:"billing_anchor" validate:"required" example:"2025-01-15T00:00:00Z"` // Start of a billing period; later periods start on the same day of the month
+}
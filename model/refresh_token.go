@@ -0,0 +1,43 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RefreshToken is an opaque, single-use token that is exchanged for a new
+// access token. Every login starts a family, and each refresh replaces the
+// used token with a new one of the same family. A family ends with the API
+// key it was started with. Only the hash of the token is stored.
+type RefreshToken struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	FamilyID  uuid.UUID  `gorm:"type:uuid;not null;index" json:"family_id"`
+	ClientID  uuid.UUID  `gorm:"type:uuid;not null;index" json:"client_id"`
+	APIKeyID  *uuid.UUID `gorm:"type:uuid;index" json:"api_key_id,omitempty"` // API key used to log in (unset for sessions started before keys were tracked)
+	TokenHash string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Scopes    string     `gorm:"size:255;not null;check:chk_refresh_tokens_scopes,scopes <> ''" json:"scopes"` // Scopes inherited from the API key used to log in
+	ExpiresAt time.Time  `gorm:"not null;index" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (t *RefreshToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName specifies the table name for RefreshToken
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// ActiveAt reports whether the token can still be exchanged at t
+func (t *RefreshToken) ActiveAt(at time.Time) bool {
+	return t.RevokedAt == nil && t.UsedAt == nil && at.Before(t.ExpiresAt)
+}
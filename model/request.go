@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 // RegisterRequest represents the request body for client registration
 // @Description Request body for registering a new client
 type RegisterRequest struct {
@@ -7,12 +9,54 @@ type RegisterRequest struct {
 	Email string `json:"email" validate:"required,email" example:"john.doe@example.com"` // Valid email address
 }
 
+// LogDetails holds the optional HTTP details of a logged API hit
+// @Description Optional HTTP details of an API hit
+type LogDetails struct {
+	Method        string   `json:"method,omitempty" example:"GET"`                   // HTTP method
+	StatusCode    int      `json:"status_code,omitempty" example:"200"`              // HTTP response status code (100-599)
+	RequestBytes  int64    `json:"request_bytes,omitempty" example:"512"`            // Size of the request body in bytes
+	ResponseBytes int64    `json:"response_bytes,omitempty" example:"2048"`          // Size of the response body in bytes
+	UserAgent     string   `json:"user_agent,omitempty" example:"Mozilla/5.0 (X11)"` // User agent of the caller
+	DurationMs    *float64 `json:"duration_ms,omitempty" example:"42.5"`             // Time taken to serve the request in milliseconds
+}
+
 // LogRequest represents the request body for logging API hits
 // @Description Request body for recording an API hit
 type LogRequest struct {
-	APIKey   string `json:"api_key" validate:"required" example:"sk_live_abcdef123456"` // Client's API key
-	IP       string `json:"ip" validate:"required,ip" example:"192.168.1.100"`          // Client's IP address
-	Endpoint string `json:"endpoint" validate:"required" example:"/api/v1/users"`       // API endpoint that was called
+	LogDetails
+	APIKey   string `json:"api_key,omitempty" example:"sk_live_abcdef123456"`     // Deprecated: send the key in the X-API-Key header
+	IP       string `json:"ip" validate:"required,ip" example:"192.168.1.100"`    // Client's IP address
+	Endpoint string `json:"endpoint" validate:"required" example:"/api/v1/users"` // API endpoint that was called
+	EventID  string `json:"event_id,omitempty" example:"evt_01HQ3Z5K8M"`          // Unique event ID used to deduplicate retries (alternative to the Idempotency-Key header)
+}
+
+// BatchLogEntry represents a single API hit inside a batch request
+// @Description A single API hit inside a batch log request
+type BatchLogEntry struct {
+	LogDetails
+	IP        string     `json:"ip" validate:"required,ip" example:"192.168.1.100"`    // Client's IP address
+	Endpoint  string     `json:"endpoint" validate:"required" example:"/api/v1/users"` // API endpoint that was called
+	Timestamp *time.Time `json:"timestamp,omitempty" example:"2025-01-15T10:30:00Z"`   // Time of the hit (defaults to the time the batch is received)
+	EventID   string     `json:"event_id,omitempty" example:"evt_01HQ3Z5K8M"`          // Unique event ID used to deduplicate retries
+}
+
+// BatchLogRequest represents the request body for logging several API hits at once
+// @Description Request body for recording a batch of API hits for one client
+type BatchLogRequest struct {
+	APIKey string          `json:"api_key,omitempty" example:"sk_live_abcdef123456"` // Deprecated: send the key in the X-API-Key header
+	Logs   []BatchLogEntry `json:"logs" validate:"required,min=1,max=1000"`          // API hits to record (1-1000 entries)
+}
+
+// RouteTemplateRequest represents the request body for creating a route template
+// @Description Request body for creating a route template rule
+type RouteTemplateRequest struct {
+	Pattern string `json:"pattern" validate:"required" example:"/api/v1/users/:id"` // Route template; ":name" matches one segment, a trailing "*" matches the rest
+}
+
+// RefreshTokenRequest represents the request body for refreshing or revoking a session
+// @Description Request body carrying a refresh token
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required" example:"3q2-7wAAAAB..."` // Refresh token returned by login or the last refresh
 }
 
 // LoginRequest represents the request body for authentication
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Roles decide which parts of the API a client may use, on top of the scopes
+// of its API key or access token
+const (
+	RoleAdmin   = "admin"   // Global analytics and lookups of any client
+	RoleClient  = "client"  // Records API hits and reads its own usage
+	RoleAnalyst = "analyst" // Reads its own usage, read-only
+)
+
+// AllRoles lists every role
+var AllRoles = []string{RoleAdmin, RoleClient, RoleAnalyst}
+
+// ParseRole validates a role
+func ParseRole(role string) (string, error) {
+	if !slices.Contains(AllRoles, role) {
+		return "", fmt.Errorf("unknown role %q, use %s", role, strings.Join(AllRoles, ", "))
+	}
+	return role, nil
+}
+
+// SetRoleRequest represents the request body for changing the role of a client
+// @Description Request body for changing the role of a client
+type SetRoleRequest struct {
+	Role string `json:"role" validate:"required" example:"analyst"` // admin, client or analyst
+}
@@ -0,0 +1,29 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RouteTemplate is a client-defined rule that maps raw endpoints to a route template
+type RouteTemplate struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	ClientID  uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_route_templates_client_pattern;not null" json:"client_id"`
+	Pattern   string    `gorm:"uniqueIndex:idx_route_templates_client_pattern;not null" json:"pattern"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BeforeCreate hook to generate UUID
+func (r *RouteTemplate) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName specifies the table name for RouteTemplate
+func (RouteTemplate) TableName() string {
+	return "route_templates"
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scopes limit what an API key, and the access tokens obtained with it, may do
+const (
+	ScopeLogsWrite   = "logs:write"   // Record API hits
+	ScopeUsageRead   = "usage:read"   // Read usage analytics and quotas
+	ScopeStreamRead  = "stream:read"  // Subscribe to real-time usage streams
+	ScopeRoutesWrite = "routes:write" // Manage route templates
+	ScopeKeysWrite   = "keys:write"   // Manage API keys
+)
+
+// AllScopes lists every scope, in the order scopes are reported
+var AllScopes = []string{ScopeLogsWrite, ScopeUsageRead, ScopeStreamRead, ScopeRoutesWrite, ScopeKeysWrite}
+
+// ParseScopes validates scopes and returns them without duplicates, in the
+// order of AllScopes
+func ParseScopes(scopes []string) ([]string, error) {
+	for _, scope := range scopes {
+		if !slices.Contains(AllScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q, use %s", scope, strings.Join(AllScopes, ", "))
+		}
+	}
+
+	parsed := make([]string, 0, len(scopes))
+	for _, scope := range AllScopes {
+		if slices.Contains(scopes, scope) {
+			parsed = append(parsed, scope)
+		}
+	}
+	return parsed, nil
+}
+
+// SplitScopes splits a space-separated scope string, as stored and as used in
+// the scope claim of access tokens
+func SplitScopes(scope string) []string {
+	return strings.Fields(scope)
+}
+
+// JoinScopes joins scopes into a space-separated scope string
+func JoinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// HasScopes reports whether granted contains every scope in required
+func HasScopes(granted []string, required ...string) bool {
+	for _, scope := range required {
+		if !slices.Contains(granted, scope) {
+			return false
+		}
+	}
+	return true
+}
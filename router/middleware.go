@@ -1,9 +1,25 @@
 package router
 
 import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"nexmedis-golang/model"
+	"nexmedis-golang/store"
 	"nexmedis-golang/utils"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
 )
 
 // JWTMiddleware validates JWT tokens
@@ -34,33 +50,217 @@ func JWTMiddleware() echo.MiddlewareFunc {
 				return utils.UnauthorizedResponse(c, "Invalid or expired token")
 			}
 
+			// Reject revoked tokens. Without Redis the denylist cannot be
+			// consulted and tokens are accepted until they expire.
+			revoked, err := utils.IsTokenRevoked(c.Request().Context(), claims)
+			if err != nil {
+				log.Warnf("Failed to check token revocation: %v", err)
+			}
+			if revoked {
+				return utils.UnauthorizedResponse(c, "Token has been revoked")
+			}
+
 			// Set client information in context
 			c.Set("client_id", claims.ClientID.String())
 			c.Set("email", claims.Email)
+			c.Set("jwt_claims", claims)
+			c.Set("scopes", claims.Scopes())
+			c.Set("role", claims.RoleName())
+
+			return next(c)
+		}
+	}
+}
+
+// RequireScope rejects requests whose API key or access token, as resolved
+// by APIKeyMiddleware or JWTMiddleware, does not grant every given scope
+func RequireScope(scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			granted, _ := c.Get("scopes").([]string)
+			if !model.HasScopes(granted, scopes...) {
+				return utils.ForbiddenResponse(c, "Missing required scope: "+strings.Join(scopes, " "))
+			}
+			return next(c)
+		}
+	}
+}
 
+// RequireRole rejects requests whose client, as resolved by APIKeyMiddleware
+// or JWTMiddleware, has none of the given roles
+func RequireRole(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role, _ := c.Get("role").(string)
+			if !slices.Contains(roles, role) {
+				return utils.ForbiddenResponse(c, "This endpoint requires one of the roles: "+strings.Join(roles, ", "))
+			}
 			return next(c)
 		}
 	}
 }
 
+// APIKeyMiddleware authenticates ingestion requests by the X-API-Key header and
+// puts the resolved client in the context. When allowBodyKey is set, requests
+// without the header may still send the key as "api_key" in the JSON body.
+func APIKeyMiddleware(apiKeyStore *store.APIKeyStore, allowBodyKey bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			apiKey := c.Request().Header.Get("X-API-Key")
+
+			// Deprecated: fall back to the key in the request body
+			if apiKey == "" && allowBodyKey {
+				bodyKey, err := readBodyAPIKey(c)
+				if err != nil {
+					return utils.BadRequestResponse(c, "Invalid request body")
+				}
+				if bodyKey != "" {
+					apiKey = bodyKey
+					c.Response().Header().Set("Deprecation", "true")
+					c.Response().Header().Set("Warning", `299 - "api_key in the request body is deprecated, use the X-API-Key header"`)
+				}
+			}
+
+			if apiKey == "" {
+				return utils.UnauthorizedResponse(c, "X-API-Key header required")
+			}
+
+			if err := utils.ValidateAPIKey(apiKey); err != nil {
+				return utils.BadRequestResponse(c, err.Error())
+			}
+
+			// Resolve the client once for the whole request
+			key, err := apiKeyStore.Authenticate(apiKey)
+			if err != nil {
+				if errors.Is(err, store.ErrClientUnverified) {
+					return utils.ForbiddenResponse(c, "Email address not verified")
+				}
+				return utils.UnauthorizedResponse(c, "Invalid API key")
+			}
+
+			c.Set("api_client", key.Client)
+			c.Set("api_key", key)
+			c.Set("client_id", key.ClientID.String())
+			c.Set("scopes", key.ScopeList())
+			c.Set("role", key.Client.Role)
+
+			return next(c)
+		}
+	}
+}
+
+// readBodyAPIKey reads the api_key field from a JSON body and restores the body
+// so the handler can bind it again
+func readBodyAPIKey(c echo.Context) (string, error) {
+	req := c.Request()
+	if req.Body == nil {
+		return "", nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	var payload struct {
+		APIKey string `json:"api_key"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		// Not a JSON object; let the handler report the binding error
+		return "", nil
+	}
+
+	return payload.APIKey, nil
+}
+
+// RateLimitHeaders reports the client's rate limit state on every response of
+// an identified client. Handlers that charge the limit store the result under
+// "rate_limit" in the context; otherwise the current state is looked up
+// without charging anything. Every 429 response gets a Retry-After header.
 func RateLimitHeaders(limiter *utils.RateLimiter) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			// Execute the handler first
-			err := next(c)
+			c.Response().Before(func() {
+				result, ok := c.Get("rate_limit").(utils.RateLimitResult)
+				if !ok {
+					if clientIDStr, isSet := c.Get("client_id").(string); isSet {
+						if clientID, err := uuid.Parse(clientIDStr); err == nil {
+							result, _ = limiter.Take(c.Request().Context(), clientID, 0)
+						}
+					}
+				}
+
+				writeRateLimitHeaders(c.Response().Header(), result, c.Response().Status)
+			})
+
+			return next(c)
+		}
+	}
+}
+
+// writeRateLimitHeaders writes the X-RateLimit-* headers and the IETF
+// RateLimit and RateLimit-Policy headers for a rate limit result
+func writeRateLimitHeaders(header http.Header, result utils.RateLimitResult, status int) {
+	if status == http.StatusTooManyRequests && header.Get("Retry-After") == "" {
+		header.Set("Retry-After", strconv.Itoa(max(ceilSeconds(result.RetryAfter), 1)))
+	}
+
+	if len(result.Policies) == 0 {
+		return
+	}
+
+	// Seconds until the constraining window frees quota again
+	resetIn := result.Reset
+	if result.Remaining == 0 {
+		resetIn = result.RetryAfter
+	}
+
+	header.Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(resetIn).Unix(), 10))
+
+	policies := make([]string, len(result.Policies))
+	for i, p := range result.Policies {
+		policies[i] = fmt.Sprintf(`"%s";q=%d;w=%d`, p.Name, p.Limit, ceilSeconds(p.Window))
+	}
+	header.Set("RateLimit-Policy", strings.Join(policies, ", "))
+	header.Set("RateLimit", fmt.Sprintf(`"%s";r=%d;t=%d`, result.Policy, result.Remaining, ceilSeconds(resetIn)))
+}
+
+// ceilSeconds rounds a duration up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
 
-			// Add rate limit headers if client_id is in context
-			if clientIDStr, ok := c.Get("client_id").(string); ok {
-				// Parse client ID and get remaining requests
-				// This is a simplified version
-				c.Response().Header().Set("X-RateLimit-Limit", "1000")
-				c.Response().Header().Set("X-RateLimit-Remaining", "999")
-				_ = clientIDStr // Use the variable to avoid unused error
+// IPExtractor determines the client IP of requests. Without trusted proxies
+// the peer address is used and X-Forwarded-For and X-Real-IP are ignored, so
+// they cannot be spoofed to evade IP lockouts. Otherwise X-Forwarded-For is
+// followed back through the trusted proxies only.
+func IPExtractor(trustedProxies []string) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
 			}
+		}
 
-			return err
+		_, ipRange, err := net.ParseCIDR(proxy)
+		if err != nil {
+			log.Warnf("Ignoring invalid trusted proxy %q", proxy)
+			continue
 		}
+		options = append(options, echo.TrustIPRange(ipRange))
 	}
+
+	return echo.ExtractIPFromXFFHeader(options...)
 }
 
 // IPWhitelistMiddleware restricts access to specific IPs
@@ -89,6 +289,45 @@ func IPWhitelistMiddleware(allowedIPs []string) echo.MiddlewareFunc {
 	}
 }
 
+// AdminMiddleware guards admin routes. Admins sign in like any client and
+// send an access token of a client with the admin role. The named tokens are
+// only a bootstrap fallback, e.g. to promote the first admin, and are checked
+// when a request sends X-Admin-Token. The authenticated admin is put in the
+// context as "admin_actor" for the audit trail.
+func AdminMiddleware(tokens map[string]string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		requireAdmin := JWTMiddleware()(RequireRole(model.RoleAdmin)(func(c echo.Context) error {
+			c.Set("admin_actor", "client:"+c.Get("client_id").(string))
+			return next(c)
+		}))
+
+		return func(c echo.Context) error {
+			provided := c.Request().Header.Get("X-Admin-Token")
+			if provided == "" {
+				return requireAdmin(c)
+			}
+
+			if len(tokens) == 0 {
+				return utils.ForbiddenResponse(c, "Admin tokens are disabled")
+			}
+
+			// Compare against every token so the time taken does not reveal which matched
+			actor := ""
+			for name, token := range tokens {
+				if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1 {
+					actor = name
+				}
+			}
+			if actor == "" {
+				return utils.UnauthorizedResponse(c, "Invalid admin token")
+			}
+
+			c.Set("admin_actor", actor)
+			return next(c)
+		}
+	}
+}
+
 func ErrorHandler(err error, c echo.Context) {
 	code := 500
 	message := "Internal server error"
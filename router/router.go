@@ -2,6 +2,7 @@ package router
 
 import (
 	"nexmedis-golang/handler"
+	"nexmedis-golang/model"
 	"nexmedis-golang/store"
 	"nexmedis-golang/utils"
 	"time"
@@ -15,31 +16,79 @@ import (
 type Config struct {
 	DB                *gorm.DB
 	RateLimiter       *utils.RateLimiter
+	LogQueue          *store.LogQueue
+	QuotaStore        *store.QuotaStore // Counts quotas (in Postgres only when nil)
+	Idempotency       *utils.IdempotencyStore
 	CacheTTL          time.Duration
 	EnableIPWhitelist bool
 	AllowedIPs        []string
+	TrustedProxies    []string          // Proxies whose X-Forwarded-For is trusted (IPs or CIDRs)
+	AllowBodyAPIKey   bool              // Deprecated: accept api_key in the ingestion request body
+	AdminTokens       map[string]string // Bootstrap admin tokens by admin name (disabled when empty)
+	LoginGuard        *utils.LoginGuard
+	RegisterGuard     *utils.LoginGuard
+	Mailer            utils.Mailer               // Sends verification emails (written to ./outbox when nil)
+	Verification      handler.VerificationConfig // Verification token lifetime and link
 }
 
 // Setup configures all routes and middleware
 func Setup(e *echo.Echo, config Config) {
+	// Determine client IPs without trusting spoofable headers
+	e.IPExtractor = IPExtractor(config.TrustedProxies)
+
 	// Initialize stores
 	clientStore := store.NewClientStore(config.DB)
 	logStore := store.NewLogStore(config.DB)
+	routeStore := store.NewRouteTemplateStore(config.DB)
+	planStore := store.NewPlanStore(config.DB)
+	quotaStore := config.QuotaStore
+	if quotaStore == nil {
+		quotaStore = store.NewQuotaStore(config.DB)
+	}
+	boostStore := store.NewLimitBoostStore(config.DB)
+	auditStore := store.NewAuditStore(config.DB)
+	refreshStore := store.NewRefreshTokenStore(config.DB)
+	apiKeyStore := store.NewAPIKeyStore(config.DB)
+	verificationStore := store.NewEmailVerificationStore(config.DB)
+
+	// Look up per-client plans and overrides when rate limiting
+	if config.RateLimiter != nil {
+		config.RateLimiter.SetClientLoader(clientStore.FindByIDWithPlan)
+	}
+
+	// Throttle the public routes with the default thresholds unless configured
+	if config.LoginGuard == nil {
+		config.LoginGuard = utils.NewLoginGuard("login", utils.LoginGuardConfig{})
+	}
+	if config.RegisterGuard == nil {
+		config.RegisterGuard = utils.NewLoginGuard("register", utils.LoginGuardConfig{Window: time.Hour})
+	}
+
+	if config.Mailer == nil {
+		config.Mailer = utils.NewOutboxMailer("outbox", "no-reply@localhost")
+	}
 
 	// Initialize handlers
-	clientHandler := handler.NewClientHandler(clientStore)
-	authHandler := handler.NewAuthHandler(clientStore)
-	logHandler := handler.NewLogHandler(logStore, clientStore, config.RateLimiter)
-	usageHandler := handler.NewUsageHandler(logStore, clientStore, config.CacheTTL)
+	clientHandler := handler.NewClientHandler(clientStore, planStore, verificationStore, config.Mailer, config.Verification, config.RegisterGuard)
+	authHandler := handler.NewAuthHandler(clientStore, apiKeyStore, refreshStore, config.LoginGuard)
+	oauthHandler := handler.NewOAuthHandler(clientStore, apiKeyStore, refreshStore, config.LoginGuard)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyStore)
+	logHandler := handler.NewLogHandler(logStore, clientStore, routeStore, quotaStore, config.RateLimiter, config.LogQueue, config.Idempotency)
+	usageHandler := handler.NewUsageHandler(logStore, clientStore, quotaStore, config.CacheTTL)
+	meHandler := handler.NewMeHandler(logStore, quotaStore, config.CacheTTL)
+	routeHandler := handler.NewRouteTemplateHandler(routeStore)
 	sseHandler := handler.NewSSEHandler()
+	metricsHandler := handler.NewMetricsHandler(config.LogQueue)
+	adminHandler := handler.NewAdminHandler(clientStore, planStore, quotaStore, boostStore, auditStore, refreshStore, config.RateLimiter)
 
 	// Global middleware
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key"},
+		AllowOrigins:  []string{"*"},
+		AllowMethods:  []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:  []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "X-Admin-Token"},
+		ExposeHeaders: []string{"Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "RateLimit", "RateLimit-Policy"},
 	}))
 
 	// Rate limiting middleware
@@ -55,42 +104,111 @@ func Setup(e *echo.Echo, config Config) {
 		})
 	})
 
+	// Public keys for verifying access tokens
+	e.GET("/.well-known/jwks.json", authHandler.GetJWKS)
+
+	// OAuth 2.0 client credentials grant (client authentication required)
+	oauth := e.Group("/oauth")
+	oauth.POST("/token", oauthHandler.Token)
+	oauth.POST("/introspect", oauthHandler.Introspect)
+	oauth.POST("/revoke", oauthHandler.Revoke)
+
+	// Ingestion pipeline metrics (admin required)
+	e.GET("/metrics/ingest", metricsHandler.GetIngestMetrics, AdminMiddleware(config.AdminTokens))
+
 	// API routes
 	api := e.Group("/api")
 
 	// Public routes (no authentication required)
 	api.POST("/register", clientHandler.Register)
+	api.POST("/verify-email", clientHandler.VerifyEmail)
+	api.POST("/verify-email/resend", clientHandler.ResendVerification)
 	api.POST("/login", authHandler.Login)
+	api.POST("/auth/refresh", authHandler.RefreshToken)
 
 	// API log routes (API key required)
-	api.POST("/logs", logHandler.RecordLog)
+	ingest := api.Group("/logs")
+	ingest.Use(middleware.Decompress(), middleware.BodyLimit("10M"))
+	ingest.Use(APIKeyMiddleware(apiKeyStore, config.AllowBodyAPIKey), RequireScope(model.ScopeLogsWrite), RequireRole(model.RoleAdmin, model.RoleClient))
+	ingest.POST("", logHandler.RecordLog)
+	ingest.POST("/batch", logHandler.RecordBatchLogs)
+
+	// Admin routes (admin required)
+	admin := api.Group("/admin")
+	admin.Use(AdminMiddleware(config.AdminTokens))
+	admin.GET("/plans", adminHandler.ListPlans)
+	admin.GET("/clients/:client_id/limits", adminHandler.GetClientLimits)
+	admin.PUT("/clients/:client_id/limits", adminHandler.SetClientOverrides)
+	admin.PUT("/clients/:client_id/plan", adminHandler.AssignPlan)
+	admin.PUT("/clients/:client_id/billing-anchor", adminHandler.SetBillingAnchor)
+	admin.GET("/clients/:client_id/rate-limits", adminHandler.GetRateLimitState)
+	admin.POST("/clients/:client_id/rate-limits/reset", adminHandler.ResetRateLimits)
+	admin.GET("/clients/:client_id/boosts", adminHandler.ListBoosts)
+	admin.POST("/clients/:client_id/boosts", adminHandler.GrantBoost)
+	admin.DELETE("/clients/:client_id/boosts/:boost_id", adminHandler.RevokeBoost)
+	admin.POST("/clients/:client_id/tokens/revoke", adminHandler.RevokeTokens)
+	admin.PUT("/clients/:client_id/role", adminHandler.SetRole)
+	admin.GET("/audit-logs", adminHandler.ListAuditLogs)
 
 	// Protected routes (JWT required)
 	protected := api.Group("")
 	protected.Use(JWTMiddleware())
 
 	// Auth routes
-	protected.POST("/auth/refresh", authHandler.RefreshToken)
 	protected.POST("/auth/logout", authHandler.Logout)
+	protected.POST("/auth/revoke-all", authHandler.RevokeAllTokens)
 	protected.GET("/auth/profile", authHandler.GetProfile)
 
+	// API key routes (not for read-only analysts)
+	keys := protected.Group("/keys", RequireScope(model.ScopeKeysWrite), RequireRole(model.RoleAdmin, model.RoleClient))
+	keys.GET("", apiKeyHandler.ListKeys)
+	keys.POST("", apiKeyHandler.CreateKey)
+	keys.POST("/:key_id/rotate", apiKeyHandler.RotateKey)
+	keys.DELETE("/:key_id", apiKeyHandler.RevokeKey)
+
+	// Usage of the authenticated client only (JWT required, every role)
+	me := protected.Group("/me", RequireScope(model.ScopeUsageRead))
+	me.GET("/usage/daily", meHandler.GetDailyUsage)
+	me.GET("/usage/endpoints", meHandler.GetEndpointUsage)
+	me.GET("/quota", meHandler.GetQuota)
+	me.GET("/logs", meHandler.ListLogs)
+
 	// Usage routes (JWT required)
-	usage := protected.Group("/usage")
+	usage := protected.Group("/usage", RequireScope(model.ScopeUsageRead))
 
 	if config.EnableIPWhitelist && len(config.AllowedIPs) > 0 {
 		usage.Use(IPWhitelistMiddleware(config.AllowedIPs))
 	}
 
-	usage.GET("/daily", usageHandler.GetDailyUsage)
-	usage.GET("/top", usageHandler.GetTopClients)
-	usage.GET("/stats", usageHandler.GetUsageStats)
-	usage.GET("/client/:client_id", usageHandler.GetClientUsage)
-
-	// Real-time SSE routes (JWT required)
-	stream := protected.Group("/stream")
+	// Quotas of the authenticated client (other clients require the admin role)
+	usage.GET("/quota", usageHandler.GetQuota)
+	usage.GET("/quota/history", usageHandler.GetQuotaHistory)
+
+	// Global analytics and cross-client lookups (admin role required)
+	global := usage.Group("", RequireRole(model.RoleAdmin))
+	global.GET("/daily", usageHandler.GetDailyUsage)
+	global.GET("/top", usageHandler.GetTopClients)
+	global.GET("/stats", usageHandler.GetUsageStats)
+	global.GET("/client/:client_id", usageHandler.GetClientUsage)
+	global.GET("/endpoints", usageHandler.GetEndpointUsage)
+	global.GET("/errors/clients", usageHandler.GetClientErrorRates)
+	global.GET("/errors/endpoints", usageHandler.GetEndpointErrorRates)
+	global.GET("/status", usageHandler.GetStatusBreakdown)
+	global.GET("/latency/clients", usageHandler.GetClientLatency)
+	global.GET("/latency/endpoints", usageHandler.GetEndpointLatency)
+
+	// Route template routes (JWT required, read-only analysts can only list them)
+	writer := []echo.MiddlewareFunc{RequireScope(model.ScopeRoutesWrite), RequireRole(model.RoleAdmin, model.RoleClient)}
+	routes := protected.Group("/routes")
+	routes.GET("", routeHandler.ListTemplates, RequireScope(model.ScopeUsageRead))
+	routes.POST("", routeHandler.CreateTemplate, writer...)
+	routes.DELETE("/:id", routeHandler.DeleteTemplate, writer...)
+
+	// Real-time SSE routes of global activity (JWT and admin role required)
+	stream := protected.Group("/stream", RequireScope(model.ScopeStreamRead), RequireRole(model.RoleAdmin))
 	stream.GET("/usage", sseHandler.StreamUsageUpdates)
 	stream.GET("/top", sseHandler.StreamTopClients)
 
 	// Custom error handler
 	e.HTTPErrorHandler = ErrorHandler
-}
\ No newline at end of file
+}
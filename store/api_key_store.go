@@ -0,0 +1,187 @@
+package store
+
+import (
+	"crypto/subtle"
+	"errors"
+	"nexmedis-golang/model"
+	"nexmedis-golang/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrAPIKeyNotFound is returned when a key does not exist or belongs to another client
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrAPIKeyInactive is returned when rotating a key that expired or was revoked
+	ErrAPIKeyInactive = errors.New("api key is expired or revoked")
+	// ErrInvalidAPIKey is returned when no active key matches
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	// ErrClientUnverified is returned when the key belongs to a client that has
+	// not verified its email address yet
+	ErrClientUnverified = errors.New("client email address is not verified")
+)
+
+// lastUsedPrecision is how stale last_used_at may get before it is written again
+const lastUsedPrecision = time.Minute
+
+// APIKeyStore handles database operations for API keys
+type APIKeyStore struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyStore creates a new APIKeyStore instance
+func NewAPIKeyStore(db *gorm.DB) *APIKeyStore {
+	return &APIKeyStore{db: db}
+}
+
+// Authenticate finds the active key matching apiKey together with its client.
+// Candidates are looked up by the key's public prefix and their hashes are
+// compared in constant time. Keys of clients that have not verified their
+// email address are refused with ErrClientUnverified.
+func (s *APIKeyStore) Authenticate(apiKey string) (*model.APIKey, error) {
+	var candidates []model.APIKey
+	err := s.db.Preload("Client").
+		Where("prefix = ?", utils.APIKeyPrefix(apiKey)).
+		Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	hash := []byte(utils.HashToken(apiKey))
+	for i := range candidates {
+		key := &candidates[i]
+		if subtle.ConstantTimeCompare(hash, []byte(key.Hash)) != 1 {
+			continue
+		}
+		if key.Client == nil || key.StatusAt(now) != model.APIKeyActive {
+			return nil, ErrInvalidAPIKey
+		}
+		if !key.Client.Verified() {
+			return nil, ErrClientUnverified
+		}
+
+		s.touch(key, now)
+		return key, nil
+	}
+
+	return nil, ErrInvalidAPIKey
+}
+
+// Create stores a new key
+func (s *APIKeyStore) Create(key *model.APIKey) error {
+	return s.db.Create(key).Error
+}
+
+// ListByClient returns all keys of a client, newest first
+func (s *APIKeyStore) ListByClient(clientID uuid.UUID) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	err := s.db.Where("client_id = ?", clientID).
+		Order("created_at DESC").
+		Find(&keys).Error
+	return keys, err
+}
+
+// FindByID finds a key of a client
+func (s *APIKeyStore) FindByID(clientID, keyID uuid.UUID) (*model.APIKey, error) {
+	var key model.APIKey
+	if err := s.db.Where("id = ? AND client_id = ?", keyID, clientID).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+// CountActive returns the number of keys of a client that still work
+func (s *APIKeyStore) CountActive(clientID uuid.UUID) (int64, error) {
+	var count int64
+	err := s.db.Model(&model.APIKey{}).
+		Where("client_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", clientID, time.Now()).
+		Count(&count).Error
+	return count, err
+}
+
+// Rotate replaces an active key with next. The old key keeps working for the
+// grace period, or until its own expiry if that comes first, so callers can
+// switch over without downtime. Sessions started with the old key end with it.
+func (s *APIKeyStore) Rotate(clientID, keyID uuid.UUID, next *model.APIKey, grace time.Duration) (*model.APIKey, error) {
+	var old model.APIKey
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND client_id = ?", keyID, clientID).
+			First(&old).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrAPIKeyNotFound
+			}
+			return err
+		}
+
+		now := time.Now()
+		if old.StatusAt(now) != model.APIKeyActive {
+			return ErrAPIKeyInactive
+		}
+
+		graceEnd := now.Add(grace)
+		if old.ExpiresAt == nil || old.ExpiresAt.After(graceEnd) {
+			old.ExpiresAt = &graceEnd
+			if err := tx.Model(&old).Update("expires_at", graceEnd).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&model.RefreshToken{}).
+			Where("api_key_id = ? AND revoked_at IS NULL AND expires_at > ?", keyID, *old.ExpiresAt).
+			Update("expires_at", *old.ExpiresAt).Error; err != nil {
+			return err
+		}
+
+		next.ClientID = clientID
+		return tx.Create(next).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &old, nil
+}
+
+// Revoke stops a key of a client from working right away, together with the
+// refresh tokens of the sessions started with it
+func (s *APIKeyStore) Revoke(clientID, keyID uuid.UUID) (*model.APIKey, error) {
+	key, err := s.FindByID(clientID, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if key.RevokedAt == nil {
+			key.RevokedAt = &now
+			if err := tx.Model(key).Update("revoked_at", now).Error; err != nil {
+				return err
+			}
+		}
+		return revokeRefreshTokens(tx.Where("api_key_id = ?", key.ID), now)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// touch records that a key was used, at most once per lastUsedPrecision so
+// busy keys do not cause a write on every request
+func (s *APIKeyStore) touch(key *model.APIKey, now time.Time) {
+	if key.LastUsedAt != nil && now.Sub(*key.LastUsedAt) < lastUsedPrecision {
+		return
+	}
+
+	key.LastUsedAt = &now
+	s.db.Model(&model.APIKey{}).Where("id = ?", key.ID).Update("last_used_at", now)
+}
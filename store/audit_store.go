@@ -0,0 +1,47 @@
+package store
+
+import (
+	"encoding/json"
+	"nexmedis-golang/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuditStore handles database operations for the admin audit trail
+type AuditStore struct {
+	db *gorm.DB
+}
+
+// NewAuditStore creates a new AuditStore instance
+func NewAuditStore(db *gorm.DB) *AuditStore {
+	return &AuditStore{db: db}
+}
+
+// Record appends an action to the audit trail. Details are stored as JSON.
+func (s *AuditStore) Record(actor, ip, action string, clientID *uuid.UUID, details interface{}) error {
+	data, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Create(&model.AuditLog{
+		Actor:    actor,
+		IP:       ip,
+		Action:   action,
+		ClientID: clientID,
+		Details:  data,
+	}).Error
+}
+
+// List returns the most recent audit entries, optionally for a single client
+func (s *AuditStore) List(clientID *uuid.UUID, limit int) ([]model.AuditLog, error) {
+	query := s.db.Order("created_at DESC").Limit(limit)
+	if clientID != nil {
+		query = query.Where("client_id = ?", *clientID)
+	}
+
+	var entries []model.AuditLog
+	err := query.Find(&entries).Error
+	return entries, err
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"errors"
 	"nexmedis-golang/model"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -49,19 +50,6 @@ func (s *ClientStore) FindByClientID(clientID string) (*model.Client, error) {
 	return &client, nil
 }
 
-// FindByAPIKey finds a client by API key
-func (s *ClientStore) FindByAPIKey(apiKey string) (*model.Client, error) {
-	var client model.Client
-	err := s.db.Where("api_key = ?", apiKey).First(&client).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("client not found")
-		}
-		return nil, err
-	}
-	return &client, nil
-}
-
 // FindByEmail finds a client by email
 func (s *ClientStore) FindByEmail(email string) (*model.Client, error) {
 	var client model.Client
@@ -82,13 +70,6 @@ func (s *ClientStore) ExistsByEmail(email string) (bool, error) {
 	return count > 0, err
 }
 
-// ExistsByAPIKey checks if a client with the given API key exists
-func (s *ClientStore) ExistsByAPIKey(apiKey string) (bool, error) {
-	var count int64
-	err := s.db.Model(&model.Client{}).Where("api_key = ?", apiKey).Count(&count).Error
-	return count > 0, err
-}
-
 // List returns all clients with pagination
 func (s *ClientStore) List(offset, limit int) ([]model.Client, error) {
 	var clients []model.Client
@@ -101,6 +82,57 @@ func (s *ClientStore) Update(client *model.Client) error {
 	return s.db.Save(client).Error
 }
 
+// FindByIDWithPlan finds a client by UUID together with its plan and active boosts
+func (s *ClientStore) FindByIDWithPlan(id uuid.UUID) (*model.Client, error) {
+	var client model.Client
+	err := s.db.Preload("Plan").Preload("Boosts", "expires_at > ?", time.Now()).Where("id = ?", id).First(&client).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("client not found")
+		}
+		return nil, err
+	}
+	return &client, nil
+}
+
+// FindByClientIDWithPlan finds a client by client_id string together with its
+// plan and active boosts
+func (s *ClientStore) FindByClientIDWithPlan(clientID string) (*model.Client, error) {
+	var client model.Client
+	err := s.db.Preload("Plan").Preload("Boosts", "expires_at > ?", time.Now()).Where("client_id = ?", clientID).First(&client).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("client not found")
+		}
+		return nil, err
+	}
+	return &client, nil
+}
+
+// AssignPlan links a client to a plan
+func (s *ClientStore) AssignPlan(id uuid.UUID, planID uuid.UUID) error {
+	return s.db.Model(&model.Client{}).Where("id = ?", id).Update("plan_id", planID).Error
+}
+
+// SetLimitOverrides replaces the per-client limit overrides. Nil values clear an override.
+func (s *ClientStore) SetLimitOverrides(id uuid.UUID, overrides model.LimitOverrides) error {
+	return s.db.Model(&model.Client{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"hourly_limit_override":  overrides.Hourly,
+		"daily_limit_override":   overrides.Daily,
+		"monthly_limit_override": overrides.Monthly,
+	}).Error
+}
+
+// SetBillingAnchor moves the billing cycle of a client
+func (s *ClientStore) SetBillingAnchor(id uuid.UUID, anchor time.Time) error {
+	return s.db.Model(&model.Client{}).Where("id = ?", id).Update("billing_anchor", anchor).Error
+}
+
+// SetRole changes the role of a client
+func (s *ClientStore) SetRole(id uuid.UUID, role string) error {
+	return s.db.Model(&model.Client{}).Where("id = ?", id).Update("role", role).Error
+}
+
 // Delete soft deletes a client
 func (s *ClientStore) Delete(id uuid.UUID) error {
 	return s.db.Delete(&model.Client{}, id).Error
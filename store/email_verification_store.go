@@ -0,0 +1,103 @@
+package store
+
+import (
+	"errors"
+	"nexmedis-golang/model"
+	"nexmedis-golang/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrVerificationTokenInvalid is returned for unknown, expired or used verification tokens
+var ErrVerificationTokenInvalid = errors.New("verification token is invalid or expired")
+
+// EmailVerificationStore handles database operations for email verification tokens
+type EmailVerificationStore struct {
+	db *gorm.DB
+}
+
+// NewEmailVerificationStore creates a new EmailVerificationStore instance
+func NewEmailVerificationStore(db *gorm.DB) *EmailVerificationStore {
+	return &EmailVerificationStore{db: db}
+}
+
+// Issue creates a verification token for a client. Earlier unused tokens of
+// the client stop working, so only the latest email can be used.
+func (s *EmailVerificationStore) Issue(clientID uuid.UUID, lifetime time.Duration) (string, error) {
+	token, err := utils.GenerateVerificationToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("client_id = ? AND used_at IS NULL", clientID).
+			Delete(&model.EmailVerification{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&model.EmailVerification{
+			ClientID:  clientID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: time.Now().Add(lifetime),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Verify uses a verification token: the client is marked as verified and key
+// is created as its first API key, in one transaction so a used token always
+// leaves the client with a key.
+func (s *EmailVerificationStore) Verify(token string, key *model.APIKey) (*model.Client, error) {
+	var client model.Client
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var verification model.EmailVerification
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(token)).
+			First(&verification).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrVerificationTokenInvalid
+			}
+			return err
+		}
+
+		now := time.Now()
+		if verification.UsedAt != nil || !verification.ExpiresAt.After(now) {
+			return ErrVerificationTokenInvalid
+		}
+
+		if err := tx.Model(&verification).Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("id = ?", verification.ClientID).First(&client).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrVerificationTokenInvalid
+			}
+			return err
+		}
+		if client.Verified() {
+			return ErrVerificationTokenInvalid
+		}
+
+		client.EmailVerifiedAt = &now
+		if err := tx.Model(&client).Update("email_verified_at", now).Error; err != nil {
+			return err
+		}
+
+		key.ClientID = client.ID
+		return tx.Create(key).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client.APIKeys = []model.APIKey{*key}
+	return &client, nil
+}
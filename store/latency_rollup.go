@@ -0,0 +1,162 @@
+package store
+
+import (
+	"fmt"
+	"nexmedis-golang/model"
+	"nexmedis-golang/utils"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// rollupChunkSize bounds the number of log IDs passed to a single rollup statement
+const rollupChunkSize = 1000
+
+// latencyBucketSQL maps duration_ms to its bucket, matching utils.LatencyBucket
+var latencyBucketSQL = fmt.Sprintf("CEIL(LN(GREATEST(duration_ms, %g)) / LN(%.17g))::int", utils.LatencyMinMs, utils.LatencyGamma)
+
+// rollupLatency adds the durations of freshly inserted logs to the hourly
+// latency rollups. Logs skipped as duplicates are not in api_logs under the
+// given IDs, so they are not counted twice.
+func rollupLatency(tx *gorm.DB, ids []uuid.UUID) error {
+	for start := 0; start < len(ids); start += rollupChunkSize {
+		end := min(start+rollupChunkSize, len(ids))
+
+		err := tx.Exec(`
+			INSERT INTO latency_rollups (client_id, endpoint_template, bucket_start, bucket, count)
+			SELECT client_id, endpoint_template, date_trunc('hour', timestamp), `+latencyBucketSQL+`, COUNT(*)
+			FROM api_logs
+			WHERE id IN ? AND duration_ms IS NOT NULL
+			GROUP BY 1, 2, 3, 4
+			ON CONFLICT (client_id, endpoint_template, bucket_start, bucket)
+			DO UPDATE SET count = latency_rollups.count + EXCLUDED.count
+		`, ids[start:end]).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// timedLogIDs returns the IDs of the logs that carry a duration
+func timedLogIDs(logs []model.APILog) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(logs))
+	for _, l := range logs {
+		if l.DurationMs != nil {
+			ids = append(ids, l.ID)
+		}
+	}
+	return ids
+}
+
+// GetLatencyByClient returns the latency percentiles of each client since start,
+// slowest p99 first
+func (s *LogStore) GetLatencyByClient(start time.Time, limit int) ([]model.ClientLatency, error) {
+	type row struct {
+		ClientID   uuid.UUID
+		ClientName string
+		Bucket     int
+		Count      int64
+	}
+
+	var rows []row
+	err := s.db.Raw(`
+		SELECT r.client_id, c.name as client_name, r.bucket, SUM(r.count) as count
+		FROM latency_rollups r
+		INNER JOIN clients c ON r.client_id = c.id
+		WHERE r.bucket_start >= ?
+		GROUP BY r.client_id, c.name, r.bucket
+	`, start.Truncate(time.Hour)).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	histograms := make(map[uuid.UUID][]utils.LatencyBucketCount)
+	names := make(map[uuid.UUID]string)
+	for _, r := range rows {
+		histograms[r.ClientID] = append(histograms[r.ClientID], utils.LatencyBucketCount{Bucket: r.Bucket, Count: r.Count})
+		names[r.ClientID] = r.ClientName
+	}
+
+	results := make([]model.ClientLatency, 0, len(histograms))
+	for clientID, buckets := range histograms {
+		count, p := utils.LatencyQuantiles(buckets, 0.5, 0.9, 0.99)
+		results = append(results, model.ClientLatency{
+			ClientID:   clientID,
+			ClientName: names[clientID],
+			Count:      count,
+			P50:        p[0],
+			P90:        p[1],
+			P99:        p[2],
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].P99 != results[j].P99 {
+			return results[i].P99 > results[j].P99
+		}
+		return results[i].Count > results[j].Count
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// GetLatencyByEndpoint returns the latency percentiles of each route template
+// since start, slowest p99 first. A nil clientID covers all clients.
+func (s *LogStore) GetLatencyByEndpoint(clientID *uuid.UUID, start time.Time, limit int) ([]model.EndpointLatency, error) {
+	type row struct {
+		Endpoint string
+		Bucket   int
+		Count    int64
+	}
+
+	query := s.db.Model(&model.LatencyRollup{}).
+		Select("endpoint_template as endpoint, bucket, SUM(count) as count").
+		Where("bucket_start >= ?", start.Truncate(time.Hour))
+
+	if clientID != nil {
+		query = query.Where("client_id = ?", *clientID)
+	}
+
+	var rows []row
+	if err := query.Group("endpoint_template, bucket").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	histograms := make(map[string][]utils.LatencyBucketCount)
+	for _, r := range rows {
+		histograms[r.Endpoint] = append(histograms[r.Endpoint], utils.LatencyBucketCount{Bucket: r.Bucket, Count: r.Count})
+	}
+
+	results := make([]model.EndpointLatency, 0, len(histograms))
+	for endpoint, buckets := range histograms {
+		count, p := utils.LatencyQuantiles(buckets, 0.5, 0.9, 0.99)
+		results = append(results, model.EndpointLatency{
+			Endpoint: endpoint,
+			Count:    count,
+			P50:      p[0],
+			P90:      p[1],
+			P99:      p[2],
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].P99 != results[j].P99 {
+			return results[i].P99 > results[j].P99
+		}
+		return results[i].Count > results[j].Count
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"errors"
+	"nexmedis-golang/model"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrBoostNotFound is returned when a boost does not exist or already expired
+var ErrBoostNotFound = errors.New("boost not found")
+
+// LimitBoostStore handles database operations for temporary limit boosts
+type LimitBoostStore struct {
+	db *gorm.DB
+}
+
+// NewLimitBoostStore creates a new LimitBoostStore instance
+func NewLimitBoostStore(db *gorm.DB) *LimitBoostStore {
+	return &LimitBoostStore{db: db}
+}
+
+// Create grants a new boost
+func (s *LimitBoostStore) Create(boost *model.LimitBoost) error {
+	return s.db.Create(boost).Error
+}
+
+// ListActive returns the boosts of a client that have not expired, soonest expiry first
+func (s *LimitBoostStore) ListActive(clientID uuid.UUID) ([]model.LimitBoost, error) {
+	var boosts []model.LimitBoost
+	err := s.db.Where("client_id = ? AND expires_at > ?", clientID, time.Now()).
+		Order("expires_at ASC").
+		Find(&boosts).Error
+	return boosts, err
+}
+
+// Revoke ends an active boost of a client right away
+func (s *LimitBoostStore) Revoke(clientID, boostID uuid.UUID) (*model.LimitBoost, error) {
+	var boost model.LimitBoost
+	err := s.db.Where("id = ? AND client_id = ? AND expires_at > ?", boostID, clientID, time.Now()).First(&boost).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBoostNotFound
+		}
+		return nil, err
+	}
+
+	boost.ExpiresAt = time.Now()
+	if err := s.db.Model(&boost).Update("expires_at", boost.ExpiresAt).Error; err != nil {
+		return nil, err
+	}
+
+	return &boost, nil
+}
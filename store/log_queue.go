@@ -0,0 +1,304 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"log"
+	"nexmedis-golang/model"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrQueueFull is returned when the log queue has no room for new entries
+	ErrQueueFull = errors.New("log queue is full")
+	// ErrQueueClosed is returned when enqueueing into a queue that is shutting down
+	ErrQueueClosed = errors.New("log queue is closed")
+)
+
+// flushRetries is the number of attempts made to persist a batch before dropping it
+const flushRetries = 3
+
+// LogQueueConfig holds configuration for the asynchronous log write pipeline
+type LogQueueConfig struct {
+	Capacity      int           // Maximum number of logs buffered in memory
+	BatchSize     int           // Flush once a worker has collected this many logs
+	FlushInterval time.Duration // Flush pending logs at least this often
+	Workers       int           // Number of concurrent flush workers
+}
+
+// LogQueueStats is a snapshot of the log queue metrics
+// @Description Metrics of the asynchronous log write pipeline
+type LogQueueStats struct {
+	Depth              int     `json:"depth" example:"42"`                   // Logs currently waiting in the queue
+	Capacity           int     `json:"capacity" example:"10000"`             // Maximum number of queued logs
+	Enqueued           int64   `json:"enqueued" example:"150000"`            // Logs accepted into the queue
+	Rejected           int64   `json:"rejected" example:"12"`                // Logs rejected because the queue was full or closed
+	Flushed            int64   `json:"flushed" example:"149950"`             // Logs written to the database
+	Skipped            int64   `json:"skipped" example:"3"`                  // Logs not written because their event ID was already recorded
+	Failed             int64   `json:"failed" example:"8"`                   // Logs dropped after all write attempts failed
+	Flushes            int64   `json:"flushes" example:"320"`                // Number of bulk writes
+	LastFlushLatencyMs float64 `json:"last_flush_latency_ms" example:"12.5"` // Duration of the latest bulk write
+	AvgFlushLatencyMs  float64 `json:"avg_flush_latency_ms" example:"10.1"`  // Average duration of bulk writes
+	MaxFlushLatencyMs  float64 `json:"max_flush_latency_ms" example:"85.3"`  // Slowest bulk write
+}
+
+// LogQueue buffers API logs in memory and writes them to the database in bulk
+type LogQueue struct {
+	store   *LogStore
+	config  LogQueueConfig
+	queue   chan model.APILog
+	onFlush func(logs []model.APILog)
+	onSkip  func(logs []model.APILog, existing map[uuid.UUID]uuid.UUID)
+	onDrop  func(logs []model.APILog)
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+
+	enqueued       atomic.Int64
+	rejected       atomic.Int64
+	flushed        atomic.Int64
+	skipped        atomic.Int64
+	failed         atomic.Int64
+	flushes        atomic.Int64
+	flushNanos     atomic.Int64
+	lastFlushNanos atomic.Int64
+	maxFlushNanos  atomic.Int64
+}
+
+// NewLogQueue creates a new LogQueue instance
+func NewLogQueue(store *LogStore, config LogQueueConfig) *LogQueue {
+	if config.Capacity <= 0 {
+		config.Capacity = 10000
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 500
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+
+	return &LogQueue{
+		store:  store,
+		config: config,
+		queue:  make(chan model.APILog, config.Capacity),
+	}
+}
+
+// OnFlush registers a callback invoked after a batch has been persisted.
+// It must be called before Start.
+func (q *LogQueue) OnFlush(fn func(logs []model.APILog)) {
+	q.onFlush = fn
+}
+
+// OnSkip registers a callback invoked with the logs of a persisted batch that
+// were not written because their event ID was already recorded, together with
+// the ID of the existing log for each of them, keyed by the skipped log's ID.
+// It must be called before Start.
+func (q *LogQueue) OnSkip(fn func(logs []model.APILog, existing map[uuid.UUID]uuid.UUID)) {
+	q.onSkip = fn
+}
+
+// OnDrop registers a callback invoked with a batch that could not be persisted
+// after all attempts, so what its logs were charged can be given back.
+// It must be called before Start.
+func (q *LogQueue) OnDrop(fn func(logs []model.APILog)) {
+	q.onDrop = fn
+}
+
+// Start launches the flush workers
+func (q *LogQueue) Start() {
+	for i := 0; i < q.config.Workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+
+	log.Printf("Log queue started (capacity=%d, batch=%d, interval=%s, workers=%d)",
+		q.config.Capacity, q.config.BatchSize, q.config.FlushInterval, q.config.Workers)
+}
+
+// Enqueue adds a log to the queue without blocking
+func (q *LogQueue) Enqueue(apiLog model.APILog) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		q.rejected.Add(1)
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.queue <- apiLog:
+		q.enqueued.Add(1)
+		return nil
+	default:
+		q.rejected.Add(1)
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting new logs and waits for the queued ones to be written
+func (q *LogQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Printf("Log queue drained (flushed=%d, failed=%d)", q.flushed.Load(), q.failed.Load())
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns a snapshot of the queue metrics
+func (q *LogQueue) Stats() LogQueueStats {
+	stats := LogQueueStats{
+		Depth:              len(q.queue),
+		Capacity:           q.config.Capacity,
+		Enqueued:           q.enqueued.Load(),
+		Rejected:           q.rejected.Load(),
+		Flushed:            q.flushed.Load(),
+		Skipped:            q.skipped.Load(),
+		Failed:             q.failed.Load(),
+		Flushes:            q.flushes.Load(),
+		LastFlushLatencyMs: nanosToMillis(q.lastFlushNanos.Load()),
+		MaxFlushLatencyMs:  nanosToMillis(q.maxFlushNanos.Load()),
+	}
+
+	if stats.Flushes > 0 {
+		stats.AvgFlushLatencyMs = nanosToMillis(q.flushNanos.Load() / stats.Flushes)
+	}
+
+	return stats
+}
+
+// worker collects queued logs and flushes them by size or time threshold
+func (q *LogQueue) worker() {
+	defer q.wg.Done()
+
+	batch := make([]model.APILog, 0, q.config.BatchSize)
+	ticker := time.NewTicker(q.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case apiLog, ok := <-q.queue:
+			if !ok {
+				// Queue closed and drained
+				q.flush(batch)
+				return
+			}
+
+			batch = append(batch, apiLog)
+			if len(batch) >= q.config.BatchSize {
+				q.flush(batch)
+				batch = batch[:0]
+			}
+
+		case <-ticker.C:
+			if len(batch) > 0 {
+				q.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush writes a batch of logs to the database, retrying on failure
+func (q *LogQueue) flush(batch []model.APILog) {
+	if len(batch) == 0 {
+		return
+	}
+
+	start := time.Now()
+	var skipped map[uuid.UUID]uuid.UUID
+	var err error
+	for attempt := 1; attempt <= flushRetries; attempt++ {
+		if skipped, err = q.store.BatchCreate(batch); err == nil {
+			break
+		}
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+	}
+	q.recordFlushLatency(time.Since(start))
+
+	if err != nil {
+		q.failed.Add(int64(len(batch)))
+		log.Printf("Failed to flush %d queued logs: %v", len(batch), err)
+		if q.onDrop != nil {
+			go q.onDrop(copyBatch(batch))
+		}
+		return
+	}
+
+	// Logs whose event ID was recorded first by another request were not
+	// written, so they are neither counted nor announced as new
+	stored := batch
+	if len(skipped) > 0 {
+		stored = make([]model.APILog, 0, len(batch)-len(skipped))
+		duplicates := make([]model.APILog, 0, len(skipped))
+		for _, l := range batch {
+			if _, ok := skipped[l.ID]; ok {
+				duplicates = append(duplicates, l)
+			} else {
+				stored = append(stored, l)
+			}
+		}
+
+		q.skipped.Add(int64(len(duplicates)))
+		if q.onSkip != nil {
+			go q.onSkip(duplicates, skipped)
+		}
+	}
+
+	q.flushed.Add(int64(len(stored)))
+
+	if q.onFlush != nil && len(stored) > 0 {
+		go q.onFlush(copyBatch(stored))
+	}
+}
+
+// copyBatch copies a batch before it is handed to a callback, as the batch
+// buffer is reused by the worker
+func copyBatch(batch []model.APILog) []model.APILog {
+	logs := make([]model.APILog, len(batch))
+	copy(logs, batch)
+	return logs
+}
+
+// recordFlushLatency updates the flush latency metrics
+func (q *LogQueue) recordFlushLatency(d time.Duration) {
+	nanos := d.Nanoseconds()
+	q.flushes.Add(1)
+	q.flushNanos.Add(nanos)
+	q.lastFlushNanos.Store(nanos)
+
+	for {
+		current := q.maxFlushNanos.Load()
+		if nanos <= current || q.maxFlushNanos.CompareAndSwap(current, nanos) {
+			return
+		}
+	}
+}
+
+// nanosToMillis converts nanoseconds to fractional milliseconds
+func nanosToMillis(nanos int64) float64 {
+	return float64(nanos) / float64(time.Millisecond)
+}
@@ -1,13 +1,18 @@
 package store
 
 import (
+	"errors"
 	"nexmedis-golang/model"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrLogNotFound is returned when an API log does not exist
+var ErrLogNotFound = errors.New("log not found")
+
 // LogStore handles database operations for API logs
 type LogStore struct {
 	db *gorm.DB
@@ -18,17 +23,101 @@ func NewLogStore(db *gorm.DB) *LogStore {
 	return &LogStore{db: db}
 }
 
-// Create creates a new API log entry
-func (s *LogStore) Create(log *model.APILog) error {
-	return s.db.Create(log).Error
+// Create creates a new API log entry. A log whose event ID was already
+// recorded for the client is skipped, and the existing log is returned instead.
+// Latency rollups are updated in the same transaction.
+func (s *LogStore) Create(log *model.APILog) (*model.APILog, error) {
+	var inserted bool
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(log)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		inserted = result.RowsAffected > 0
+		if inserted && log.DurationMs != nil {
+			return rollupLatency(tx, []uuid.UUID{log.ID})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !inserted && log.EventID != nil {
+		return s.FindByEventID(log.ClientID, *log.EventID)
+	}
+
+	return log, nil
 }
 
-// BatchCreate creates multiple API log entries in a single transaction
-func (s *LogStore) BatchCreate(logs []model.APILog) error {
+// BatchCreate creates multiple API log entries in a single transaction.
+// Logs whose event ID was already recorded for the client are skipped, and
+// the returned map holds the ID of the existing log for each of them, keyed
+// by the ID of the skipped log. Latency rollups are updated in the same
+// transaction.
+func (s *LogStore) BatchCreate(logs []model.APILog) (map[uuid.UUID]uuid.UUID, error) {
 	if len(logs) == 0 {
-		return nil
+		return nil, nil
 	}
-	return s.db.CreateInBatches(logs, 100).Error
+
+	var skipped map[uuid.UUID]uuid.UUID
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(logs, 100).Error; err != nil {
+			return err
+		}
+
+		var err error
+		if skipped, err = skippedLogs(tx, logs); err != nil {
+			return err
+		}
+		return rollupLatency(tx, timedLogIDs(logs))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return skipped, nil
+}
+
+// skippedLogs looks up the stored logs under the event IDs of logs and maps
+// the ID of every log that was not inserted to the ID of the existing one
+func skippedLogs(tx *gorm.DB, logs []model.APILog) (map[uuid.UUID]uuid.UUID, error) {
+	eventIDs := make(map[uuid.UUID][]string)
+	for _, l := range logs {
+		if l.EventID != nil {
+			eventIDs[l.ClientID] = append(eventIDs[l.ClientID], *l.EventID)
+		}
+	}
+
+	type event struct {
+		clientID uuid.UUID
+		eventID  string
+	}
+	stored := make(map[event]uuid.UUID)
+	for clientID, ids := range eventIDs {
+		var existing []model.APILog
+		err := tx.Select("id", "event_id").
+			Where("client_id = ? AND event_id IN ?", clientID, ids).
+			Find(&existing).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range existing {
+			stored[event{clientID, *l.EventID}] = l.ID
+		}
+	}
+
+	skipped := make(map[uuid.UUID]uuid.UUID)
+	for _, l := range logs {
+		if l.EventID == nil {
+			continue
+		}
+		if id, ok := stored[event{l.ClientID, *l.EventID}]; ok && id != l.ID {
+			skipped[l.ID] = id
+		}
+	}
+	return skipped, nil
 }
 
 // FindByID finds an API log by ID
@@ -38,6 +127,19 @@ func (s *LogStore) FindByID(id uuid.UUID) (*model.APILog, error) {
 	return &log, err
 }
 
+// FindByEventID finds the API log recorded for a client under an event ID
+func (s *LogStore) FindByEventID(clientID uuid.UUID, eventID string) (*model.APILog, error) {
+	var log model.APILog
+	err := s.db.Where("client_id = ? AND event_id = ?", clientID, eventID).First(&log).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLogNotFound
+		}
+		return nil, err
+	}
+	return &log, nil
+}
+
 // GetDailyUsage returns daily usage for each client for the last N days
 func (s *LogStore) GetDailyUsage(days int) ([]model.DailyUsage, error) {
 	var results []model.DailyUsage
@@ -152,6 +254,100 @@ func (s *LogStore) GetRequestsByEndpoint(start, end time.Time) (map[string]int64
 	return endpointCounts, nil
 }
 
+// GetEndpointUsage returns request counts grouped by route template, or by raw
+// endpoint when byTemplate is false. A nil clientID covers all clients.
+func (s *LogStore) GetEndpointUsage(clientID *uuid.UUID, start, end time.Time, byTemplate bool, limit int) ([]model.EndpointUsage, error) {
+	column := "endpoint"
+	if byTemplate {
+		column = "endpoint_template"
+	}
+
+	query := s.db.Model(&model.APILog{}).
+		Select(column+" as endpoint, COUNT(*) as count").
+		Where("timestamp >= ? AND timestamp < ?", start, end)
+
+	if clientID != nil {
+		query = query.Where("client_id = ?", *clientID)
+	}
+
+	var results []model.EndpointUsage
+	err := query.Group(column).
+		Order("count DESC").
+		Limit(limit).
+		Scan(&results).Error
+	return results, err
+}
+
+// GetErrorRateByClient returns the error rate of each client in a time range,
+// highest first. Hits without a status code are not counted.
+func (s *LogStore) GetErrorRateByClient(start, end time.Time, limit int) ([]model.ClientErrorRate, error) {
+	var results []model.ClientErrorRate
+
+	query := `
+		SELECT 
+			l.client_id,
+			c.name as client_name,
+			COUNT(*) as total_requests,
+			COUNT(*) FILTER (WHERE l.status_code BETWEEN 400 AND 499) as client_errors,
+			COUNT(*) FILTER (WHERE l.status_code >= 500) as server_errors,
+			(COUNT(*) FILTER (WHERE l.status_code >= 400))::float8 / COUNT(*) as error_rate
+		FROM api_logs l
+		INNER JOIN clients c ON l.client_id = c.id
+		WHERE l.timestamp >= ? AND l.timestamp < ? AND l.status_code > 0
+		GROUP BY l.client_id, c.name
+		ORDER BY error_rate DESC, total_requests DESC
+		LIMIT ?
+	`
+
+	err := s.db.Raw(query, start, end, limit).Scan(&results).Error
+	return results, err
+}
+
+// GetErrorRateByEndpoint returns the error rate of each route template in a
+// time range, highest first. A nil clientID covers all clients.
+func (s *LogStore) GetErrorRateByEndpoint(clientID *uuid.UUID, start, end time.Time, limit int) ([]model.EndpointErrorRate, error) {
+	var results []model.EndpointErrorRate
+
+	query := s.db.Model(&model.APILog{}).
+		Select(`endpoint_template as endpoint,
+			COUNT(*) as total_requests,
+			COUNT(*) FILTER (WHERE status_code BETWEEN 400 AND 499) as client_errors,
+			COUNT(*) FILTER (WHERE status_code >= 500) as server_errors,
+			(COUNT(*) FILTER (WHERE status_code >= 400))::float8 / COUNT(*) as error_rate`).
+		Where("timestamp >= ? AND timestamp < ? AND status_code > 0", start, end)
+
+	if clientID != nil {
+		query = query.Where("client_id = ?", *clientID)
+	}
+
+	err := query.Group("endpoint_template").
+		Order("error_rate DESC, total_requests DESC").
+		Limit(limit).
+		Scan(&results).Error
+	return results, err
+}
+
+// GetStatusClassBreakdown returns the number of hits per status class in a time
+// range. A nil clientID covers all clients.
+func (s *LogStore) GetStatusClassBreakdown(clientID *uuid.UUID, start, end time.Time) ([]model.StatusClassCount, error) {
+	var results []model.StatusClassCount
+
+	query := s.db.Model(&model.APILog{}).
+		Select(`CASE WHEN status_code = 0 THEN 'unknown' ELSE CONCAT(status_code / 100, 'xx') END as class,
+			COUNT(*) as count,
+			ROUND(COUNT(*) * 100.0 / SUM(COUNT(*)) OVER (), 2)::float8 as percentage`).
+		Where("timestamp >= ? AND timestamp < ?", start, end)
+
+	if clientID != nil {
+		query = query.Where("client_id = ?", *clientID)
+	}
+
+	err := query.Group("class").
+		Order("class").
+		Scan(&results).Error
+	return results, err
+}
+
 // DeleteOldLogs deletes logs older than the specified duration
 func (s *LogStore) DeleteOldLogs(olderThan time.Duration) (int64, error) {
 	cutoffTime := time.Now().UTC().Add(-olderThan)
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"nexmedis-golang/db"
+	"nexmedis-golang/model"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var (
+	testDBOnce sync.Once
+	testDBErr  error
+)
+
+// openTestDB connects db.DB to the Postgres named by TEST_DATABASE_URL and
+// migrates it. The database is shared by all tests, which use fresh clients
+// so nothing needs to be cleaned up. Tests are skipped when it is unset; CI
+// runs them against a Postgres service.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	testDBOnce.Do(func() {
+		db.DB, testDBErr = gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if testDBErr == nil {
+			testDBErr = db.AutoMigrate()
+		}
+	})
+	if testDBErr != nil {
+		t.Fatalf("failed to open the test database: %v", testDBErr)
+	}
+	return db.DB
+}
+
+// createTestClient creates a client to record logs for
+func createTestClient(t *testing.T, gdb *gorm.DB) *model.Client {
+	t.Helper()
+
+	client := &model.Client{Name: "Test", Email: uuid.NewString() + "@example.com"}
+	if err := NewClientStore(gdb).Create(client); err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return client
+}
+
+// testLog returns a log of a client, under an event ID unless it is empty
+func testLog(clientID uuid.UUID, eventID string) model.APILog {
+	log := model.APILog{
+		ID:        uuid.New(),
+		ClientID:  clientID,
+		IP:        "203.0.113.7",
+		Endpoint:  "/api/v1/users",
+		Timestamp: time.Now().UTC(),
+	}
+	if eventID != "" {
+		log.EventID = &eventID
+	}
+	return log
+}
+
+func TestLogStoreBatchCreate(t *testing.T) {
+	gdb := openTestDB(t)
+	client := createTestClient(t, gdb)
+	s := NewLogStore(gdb)
+
+	logs := []model.APILog{testLog(client.ID, ""), testLog(client.ID, ""), testLog(client.ID, "")}
+	skipped, err := s.BatchCreate(logs)
+	if err != nil {
+		t.Fatalf("BatchCreate() error = %v", err)
+	}
+	if len(skipped) != 0 {
+		t.Errorf("skipped %d logs, want none", len(skipped))
+	}
+
+	stored, err := s.ListByClient(client.ID, 0, 10)
+	if err != nil {
+		t.Fatalf("ListByClient() error = %v", err)
+	}
+	if len(stored) != 3 {
+		t.Errorf("stored %d logs, want 3", len(stored))
+	}
+}
+
+func TestLogStoreBatchCreateEmpty(t *testing.T) {
+	gdb := openTestDB(t)
+
+	if _, err := NewLogStore(gdb).BatchCreate(nil); err != nil {
+		t.Errorf("BatchCreate(nil) error = %v, want nil", err)
+	}
+}
+
+func TestLogStoreBatchCreateSkipsRecordedEvents(t *testing.T) {
+	gdb := openTestDB(t)
+	client := createTestClient(t, gdb)
+	s := NewLogStore(gdb)
+
+	first := testLog(client.ID, "evt-1")
+	if _, err := s.Create(&first); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	repeat, fresh := testLog(client.ID, "evt-1"), testLog(client.ID, "evt-2")
+	skipped, err := s.BatchCreate([]model.APILog{repeat, fresh})
+	if err != nil {
+		t.Fatalf("BatchCreate() error = %v", err)
+	}
+	if len(skipped) != 1 || skipped[repeat.ID] != first.ID {
+		t.Errorf("skipped = %v, want the repeat mapped to %s", skipped, first.ID)
+	}
+
+	if existing, err := s.FindByEventID(client.ID, "evt-2"); err != nil || existing.ID != fresh.ID {
+		t.Errorf("FindByEventID(evt-2) = %v, %v, want the new log", existing, err)
+	}
+
+	// The same event ID of another client is a different event
+	other := createTestClient(t, gdb)
+	skipped, err = s.BatchCreate([]model.APILog{testLog(other.ID, "evt-1")})
+	if err != nil || len(skipped) != 0 {
+		t.Errorf("BatchCreate() for another client = %v, %v, want it stored", skipped, err)
+	}
+}
+
+func TestLogStoreCreateReturnsRecordedEvent(t *testing.T) {
+	gdb := openTestDB(t)
+	client := createTestClient(t, gdb)
+	s := NewLogStore(gdb)
+
+	first := testLog(client.ID, "evt-1")
+	if _, err := s.Create(&first); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	repeat := testLog(client.ID, "evt-1")
+	stored, err := s.Create(&repeat)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if stored.ID != first.ID {
+		t.Errorf("Create() of a recorded event returned %s, want the existing log %s", stored.ID, first.ID)
+	}
+}
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"errors"
+	"nexmedis-golang/model"
+
+	"gorm.io/gorm"
+)
+
+// ErrPlanNotFound is returned when a plan does not exist
+var ErrPlanNotFound = errors.New("plan not found")
+
+// PlanStore handles database operations for plans
+type PlanStore struct {
+	db *gorm.DB
+}
+
+// NewPlanStore creates a new PlanStore instance
+func NewPlanStore(db *gorm.DB) *PlanStore {
+	return &PlanStore{db: db}
+}
+
+// List returns all plans, smallest hourly limit first
+func (s *PlanStore) List() ([]model.Plan, error) {
+	var plans []model.Plan
+	err := s.db.Order("hourly_limit ASC").Find(&plans).Error
+	return plans, err
+}
+
+// FindByName finds a plan by name
+func (s *PlanStore) FindByName(name string) (*model.Plan, error) {
+	var plan model.Plan
+	err := s.db.Where("name = ?", name).First(&plan).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPlanNotFound
+		}
+		return nil, err
+	}
+	return &plan, nil
+}
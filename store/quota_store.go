@@ -0,0 +1,568 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"nexmedis-golang/db"
+	"nexmedis-golang/model"
+	"nexmedis-golang/utils"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// quotaTermsCacheTTL is how long the quota, mode and billing anchor of a client are cached
+	quotaTermsCacheTTL = time.Minute
+	// quotaCounterGrace keeps the Redis counter of a period a while after the period ended
+	quotaCounterGrace = 7 * 24 * time.Hour
+)
+
+// consumeQuotaScript charges up to ARGV[1] hits to the period counter KEYS[1].
+// Under a hard quota (ARGV[3]) only the hits that fit in the quota ARGV[2] are
+// charged. It returns the hits charged and the new count, or -1 when the
+// counter does not exist yet and has to be seeded from Postgres.
+var consumeQuotaScript = redis.NewScript(`
+local used = redis.call('GET', KEYS[1])
+if not used then
+	return {-1, 0}
+end
+used = tonumber(used)
+
+local n = tonumber(ARGV[1])
+local quota = tonumber(ARGV[2])
+local granted = n
+if ARGV[3] == 'hard' and quota > 0 then
+	granted = math.max(math.min(n, quota - used), 0)
+end
+if granted > 0 then
+	used = redis.call('INCRBY', KEYS[1], granted)
+end
+return {granted, used}
+`)
+
+// releaseQuotaScript gives back ARGV[1] hits of the period counter KEYS[1],
+// without going below zero. Missing counters are left alone.
+var releaseQuotaScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local used = redis.call('DECRBY', KEYS[1], ARGV[1])
+if used < 0 then
+	redis.call('INCRBY', KEYS[1], -used)
+end
+return 1
+`)
+
+// quotaTerms are the quota settings of a client that every hit is checked against
+type quotaTerms struct {
+	Quota  int             `json:"quota"`
+	Mode   model.QuotaMode `json:"mode"`
+	Anchor time.Time       `json:"anchor"`
+}
+
+// quotaPeriodKey identifies the billing period of a client
+type quotaPeriodKey struct {
+	clientID uuid.UUID
+	start    int64 // Period start in Unix microseconds, as precise as Postgres
+}
+
+// quotaDelta holds hits counted in Redis that are not persisted yet
+type quotaDelta struct {
+	start time.Time
+	end   time.Time // Zero when only releases were counted
+	quota int
+	mode  model.QuotaMode
+	hits  int64
+}
+
+// QuotaStore counts the hits of each billing period against the monthly quota.
+// Once started, hits are counted in Redis and the counts are persisted to
+// Postgres in batches; while Redis is unavailable, and until started, every
+// hit is counted in Postgres directly.
+type QuotaStore struct {
+	db *gorm.DB
+
+	mu      sync.Mutex
+	started bool
+	pending map[quotaPeriodKey]*quotaDelta
+	stale   map[quotaPeriodKey]bool // Periods charged in Postgres since their Redis counter was seeded
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewQuotaStore creates a new QuotaStore instance
+func NewQuotaStore(db *gorm.DB) *QuotaStore {
+	return &QuotaStore{
+		db:      db,
+		pending: make(map[quotaPeriodKey]*quotaDelta),
+		stale:   make(map[quotaPeriodKey]bool),
+	}
+}
+
+// Start counts hits in Redis and persists the counts to Postgres every interval
+func (s *QuotaStore) Start(interval time.Duration) {
+	s.mu.Lock()
+	s.started = true
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	s.mu.Unlock()
+
+	go s.run(interval)
+
+	log.Printf("Quota counting in Redis started (flush interval=%s)", interval)
+}
+
+// Close stops the background persistence and persists the pending counts
+func (s *QuotaStore) Close() error {
+	s.mu.Lock()
+	started := s.started
+	s.started = false
+	s.mu.Unlock()
+
+	if !started {
+		return nil
+	}
+
+	close(s.stop)
+	<-s.done
+	return s.Flush()
+}
+
+// Flush persists the hits counted in Redis since the last flush. Counts that
+// fail to persist are kept for the next flush.
+func (s *QuotaStore) Flush() error {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[quotaPeriodKey]*quotaDelta)
+	s.mu.Unlock()
+
+	var firstErr error
+	for key, delta := range pending {
+		if err := s.persist(key.clientID, delta); err != nil {
+			s.mu.Lock()
+			s.addDelta(key, delta)
+			s.mu.Unlock()
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// Consume charges up to n hits against the quota of the client's current
+// billing period. Under a hard quota only the hits that still fit are
+// charged; under a soft quota every hit is charged and the hits beyond the
+// quota are recorded as overage. It returns the number of hits charged and
+// the updated period.
+func (s *QuotaStore) Consume(clientID uuid.UUID, n int, now time.Time) (int, *model.QuotaPeriod, error) {
+	ctx := context.Background()
+	if s.counting(ctx) {
+		granted, period, err := s.consumeRedis(ctx, clientID, n, now)
+		if err == nil {
+			return granted, period, nil
+		}
+		log.Printf("Failed to count quota in Redis, counting in Postgres: %v", err)
+	}
+
+	return s.consumePostgres(clientID, n, now)
+}
+
+// Release gives back hits that were charged to a period but not recorded
+func (s *QuotaStore) Release(clientID uuid.UUID, periodStart time.Time, n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	key := quotaPeriodKey{clientID: clientID, start: periodStart.UnixMicro()}
+	if s.counting(ctx) && !s.isStale(key) {
+		err := releaseQuotaScript.Run(ctx, db.RedisClient, []string{quotaCounterKey(key)}, n).Err()
+		if err == nil {
+			s.mu.Lock()
+			s.addDelta(key, &quotaDelta{start: periodStart, hits: -int64(n)})
+			s.mu.Unlock()
+			return nil
+		}
+		log.Printf("Failed to release quota in Redis, releasing in Postgres: %v", err)
+	}
+
+	return s.releasePostgres(clientID, periodStart, n)
+}
+
+// ReleaseHits gives back hits charged at the given times, each to the billing
+// period it fell into
+func (s *QuotaStore) ReleaseHits(clientID uuid.UUID, at []time.Time) error {
+	if len(at) == 0 {
+		return nil
+	}
+
+	terms, err := s.terms(context.Background(), clientID)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[time.Time]int)
+	for _, t := range at {
+		start, _ := utils.BillingPeriod(terms.Anchor, t)
+		counts[start]++
+	}
+
+	for start, n := range counts {
+		if err := s.Release(clientID, start, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InvalidateTerms drops the cached quota terms of a client after its plan,
+// boosts or billing anchor changed
+func (s *QuotaStore) InvalidateTerms(ctx context.Context, clientID uuid.UUID) error {
+	return db.CacheDelete(ctx, quotaTermsCacheKey(clientID))
+}
+
+// Current returns the client's current billing period. Periods without hits
+// are not stored yet and are returned empty.
+func (s *QuotaStore) Current(clientID uuid.UUID, now time.Time) (*model.QuotaPeriod, error) {
+	client, err := s.findClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	quota, mode := client.Quota()
+	start, end := utils.BillingPeriod(client.BillingCycleAnchor(), now)
+
+	var period model.QuotaPeriod
+	err = s.db.Where("client_id = ? AND period_start = ?", clientID, start).First(&period).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// Hits counted in Redis are ahead of Postgres until the next flush
+	ctx := context.Background()
+	key := quotaPeriodKey{clientID: clientID, start: start.UnixMicro()}
+	if s.counting(ctx) && !s.isStale(key) {
+		if used, err := db.RedisClient.Get(ctx, quotaCounterKey(key)).Int64(); err == nil {
+			period.Used = used
+		}
+	}
+
+	// Report the quota of the current plan, as the next hit will apply it
+	period.ClientID, period.PeriodStart, period.PeriodEnd = clientID, start, end
+	period.Quota, period.Mode = quota, mode
+	period.Overage = overage(quota, mode, period.Used)
+
+	return &period, nil
+}
+
+// ListByClient returns the billing periods of a client, newest first
+func (s *QuotaStore) ListByClient(clientID uuid.UUID, limit int) ([]model.QuotaPeriod, error) {
+	var periods []model.QuotaPeriod
+	err := s.db.Where("client_id = ?", clientID).
+		Order("period_start DESC").
+		Limit(limit).
+		Find(&periods).Error
+	return periods, err
+}
+
+// counting reports whether hits are counted in Redis right now
+func (s *QuotaStore) counting(ctx context.Context) bool {
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+	return started && db.IsRedisAvailable(ctx)
+}
+
+// run persists the counted hits every interval until the store is closed
+func (s *QuotaStore) run(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				log.Printf("Failed to persist quota counts: %v", err)
+			}
+		}
+	}
+}
+
+// consumeRedis charges hits to the Redis counter of the current period and
+// records them for the next flush
+func (s *QuotaStore) consumeRedis(ctx context.Context, clientID uuid.UUID, n int, now time.Time) (int, *model.QuotaPeriod, error) {
+	terms, err := s.terms(ctx, clientID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	start, end := utils.BillingPeriod(terms.Anchor, now)
+	key := quotaPeriodKey{clientID: clientID, start: start.UnixMicro()}
+	counter := quotaCounterKey(key)
+
+	// Hits were counted in Postgres while Redis was unavailable, so the
+	// counter is recreated from the persisted count
+	if s.isStale(key) {
+		if err := s.Flush(); err != nil {
+			return 0, nil, err
+		}
+		if err := db.CacheDelete(ctx, counter); err != nil {
+			return 0, nil, err
+		}
+		s.mu.Lock()
+		delete(s.stale, key)
+		s.mu.Unlock()
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		values, err := consumeQuotaScript.Run(ctx, db.RedisClient, []string{counter}, n, terms.Quota, string(terms.Mode)).Int64Slice()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if values[0] >= 0 {
+			granted, used := int(values[0]), values[1]
+			if granted > 0 {
+				s.mu.Lock()
+				s.addDelta(key, &quotaDelta{start: start, end: end, quota: terms.Quota, mode: terms.Mode, hits: int64(granted)})
+				s.mu.Unlock()
+			}
+
+			return granted, &model.QuotaPeriod{
+				ClientID:    clientID,
+				PeriodStart: start,
+				PeriodEnd:   end,
+				Quota:       terms.Quota,
+				Mode:        terms.Mode,
+				Used:        used,
+				Overage:     overage(terms.Quota, terms.Mode, used),
+			}, nil
+		}
+
+		// The first hit of the period, or after Redis lost the counter
+		if err := s.seed(ctx, key, counter, start, end); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return 0, nil, fmt.Errorf("quota counter %s could not be created", counter)
+}
+
+// seed creates the Redis counter of a period from the count persisted in
+// Postgres and the hits of this instance that are not persisted yet
+func (s *QuotaStore) seed(ctx context.Context, key quotaPeriodKey, counter string, start, end time.Time) error {
+	var period model.QuotaPeriod
+	err := s.db.Where("client_id = ? AND period_start = ?", key.clientID, start).First(&period).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	used := period.Used
+	s.mu.Lock()
+	if delta, ok := s.pending[key]; ok {
+		used = max(used+delta.hits, 0)
+	}
+	s.mu.Unlock()
+
+	return db.RedisClient.SetNX(ctx, counter, used, time.Until(end)+quotaCounterGrace).Err()
+}
+
+// consumePostgres charges hits to the period row in Postgres under a row lock
+func (s *QuotaStore) consumePostgres(clientID uuid.UUID, n int, now time.Time) (int, *model.QuotaPeriod, error) {
+	client, err := s.findClient(clientID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	quota, mode := client.Quota()
+	start, end := utils.BillingPeriod(client.BillingCycleAnchor(), now)
+
+	var period model.QuotaPeriod
+	granted := n
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Open the period on its first hit
+		opened := model.QuotaPeriod{ClientID: clientID, PeriodStart: start, PeriodEnd: end, Quota: quota, Mode: mode}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&opened).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("client_id = ? AND period_start = ?", clientID, start).
+			First(&period).Error; err != nil {
+			return err
+		}
+
+		// Plan changes apply to the running period
+		period.Quota, period.Mode = quota, mode
+		if quota > 0 && mode == model.QuotaHard {
+			granted = int(min(int64(n), max(int64(quota)-period.Used, 0)))
+		}
+		period.Used += int64(granted)
+		period.Overage = overage(period.Quota, period.Mode, period.Used)
+
+		return tx.Model(&period).Updates(map[string]interface{}{
+			"quota":   period.Quota,
+			"mode":    period.Mode,
+			"used":    period.Used,
+			"overage": period.Overage,
+		}).Error
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	s.markStale(quotaPeriodKey{clientID: clientID, start: start.UnixMicro()})
+	return granted, &period, nil
+}
+
+// releasePostgres gives back hits of a period row in Postgres
+func (s *QuotaStore) releasePostgres(clientID uuid.UUID, periodStart time.Time, n int) error {
+	s.markStale(quotaPeriodKey{clientID: clientID, start: periodStart.UnixMicro()})
+
+	return s.db.Exec(`
+		UPDATE quota_periods
+		SET used = GREATEST(used - ?, 0),
+			overage = CASE WHEN mode = ? AND quota > 0 THEN GREATEST(used - ? - quota, 0) ELSE 0 END,
+			updated_at = ?
+		WHERE client_id = ? AND period_start = ?
+	`, n, model.QuotaSoft, n, time.Now(), clientID, periodStart).Error
+}
+
+// persist adds the hits counted in Redis to the period row in Postgres,
+// opening the period when it has no row yet
+func (s *QuotaStore) persist(clientID uuid.UUID, delta *quotaDelta) error {
+	now := time.Now()
+	if delta.end.IsZero() {
+		// Only releases were counted, the period row exists if anything was charged
+		return s.db.Exec(`
+			UPDATE quota_periods
+			SET used = GREATEST(used + ?, 0),
+				overage = CASE WHEN mode = ? AND quota > 0 THEN GREATEST(used + ? - quota, 0) ELSE 0 END,
+				updated_at = ?
+			WHERE client_id = ? AND period_start = ?
+		`, delta.hits, model.QuotaSoft, delta.hits, now, clientID, delta.start).Error
+	}
+
+	used := max(delta.hits, 0)
+	return s.db.Exec(`
+		INSERT INTO quota_periods (id, client_id, period_start, period_end, quota, mode, used, overage, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (client_id, period_start) DO UPDATE
+		SET used = GREATEST(quota_periods.used + ?, 0),
+			quota = EXCLUDED.quota,
+			mode = EXCLUDED.mode,
+			overage = CASE WHEN EXCLUDED.mode = ? AND EXCLUDED.quota > 0
+				THEN GREATEST(quota_periods.used + ? - EXCLUDED.quota, 0) ELSE 0 END,
+			updated_at = EXCLUDED.updated_at
+	`, uuid.New(), clientID, delta.start, delta.end, delta.quota, delta.mode, used, overage(delta.quota, delta.mode, used), now, now,
+		delta.hits, model.QuotaSoft, delta.hits).Error
+}
+
+// addDelta merges counted hits into the pending ones. The caller holds s.mu.
+func (s *QuotaStore) addDelta(key quotaPeriodKey, delta *quotaDelta) {
+	current, ok := s.pending[key]
+	if !ok {
+		copied := *delta
+		s.pending[key] = &copied
+		return
+	}
+
+	current.hits += delta.hits
+	if !delta.end.IsZero() {
+		current.end, current.quota, current.mode = delta.end, delta.quota, delta.mode
+	}
+}
+
+// markStale records that a period was charged in Postgres behind the back of
+// its Redis counter
+func (s *QuotaStore) markStale(key quotaPeriodKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		s.stale[key] = true
+	}
+}
+
+// isStale reports whether the Redis counter of a period misses hits
+func (s *QuotaStore) isStale(key quotaPeriodKey) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stale[key]
+}
+
+// terms returns the quota terms of a client, cached in Redis
+func (s *QuotaStore) terms(ctx context.Context, clientID uuid.UUID) (quotaTerms, error) {
+	cacheKey := quotaTermsCacheKey(clientID)
+
+	var terms quotaTerms
+	if db.IsRedisAvailable(ctx) {
+		if err := db.CacheGet(ctx, cacheKey, &terms); err == nil {
+			return terms, nil
+		}
+	}
+
+	client, err := s.findClient(clientID)
+	if err != nil {
+		return terms, err
+	}
+
+	terms.Quota, terms.Mode = client.Quota()
+	terms.Anchor = client.BillingCycleAnchor()
+
+	if db.IsRedisAvailable(ctx) {
+		// Stop applying a boosted quota once the first boost expires
+		ttl := quotaTermsCacheTTL
+		if expiry, ok := client.NextBoostExpiry(); ok {
+			ttl = min(ttl, max(time.Until(expiry), time.Second))
+		}
+		_ = db.CacheSet(ctx, cacheKey, terms, ttl)
+	}
+
+	return terms, nil
+}
+
+// quotaCounterKey generates the Redis key counting the hits of a period
+func quotaCounterKey(key quotaPeriodKey) string {
+	return fmt.Sprintf("quota:used:%s:%d", key.clientID, key.start)
+}
+
+// quotaTermsCacheKey generates the Redis key caching the quota terms of a client
+func quotaTermsCacheKey(clientID uuid.UUID) string {
+	return fmt.Sprintf("quota:terms:%s", clientID)
+}
+
+// findClient loads a client together with its plan and active boosts
+func (s *QuotaStore) findClient(clientID uuid.UUID) (*model.Client, error) {
+	var client model.Client
+	err := s.db.Preload("Plan").Preload("Boosts", "expires_at > ?", time.Now()).Where("id = ?", clientID).First(&client).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("client not found")
+		}
+		return nil, err
+	}
+	return &client, nil
+}
+
+// overage returns the hits beyond a soft quota
+func overage(quota int, mode model.QuotaMode, used int64) int64 {
+	if quota <= 0 || mode != model.QuotaSoft {
+		return 0
+	}
+	return max(used-int64(quota), 0)
+}
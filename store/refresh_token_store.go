@@ -0,0 +1,175 @@
+package store
+
+import (
+	"errors"
+	"nexmedis-golang/model"
+	"nexmedis-golang/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrRefreshTokenInvalid is returned for unknown, expired or revoked refresh
+	// tokens, and for tokens whose API key is expired or revoked
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is
+	// presented again. Its whole family is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token was already used")
+)
+
+// RefreshTokenStore handles database operations for refresh tokens
+type RefreshTokenStore struct {
+	db *gorm.DB
+}
+
+// NewRefreshTokenStore creates a new RefreshTokenStore instance
+func NewRefreshTokenStore(db *gorm.DB) *RefreshTokenStore {
+	return &RefreshTokenStore{db: db}
+}
+
+// Issue creates the first refresh token of a new family for the client of an
+// API key and returns the token along with its record. Every token of the
+// family grants the scopes of the key and expires no later than the key.
+func (s *RefreshTokenStore) Issue(key *model.APIKey, lifetime time.Duration) (string, *model.RefreshToken, error) {
+	expiresAt := keyBoundExpiry(time.Now().Add(lifetime), key)
+	return s.issue(s.db, key.ClientID, uuid.New(), &key.ID, key.Scopes, expiresAt)
+}
+
+// Rotate exchanges a refresh token for a new one of the same family. A token
+// can only be rotated once; presenting it again revokes the whole family,
+// since either the client or an attacker holds a stolen copy. The family is
+// also revoked once the API key it was started with is expired or revoked.
+func (s *RefreshTokenStore) Rotate(token string, lifetime time.Duration) (string, *model.RefreshToken, error) {
+	var (
+		issued   string
+		next     *model.RefreshToken
+		reused   bool
+		keyEnded bool
+	)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var current model.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(token)).
+			First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRefreshTokenInvalid
+			}
+			return err
+		}
+
+		now := time.Now()
+		if current.RevokedAt != nil || !current.ExpiresAt.After(now) {
+			return ErrRefreshTokenInvalid
+		}
+
+		if current.UsedAt != nil {
+			reused = true
+			return revokeRefreshTokens(tx.Where("family_id = ?", current.FamilyID), now)
+		}
+
+		expiresAt := now.Add(lifetime)
+		if current.APIKeyID != nil {
+			var key model.APIKey
+			err := tx.Where("id = ?", *current.APIKeyID).First(&key).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			if err != nil || key.StatusAt(now) != model.APIKeyActive {
+				keyEnded = true
+				return revokeRefreshTokens(tx.Where("family_id = ?", current.FamilyID), now)
+			}
+			expiresAt = keyBoundExpiry(expiresAt, &key)
+		}
+
+		if err := tx.Model(&current).Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		var err error
+		issued, next, err = s.issue(tx, current.ClientID, current.FamilyID, current.APIKeyID, current.Scopes, expiresAt)
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if reused {
+		return "", nil, ErrRefreshTokenReused
+	}
+	if keyEnded {
+		return "", nil, ErrRefreshTokenInvalid
+	}
+
+	return issued, next, nil
+}
+
+// Find returns the record of a refresh token, whether or not it is still active
+func (s *RefreshTokenStore) Find(token string) (*model.RefreshToken, error) {
+	var record model.RefreshToken
+	if err := s.db.Where("token_hash = ?", utils.HashToken(token)).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRefreshTokenInvalid
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// RevokeFamily revokes a refresh token together with every token of its
+// family. Unknown tokens are ignored.
+func (s *RefreshTokenStore) RevokeFamily(token string) error {
+	var current model.RefreshToken
+	if err := s.db.Where("token_hash = ?", utils.HashToken(token)).First(&current).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	return revokeRefreshTokens(s.db.Where("family_id = ?", current.FamilyID), time.Now())
+}
+
+// RevokeByClient revokes every refresh token of a client
+func (s *RefreshTokenStore) RevokeByClient(clientID uuid.UUID) error {
+	return revokeRefreshTokens(s.db.Where("client_id = ?", clientID), time.Now())
+}
+
+// issue creates a refresh token in a family
+func (s *RefreshTokenStore) issue(tx *gorm.DB, clientID, familyID uuid.UUID, apiKeyID *uuid.UUID, scopes string, expiresAt time.Time) (string, *model.RefreshToken, error) {
+	token, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	record := &model.RefreshToken{
+		FamilyID:  familyID,
+		ClientID:  clientID,
+		APIKeyID:  apiKeyID,
+		TokenHash: utils.HashToken(token),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := tx.Create(record).Error; err != nil {
+		return "", nil, err
+	}
+
+	return token, record, nil
+}
+
+// keyBoundExpiry caps the expiry of a refresh token at the expiry of its API key
+func keyBoundExpiry(expiresAt time.Time, key *model.APIKey) time.Time {
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(expiresAt) {
+		return *key.ExpiresAt
+	}
+	return expiresAt
+}
+
+// revokeRefreshTokens revokes the refresh tokens matched by scope that are not revoked yet
+func revokeRefreshTokens(scope *gorm.DB, now time.Time) error {
+	return scope.Model(&model.RefreshToken{}).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", now).Error
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"errors"
+	"nexmedis-golang/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RouteTemplateStore handles database operations for route templates
+type RouteTemplateStore struct {
+	db *gorm.DB
+}
+
+// NewRouteTemplateStore creates a new RouteTemplateStore instance
+func NewRouteTemplateStore(db *gorm.DB) *RouteTemplateStore {
+	return &RouteTemplateStore{db: db}
+}
+
+// Create creates a new route template
+func (s *RouteTemplateStore) Create(template *model.RouteTemplate) error {
+	return s.db.Create(template).Error
+}
+
+// ListByClient returns the route templates of a client, most specific first
+func (s *RouteTemplateStore) ListByClient(clientID uuid.UUID) ([]model.RouteTemplate, error) {
+	var templates []model.RouteTemplate
+	err := s.db.Where("client_id = ?", clientID).
+		Order("length(pattern) DESC, pattern").
+		Find(&templates).Error
+	return templates, err
+}
+
+// ExistsByPattern checks if a client already has a route template with the given pattern
+func (s *RouteTemplateStore) ExistsByPattern(clientID uuid.UUID, pattern string) (bool, error) {
+	var count int64
+	err := s.db.Model(&model.RouteTemplate{}).
+		Where("client_id = ? AND pattern = ?", clientID, pattern).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// CountByClient returns the number of route templates of a client
+func (s *RouteTemplateStore) CountByClient(clientID uuid.UUID) (int64, error) {
+	var count int64
+	err := s.db.Model(&model.RouteTemplate{}).
+		Where("client_id = ?", clientID).
+		Count(&count).Error
+	return count, err
+}
+
+// Delete deletes a route template of a client
+func (s *RouteTemplateStore) Delete(clientID, id uuid.UUID) error {
+	result := s.db.Where("client_id = ? AND id = ?", clientID, id).Delete(&model.RouteTemplate{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("route template not found")
+	}
+	return nil
+}
@@ -2,10 +2,24 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 )
 
+// APIKeyPrefixLength is the number of leading characters that identify an API key
+const APIKeyPrefixLength = 8
+
+// APIKeyPrefix returns the leading characters of an API key, which identify
+// the key without revealing it
+func APIKeyPrefix(apiKey string) string {
+	if len(apiKey) <= APIKeyPrefixLength {
+		return apiKey
+	}
+	return apiKey[:APIKeyPrefixLength]
+}
+
 // GenerateAPIKey generates a random API key
 func GenerateAPIKey() (string, error) {
 	bytes := make([]byte, 32)
@@ -14,3 +28,29 @@ func GenerateAPIKey() (string, error) {
 	}
 	return base64.URLEncoding.EncodeToString(bytes), nil
 }
+
+// GenerateRefreshToken generates a random opaque refresh token
+func GenerateRefreshToken() (string, error) {
+	return randomToken()
+}
+
+// GenerateVerificationToken generates a random opaque email verification token
+func GenerateVerificationToken() (string, error) {
+	return randomToken()
+}
+
+// randomToken returns 32 random bytes encoded for use in URLs
+func randomToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// HashToken returns the SHA-256 hex digest of a token, which is what is
+// stored instead of the token itself
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	uuidSegment    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	numericSegment = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// NormalizeEndpoint maps a raw endpoint to its route template. The query string
+// is stripped, the first matching pattern wins, and when no pattern matches,
+// UUID and numeric path segments are replaced with ":uuid" and ":id".
+func NormalizeEndpoint(endpoint string, patterns []string) string {
+	path := StripQuery(endpoint)
+
+	for _, pattern := range patterns {
+		if MatchRoutePattern(pattern, path) {
+			return pattern
+		}
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		switch {
+		case uuidSegment.MatchString(segment):
+			segments[i] = ":uuid"
+		case numericSegment.MatchString(segment):
+			segments[i] = ":id"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// StripQuery removes the query string and fragment from an endpoint
+func StripQuery(endpoint string) string {
+	if i := strings.IndexAny(endpoint, "?#"); i >= 0 {
+		return endpoint[:i]
+	}
+	return endpoint
+}
+
+// MatchRoutePattern reports whether a path matches a route pattern. A ":name"
+// segment matches any single non-empty segment and a trailing "*" matches the
+// rest of the path.
+func MatchRoutePattern(pattern, path string) bool {
+	patternSegments := strings.Split(strings.TrimSuffix(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+
+	for i, segment := range patternSegments {
+		if segment == "*" && i == len(patternSegments)-1 {
+			return len(pathSegments) >= i
+		}
+
+		if i >= len(pathSegments) {
+			return false
+		}
+
+		if strings.HasPrefix(segment, ":") {
+			if pathSegments[i] == "" {
+				return false
+			}
+			continue
+		}
+
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+
+	return len(patternSegments) == len(pathSegments)
+}
+
+// ValidateRoutePattern validates a route template pattern
+func ValidateRoutePattern(pattern string) error {
+	if err := ValidateEndpoint(pattern); err != nil {
+		return err
+	}
+
+	if len(pattern) > 255 {
+		return fmt.Errorf("pattern must not exceed 255 characters")
+	}
+
+	if strings.ContainsAny(pattern, "?#") {
+		return fmt.Errorf("pattern must not contain a query string")
+	}
+
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if segment == "*" && i != len(segments)-1 {
+			return fmt.Errorf("'*' is only allowed as the last segment")
+		}
+
+		if segment == ":" {
+			return fmt.Errorf("parameter segments must be named, e.g. ':id'")
+		}
+	}
+
+	return nil
+}
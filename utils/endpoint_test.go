@@ -0,0 +1,44 @@
+package utils
+
+import "testing"
+
+func TestNormalizeEndpoint(t *testing.T) {
+	patterns := []string{
+		"/api/orders/:order/items",
+		"/api/orders/:order",
+		"/static/*",
+	}
+
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"/api/users", "/api/users"},
+		{"/api/users/123", "/api/users/:id"},
+		{"/api/users/123?expand=true#top", "/api/users/:id"},
+		{"/api/users/6f1c2d3e-4b5a-4c6d-8e7f-9a0b1c2d3e4f/keys/7", "/api/users/:uuid/keys/:id"},
+		{"/api/users/6F1C2D3E-4B5A-4C6D-8E7F-9A0B1C2D3E4F", "/api/users/:uuid"},
+		{"/api/users/abc123", "/api/users/abc123"},
+		{"/api/orders/abc", "/api/orders/:order"},
+		{"/api/orders/abc/", "/api/orders/:order"},
+		{"/api/orders/abc/items?page=2", "/api/orders/:order/items"},
+		{"/api/orders/abc/items/5", "/api/orders/abc/items/:id"},
+		{"/api/orders//items", "/api/orders//items"},
+		{"/static/css/site.css", "/static/*"},
+		{"/static", "/static/*"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeEndpoint(tt.endpoint, patterns); got != tt.want {
+			t.Errorf("NormalizeEndpoint(%q) = %q, want %q", tt.endpoint, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeEndpointFirstPatternWins(t *testing.T) {
+	patterns := []string{"/api/:resource/:id", "/api/users/:id"}
+
+	if got := NormalizeEndpoint("/api/users/42", patterns); got != "/api/:resource/:id" {
+		t.Errorf("NormalizeEndpoint() = %q, want the first matching pattern", got)
+	}
+}
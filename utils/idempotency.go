@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"nexmedis-golang/db"
+
+	"github.com/google/uuid"
+)
+
+// ErrIdempotencyUnavailable is returned when idempotency keys cannot be checked in Redis
+var ErrIdempotencyUnavailable = errors.New("idempotency store not available")
+
+// IdempotencyStore deduplicates retried log requests within a time window
+type IdempotencyStore struct {
+	window time.Duration
+}
+
+// NewIdempotencyStore creates a new idempotency store
+func NewIdempotencyStore(window time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{
+		window: window,
+	}
+}
+
+// Reserve claims an idempotency key of a client for logID. When the key was
+// already claimed within the window, it returns the original log ID and false.
+func (s *IdempotencyStore) Reserve(ctx context.Context, clientID uuid.UUID, key string, logID uuid.UUID) (uuid.UUID, bool, error) {
+	if !db.IsRedisAvailable(ctx) {
+		return uuid.Nil, false, ErrIdempotencyUnavailable
+	}
+
+	redisKey := s.getIdempotencyKey(clientID, key)
+
+	reserved, err := db.RedisClient.SetNX(ctx, redisKey, logID.String(), s.window).Result()
+	if err != nil {
+		return uuid.Nil, false, ErrIdempotencyUnavailable
+	}
+	if reserved {
+		return logID, true, nil
+	}
+
+	original, err := db.RedisClient.Get(ctx, redisKey).Result()
+	if err != nil {
+		return uuid.Nil, false, ErrIdempotencyUnavailable
+	}
+
+	originalID, err := uuid.Parse(original)
+	if err != nil {
+		return uuid.Nil, false, fmt.Errorf("invalid idempotency record: %w", err)
+	}
+
+	return originalID, false, nil
+}
+
+// Release removes a reservation whose request did not end up recording a log
+func (s *IdempotencyStore) Release(ctx context.Context, clientID uuid.UUID, key string) error {
+	return db.CacheDelete(ctx, s.getIdempotencyKey(clientID, key))
+}
+
+// getIdempotencyKey generates the Redis key for an idempotency key
+func (s *IdempotencyStore) getIdempotencyKey(clientID uuid.UUID, key string) string {
+	return fmt.Sprintf("idempotency:%s:%s", clientID.String(), key)
+}
@@ -2,7 +2,11 @@ package utils
 
 import (
 	"errors"
+	"fmt"
+	"log"
+	"nexmedis-golang/model"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -13,61 +17,178 @@ import (
 type JWTClaims struct {
 	ClientID uuid.UUID `json:"client_id"`
 	Email    string    `json:"email"`
+	Scope    string    `json:"scope,omitempty"` // Space-separated scopes inherited from the API key
+	Role     string    `json:"role,omitempty"`  // Role of the client when the token was issued
 	jwt.RegisteredClaims
 }
 
-var jwtSecret []byte
+// Scopes returns the scopes granted by the token
+func (c *JWTClaims) Scopes() []string {
+	return model.SplitScopes(c.Scope)
+}
 
-// InitJWT initializes the JWT secret
-func InitJWT() {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "default-secret-change-in-production"
+// RoleName returns the role granted by the token. Tokens issued before roles
+// were introduced belong to regular clients.
+func (c *JWTClaims) RoleName() string {
+	if c.Role == "" {
+		return model.RoleClient
 	}
-	jwtSecret = []byte(secret)
+	return c.Role
+}
+
+// defaultJWTSecret is only used outside production when no key is configured
+const defaultJWTSecret = "default-secret-change-in-production"
+
+var (
+	jwtOnce     sync.Once
+	jwtSecret   []byte
+	jwtSigner   *signingKey
+	jwtVerifier map[string]*verificationKey
+)
+
+// IsProduction reports whether the app runs in production (APP_ENV=production)
+func IsProduction() bool {
+	return os.Getenv("APP_ENV") == "production"
+}
+
+// InitJWT loads the signing and verification keys. Tokens are signed with the
+// RS256 or EdDSA key in JWT_SIGNING_KEY_FILE when set, and with the HS256
+// JWT_SECRET otherwise. Public keys in JWT_VERIFICATION_KEY_FILES are accepted
+// as well, so tokens signed with a previous key stay valid during rotation. In
+// production a key must be configured.
+func InitJWT() error {
+	var err error
+	jwtOnce.Do(func() {
+		err = loadJWTKeys()
+	})
+	return err
 }
 
-// GenerateJWT generates a JWT token for a client
-func GenerateJWT(clientID uuid.UUID, email string) (string, error) {
-	if len(jwtSecret) == 0 {
-		InitJWT()
+// loadJWTKeys reads the JWT key configuration from the environment
+func loadJWTKeys() error {
+	jwtVerifier = make(map[string]*verificationKey)
+
+	if path := os.Getenv("JWT_SIGNING_KEY_FILE"); path != "" {
+		signer, public, err := loadSigningKey(path)
+		if err != nil {
+			return fmt.Errorf("invalid JWT signing key: %w", err)
+		}
+		jwtSigner = signer
+		jwtVerifier[public.jwk.Kid] = public
+	}
+
+	for _, path := range splitKeyFiles(os.Getenv("JWT_VERIFICATION_KEY_FILES")) {
+		public, err := loadVerificationKey(path)
+		if err != nil {
+			return fmt.Errorf("invalid JWT verification key: %w", err)
+		}
+		jwtVerifier[public.jwk.Kid] = public
+	}
+
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		jwtSecret = []byte(secret)
 	}
 
-	expirationTime := time.Now().Add(24 * time.Hour)
+	if jwtSigner == nil && jwtSecret == nil {
+		if IsProduction() {
+			return errors.New("JWT_SIGNING_KEY_FILE or JWT_SECRET must be set in production")
+		}
+		log.Println("Warning: no JWT key configured, signing tokens with the default secret")
+		jwtSecret = []byte(defaultJWTSecret)
+	}
+
+	return nil
+}
 
-	// Get custom expiration from env if set
-	if expStr := os.Getenv("JWT_EXPIRATION"); expStr != "" {
-		if exp, err := time.ParseDuration(expStr); err == nil {
-			expirationTime = time.Now().Add(exp)
+// JWKS returns the public verification keys for other services
+func JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	if err := InitJWT(); err != nil {
+		return set
+	}
+
+	// The signing key comes first
+	if jwtSigner != nil {
+		set.Keys = append(set.Keys, jwtVerifier[jwtSigner.kid].jwk)
+	}
+	for kid, key := range jwtVerifier {
+		if jwtSigner == nil || kid != jwtSigner.kid {
+			set.Keys = append(set.Keys, key.jwk)
 		}
 	}
 
+	return set
+}
+
+// GenerateJWT generates a short-lived access token for a client with the
+// given role and scopes and returns it with its expiry
+func GenerateJWT(clientID uuid.UUID, email, role string, scopes []string) (string, time.Time, error) {
+	if err := InitJWT(); err != nil {
+		return "", time.Time{}, err
+	}
+
+	expirationTime := time.Now().Add(TokenLifetime())
+
 	claims := &JWTClaims{
 		ClientID: clientID,
 		Email:    email,
+		Scope:    model.JoinScopes(scopes),
+		Role:     role,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	var (
+		signed string
+		err    error
+	)
+	if jwtSigner != nil {
+		token := jwt.NewWithClaims(jwt.GetSigningMethod(jwtSigner.alg), claims)
+		token.Header["kid"] = jwtSigner.kid
+		signed, err = token.SignedString(jwtSigner.key)
+	} else {
+		signed, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return signed, claims.ExpiresAt.Time, nil
+}
+
+// TokenLifetime returns how long access tokens are valid (JWT_EXPIRATION, default 15m)
+func TokenLifetime() time.Duration {
+	return durationFromEnv("JWT_EXPIRATION", 15*time.Minute)
+}
+
+// RefreshTokenLifetime returns how long a refresh token is valid after it
+// was issued (REFRESH_TOKEN_EXPIRATION, default 30 days)
+func RefreshTokenLifetime() time.Duration {
+	return durationFromEnv("REFRESH_TOKEN_EXPIRATION", 30*24*time.Hour)
+}
+
+// durationFromEnv reads a positive duration from an environment variable
+func durationFromEnv(key string, defaultValue time.Duration) time.Duration {
+	if expStr := os.Getenv(key); expStr != "" {
+		if exp, err := time.ParseDuration(expStr); err == nil && exp > 0 {
+			return exp
+		}
+	}
+	return defaultValue
 }
 
 // ValidateJWT validates a JWT token and returns the claims
 func ValidateJWT(tokenString string) (*JWTClaims, error) {
-	if len(jwtSecret) == 0 {
-		InitJWT()
+	if err := InitJWT(); err != nil {
+		return nil, err
 	}
 
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
-		}
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, verificationKeyFor,
+		jwt.WithValidMethods([]string{"RS256", "EdDSA", "HS256"}))
 
 	if err != nil {
 		return nil, err
@@ -80,22 +201,14 @@ func ValidateJWT(tokenString string) (*JWTClaims, error) {
 	return nil, errors.New("invalid token")
 }
 
-// RefreshJWT generates a new JWT token from an existing valid token
-func RefreshJWT(tokenString string) (string, error) {
-	claims, err := ValidateJWT(tokenString)
-	if err != nil {
-		return "", err
-	}
-
-	return GenerateJWT(claims.ClientID, claims.Email)
-}
-
 // GetTokenExpiration retrieves the expiration time of a JWT token
 func GetTokenExpiration(tokenString string) (time.Time, error) {
+	if err := InitJWT(); err != nil {
+		return time.Time{}, err
+	}
+
 	claims := &JWTClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKeyFor)
 
 	if err != nil || !token.Valid {
 		return time.Time{}, err
@@ -103,3 +216,25 @@ func GetTokenExpiration(tokenString string) (time.Time, error) {
 
 	return time.Unix(claims.ExpiresAt.Unix(), 0), nil
 }
+
+// verificationKeyFor picks the key a token is verified with. Tokens with a
+// kid header must match a configured public key and its algorithm; tokens
+// without one are only accepted when an HS256 secret is configured.
+func verificationKeyFor(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || jwtSecret == nil {
+			return nil, errors.New("invalid signing method")
+		}
+		return jwtSecret, nil
+	}
+
+	key, ok := jwtVerifier[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.alg {
+		return nil, errors.New("invalid signing method")
+	}
+	return key.key, nil
+}
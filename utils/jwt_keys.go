@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// minRSAKeyBits is the smallest RSA modulus accepted for signing keys
+const minRSAKeyBits = 2048
+
+// JSONWebKey is the public part of a verification key as published in the JWKS
+type JSONWebKey struct {
+	Kty string `json:"kty"`           // Key type (RSA or OKP)
+	Kid string `json:"kid"`           // Key ID, matching the kid header of tokens
+	Use string `json:"use"`           // Key use (sig)
+	Alg string `json:"alg"`           // Signing algorithm (RS256 or EdDSA)
+	Crv string `json:"crv,omitempty"` // Curve of OKP keys (Ed25519)
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA public exponent
+	X   string `json:"x,omitempty"`   // Ed25519 public key
+}
+
+// JSONWebKeySet is the document served at /.well-known/jwks.json
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// verificationKey is a public key that tokens are verified against
+type verificationKey struct {
+	alg string
+	key crypto.PublicKey
+	jwk JSONWebKey
+}
+
+// signingKey is the private key new tokens are signed with
+type signingKey struct {
+	kid string
+	alg string
+	key crypto.Signer
+}
+
+// loadSigningKey reads an RSA or Ed25519 private key from a PEM file
+func loadSigningKey(path string) (*signingKey, *verificationKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var parsed interface{}
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse private key %s: %w", path, err)
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported private key type in %s", path)
+	}
+
+	public, err := newVerificationKey(signer.Public())
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &signingKey{kid: public.jwk.Kid, alg: public.alg, key: signer}, public, nil
+}
+
+// loadVerificationKey reads an RSA or Ed25519 public key from a PEM file
+func loadVerificationKey(path string) (*verificationKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed interface{}
+	if block.Type == "RSA PUBLIC KEY" {
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %w", path, err)
+	}
+
+	key, err := newVerificationKey(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// newVerificationKey describes a public key as a JWK. The key ID is the RFC
+// 7638 thumbprint, so it stays the same wherever the key is loaded.
+func newVerificationKey(public crypto.PublicKey) (*verificationKey, error) {
+	var (
+		jwk        JSONWebKey
+		thumbprint string
+	)
+
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA keys must have at least %d bits", minRSAKeyBits)
+		}
+		jwk = JSONWebKey{
+			Kty: "RSA",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}
+		thumbprint = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	case ed25519.PublicKey:
+		jwk = JSONWebKey{
+			Kty: "OKP",
+			Alg: "EdDSA",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}
+		thumbprint = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":%q}`, jwk.X)
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+
+	sum := sha256.Sum256([]byte(thumbprint))
+	jwk.Kid = base64.RawURLEncoding.EncodeToString(sum[:])
+	jwk.Use = "sig"
+
+	return &verificationKey{alg: jwk.Alg, key: public, jwk: jwk}, nil
+}
+
+// readPEM reads the first PEM block of a file
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	return block, nil
+}
+
+// splitKeyFiles splits a comma-separated list of key files
+func splitKeyFiles(value string) []string {
+	var paths []string
+	for _, path := range strings.Split(value, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
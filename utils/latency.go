@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Latencies are rolled up into logarithmic buckets (as in DDSketch): bucket i
+// holds durations in (gamma^(i-1), gamma^i]. Histograms are merged by adding
+// counts, and every quantile read from them is within LatencyRelativeAccuracy
+// of the exact value.
+const (
+	// LatencyRelativeAccuracy is the maximum relative error of a reported percentile
+	LatencyRelativeAccuracy = 0.01
+	// LatencyMinMs is the smallest distinguishable duration; shorter ones share its bucket
+	LatencyMinMs = 0.01
+	// MaxDurationMs is the longest duration accepted on a logged hit (1 hour)
+	MaxDurationMs = 3600000
+)
+
+// LatencyGamma is the ratio between the bounds of consecutive latency buckets
+var LatencyGamma = (1 + LatencyRelativeAccuracy) / (1 - LatencyRelativeAccuracy)
+
+// LatencyBucketCount is the number of hits that fell into a latency bucket
+type LatencyBucketCount struct {
+	Bucket int
+	Count  int64
+}
+
+// LatencyBucket returns the histogram bucket of a duration in milliseconds
+func LatencyBucket(durationMs float64) int {
+	return int(math.Ceil(math.Log(math.Max(durationMs, LatencyMinMs)) / math.Log(LatencyGamma)))
+}
+
+// LatencyBucketValue returns the representative duration of a bucket, chosen
+// so that it is within the relative accuracy of every value in the bucket
+func LatencyBucketValue(bucket int) float64 {
+	return 2 * math.Pow(LatencyGamma, float64(bucket)) / (LatencyGamma + 1)
+}
+
+// LatencyQuantiles estimates the given quantiles (0-1) from a latency histogram.
+// It returns the total count and one value in milliseconds per quantile.
+func LatencyQuantiles(buckets []LatencyBucketCount, quantiles ...float64) (int64, []float64) {
+	sorted := make([]LatencyBucketCount, len(buckets))
+	copy(sorted, buckets)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Bucket < sorted[j].Bucket })
+
+	var total int64
+	for _, b := range sorted {
+		total += b.Count
+	}
+
+	values := make([]float64, len(quantiles))
+	if total == 0 {
+		return 0, values
+	}
+
+	for i, q := range quantiles {
+		// Rank of the quantile among all hits, 0-based
+		rank := int64(math.Ceil(q*float64(total))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+
+		var seen int64
+		for _, b := range sorted {
+			seen += b.Count
+			if seen > rank {
+				values[i] = math.Round(LatencyBucketValue(b.Bucket)*100) / 100
+				break
+			}
+		}
+	}
+
+	return total, values
+}
+
+// ParseWindow parses a lookback window such as "1h", "24h" or "7d". Windows
+// are rounded up to whole hours, the granularity of the latency rollups.
+func ParseWindow(value string, defaultWindow, maxWindow time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultWindow, nil
+	}
+
+	var window time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid window, use a duration such as 1h, 24h or 7d")
+		}
+		window = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid window, use a duration such as 1h, 24h or 7d")
+		}
+		window = d
+	}
+
+	if window <= 0 || window > maxWindow {
+		return 0, fmt.Errorf("window must be between 1h and %dd", int(maxWindow/(24*time.Hour)))
+	}
+
+	if window%time.Hour != 0 {
+		window = window.Truncate(time.Hour) + time.Hour
+	}
+
+	return window, nil
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLatencyQuantiles(t *testing.T) {
+	// One hit for every duration from 1ms to 1000ms, added in reverse so the
+	// buckets arrive unsorted
+	counts := make(map[int]int64)
+	for ms := 1000; ms >= 1; ms-- {
+		counts[LatencyBucket(float64(ms))]++
+	}
+	buckets := make([]LatencyBucketCount, 0, len(counts))
+	for bucket, count := range counts {
+		buckets = append(buckets, LatencyBucketCount{Bucket: bucket, Count: count})
+	}
+
+	total, values := LatencyQuantiles(buckets, 0, 0.5, 0.9, 0.99, 1)
+	if total != 1000 {
+		t.Fatalf("total = %d, want 1000", total)
+	}
+
+	exact := []float64{1, 500, 900, 990, 1000}
+	for i, want := range exact {
+		// Values are rounded to 0.01ms on top of the relative error
+		if math.Abs(values[i]-want) > want*LatencyRelativeAccuracy+0.005 {
+			t.Errorf("quantile %d = %v, want %v within %v%%", i, values[i], want, LatencyRelativeAccuracy*100)
+		}
+	}
+}
+
+func TestLatencyQuantilesEmpty(t *testing.T) {
+	total, values := LatencyQuantiles(nil, 0.5, 0.99)
+	if total != 0 {
+		t.Errorf("total = %d, want 0", total)
+	}
+	if len(values) != 2 || values[0] != 0 || values[1] != 0 {
+		t.Errorf("values = %v, want [0 0]", values)
+	}
+}
+
+func TestLatencyQuantilesMergesBuckets(t *testing.T) {
+	// The same bucket reported twice, as when merging hourly rollups
+	buckets := []LatencyBucketCount{
+		{Bucket: LatencyBucket(200), Count: 1},
+		{Bucket: LatencyBucket(10), Count: 2},
+		{Bucket: LatencyBucket(10), Count: 2},
+	}
+
+	total, values := LatencyQuantiles(buckets, 0.8, 0.81)
+	if total != 5 {
+		t.Fatalf("total = %d, want 5", total)
+	}
+	if math.Abs(values[0]-10) > 10*LatencyRelativeAccuracy+0.005 {
+		t.Errorf("p80 = %v, want about 10", values[0])
+	}
+	if math.Abs(values[1]-200) > 200*LatencyRelativeAccuracy+0.005 {
+		t.Errorf("p81 = %v, want about 200", values[1])
+	}
+}
+
+func TestLatencyBucketAccuracy(t *testing.T) {
+	for _, ms := range []float64{0.02, 0.5, 1, 3.7, 42, 999.9, 12345, MaxDurationMs} {
+		value := LatencyBucketValue(LatencyBucket(ms))
+		if math.Abs(value-ms) > ms*LatencyRelativeAccuracy {
+			t.Errorf("bucket value of %vms = %v, outside the relative accuracy", ms, value)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// maxLocalEntries bounds the window counters and the pending charges kept by
+// the local limiter, so a long outage cannot grow them without bound
+const maxLocalEntries = 100000
+
+// localWindowState is the sliding window counter of one client and window
+type localWindowState struct {
+	window time.Duration
+	idx    int64
+	curr   int
+	prev   int
+}
+
+// localLimiter is an in-process sliding window limiter used while Redis is
+// unavailable. Each instance enforces its share of the global limits, and the
+// requests it grants are kept so they can be charged to Redis once it recovers.
+// Once it holds maxEntries counters or pending charges, hits that would need
+// a new one are refused.
+type localLimiter struct {
+	instances  int
+	maxEntries int
+
+	mu      sync.Mutex
+	windows map[string]*localWindowState
+	pending map[pendingHit]pendingCharge
+	swept   time.Time
+	full    bool
+}
+
+// newLocalLimiter creates a local limiter for one of instances app instances
+func newLocalLimiter(instances int) *localLimiter {
+	return &localLimiter{
+		instances:  max(instances, 1),
+		maxEntries: maxLocalEntries,
+		windows:    make(map[string]*localWindowState),
+		pending:    make(map[pendingHit]pendingCharge),
+	}
+}
+
+// budget returns this instance's share of a global limit
+func (l *localLimiter) budget(limit int) int {
+	return max((limit+l.instances-1)/l.instances, 1)
+}
+
+// take charges up to n requests of a hit against the local budgets of every window
+func (l *localLimiter) take(p pendingHit, hit RateLimitHit, n int, windows []limitWindow) RateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if !l.fits(p, now, windows) {
+		if !l.full {
+			l.full = true
+			log.Printf("Local rate limiter holds %d entries, refusing hits that need new ones until Redis recovers", l.maxEntries)
+		}
+		return RateLimitResult{
+			Policy:     windows[0].Name,
+			Limit:      l.budget(windows[0].Limit),
+			Window:     windows[0].Window,
+			RetryAfter: failClosedRetryAfter,
+			Reset:      failClosedRetryAfter,
+		}
+	}
+
+	states := make([]*localWindowState, len(windows))
+	weights := make([]float64, len(windows))
+	granted := n
+
+	for i, w := range windows {
+		key := localWindowKey(p, w)
+		idx := now.UnixNano() / int64(w.Window)
+
+		state, ok := l.windows[key]
+		if !ok {
+			state = &localWindowState{window: w.Window, idx: idx}
+			l.windows[key] = state
+		}
+		if state.idx == idx-1 {
+			state.prev, state.curr = state.curr, 0
+		} else if state.idx < idx-1 {
+			state.prev, state.curr = 0, 0
+		}
+		state.idx = idx
+
+		// Share of the previous window that still overlaps the sliding window
+		weights[i] = 1 - float64(now.UnixNano()-idx*int64(w.Window))/float64(w.Window)
+		available := max(int(float64(l.budget(w.Limit))-(float64(state.prev)*weights[i]+float64(state.curr))), 0)
+		states[i] = state
+		granted = min(granted, available)
+	}
+
+	result := RateLimitResult{Granted: granted, Remaining: -1}
+	for i, w := range windows {
+		states[i].curr += granted
+
+		budget := l.budget(w.Limit)
+		remaining := max(int(float64(budget)-(float64(states[i].prev)*weights[i]+float64(states[i].curr))), 0)
+		windowEnd := time.Duration((states[i].idx+1)*int64(w.Window) - now.UnixNano())
+
+		if result.Remaining < 0 || remaining < result.Remaining {
+			result.Policy = w.Name
+			result.Limit = budget
+			result.Window = w.Window
+			result.Remaining = remaining
+			result.Reset = windowEnd + w.Window
+			result.RetryAfter = 0
+			if remaining == 0 {
+				result.RetryAfter = windowEnd
+			}
+		}
+		result.Policies = append(result.Policies, RateLimitPolicy{Name: w.Name, Limit: budget, Window: w.Window})
+	}
+
+	if granted > 0 {
+		charge := l.pending[p]
+		charge.hit = hit
+		charge.n += granted
+		l.pending[p] = charge
+	}
+
+	return result
+}
+
+// fits reports whether the counters and the pending charge of a hit fit the
+// limit on entries. Counters of windows that have passed are dropped first,
+// at most once per second.
+func (l *localLimiter) fits(p pendingHit, now time.Time, windows []limitWindow) bool {
+	if _, ok := l.pending[p]; !ok && len(l.pending) >= l.maxEntries {
+		return false
+	}
+
+	if len(l.windows)+len(windows) > l.maxEntries && now.Sub(l.swept) >= time.Second {
+		l.swept = now
+		for key, state := range l.windows {
+			if state.idx < now.UnixNano()/int64(state.window)-1 {
+				delete(l.windows, key)
+			}
+		}
+	}
+
+	missing := 0
+	for _, w := range windows {
+		if _, ok := l.windows[localWindowKey(p, w)]; !ok {
+			missing++
+		}
+	}
+	return len(l.windows)+missing <= l.maxEntries
+}
+
+// localWindowKey returns the key of the counter of a window for a hit
+func localWindowKey(p pendingHit, w limitWindow) string {
+	return p.clientID.String() + ":" + w.key
+}
+
+// drain returns the requests granted locally since the last drain and resets
+// the local counters, so a later outage starts from a clean state
+func (l *localLimiter) drain() map[pendingHit]pendingCharge {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.pending) == 0 {
+		return nil
+	}
+
+	pending := l.pending
+	l.pending = make(map[pendingHit]pendingCharge)
+	l.windows = make(map[string]*localWindowState)
+	l.full = false
+	return pending
+}
+
+// restore puts back requests that could not be reconciled
+func (l *localLimiter) restore(pending map[pendingHit]pendingCharge) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for p, restored := range pending {
+		charge := l.pending[p]
+		charge.hit = restored.hit
+		charge.n += restored.n
+		l.pending[p] = charge
+	}
+}
+
+// hasPending reports whether there are locally granted requests to reconcile
+func (l *localLimiter) hasPending() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.pending) > 0
+}
@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nexmedis-golang/db"
+
+	"github.com/google/uuid"
+)
+
+func TestLocalLimiterConcurrentTake(t *testing.T) {
+	l := newLocalLimiter(1)
+	windows := []limitWindow{{RateLimitPolicy{"hour", 50, HourWindow}, "hour", 50}}
+	p := pendingHit{clientID: uuid.New()}
+
+	var granted atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			granted.Add(int64(l.take(p, RateLimitHit{}, 1, windows).Granted))
+		}()
+	}
+	wg.Wait()
+
+	if got := granted.Load(); got != 50 {
+		t.Errorf("granted %d requests, want exactly the limit of 50", got)
+	}
+	if got := l.drain()[p].n; got != 50 {
+		t.Errorf("pending = %d, want 50", got)
+	}
+}
+
+func TestLocalLimiterSharesBudget(t *testing.T) {
+	l := newLocalLimiter(3)
+	windows := []limitWindow{{RateLimitPolicy{"hour", 100, HourWindow}, "hour", 100}}
+
+	result := l.take(pendingHit{clientID: uuid.New()}, RateLimitHit{}, 1000, windows)
+	if result.Granted != 34 || result.Limit != 34 {
+		t.Errorf("granted %d of limit %d, want 34 of 34 (a third of 100, rounded up)", result.Granted, result.Limit)
+	}
+	if result.Remaining != 0 || result.RetryAfter <= 0 {
+		t.Errorf("remaining %d, retry after %s, want 0 and a positive retry after", result.Remaining, result.RetryAfter)
+	}
+}
+
+func TestLocalLimiterMostConstrainingWindow(t *testing.T) {
+	l := newLocalLimiter(1)
+	windows := []limitWindow{
+		{RateLimitPolicy{"hour", 100, HourWindow}, "hour", 100},
+		{RateLimitPolicy{"day", 10, DayWindow}, "day", 10},
+	}
+	p := pendingHit{clientID: uuid.New()}
+
+	result := l.take(p, RateLimitHit{}, 20, windows)
+	if result.Granted != 10 || result.Policy != "day" {
+		t.Errorf("granted %d by %q, want 10 by day", result.Granted, result.Policy)
+	}
+
+	// Requests refused by one window are not charged to the others
+	result = l.take(p, RateLimitHit{}, 0, windows[:1])
+	if result.Remaining != 90 {
+		t.Errorf("hourly remaining = %d, want 90", result.Remaining)
+	}
+}
+
+func TestLocalLimiterWindowBoundary(t *testing.T) {
+	const window = time.Second
+	l := newLocalLimiter(1)
+	windows := []limitWindow{{RateLimitPolicy{"burst", 10, window}, "burst", 10}}
+	p := pendingHit{clientID: uuid.New()}
+
+	// Use up the limit at the end of a window, then try again right after the boundary
+	sleepUntilWindowOffset(time.Now(), window, 0.95)
+	if got := l.take(p, RateLimitHit{}, 10, windows).Granted; got != 10 {
+		t.Fatalf("granted %d at the end of the window, want 10", got)
+	}
+	sleepUntilWindowOffset(time.Now(), window, 0.02)
+	if got := l.take(p, RateLimitHit{}, 10, windows).Granted; got > 1 {
+		t.Errorf("granted %d right after the window boundary, want at most 1", got)
+	}
+}
+
+func TestLocalLimiterRefusesWhenFull(t *testing.T) {
+	l := newLocalLimiter(1)
+	l.maxEntries = 2
+	windows := []limitWindow{{RateLimitPolicy{"hour", 100, HourWindow}, "hour", 100}}
+	first := pendingHit{clientID: uuid.New()}
+
+	for _, p := range []pendingHit{first, {clientID: uuid.New()}} {
+		if got := l.take(p, RateLimitHit{}, 1, windows).Granted; got != 1 {
+			t.Fatalf("granted %d below the cap, want 1", got)
+		}
+	}
+
+	// A third client would need new entries, while known clients still fit
+	result := l.take(pendingHit{clientID: uuid.New()}, RateLimitHit{}, 1, windows)
+	if result.Granted != 0 || result.RetryAfter <= 0 {
+		t.Errorf("new client at the cap = %+v, want refused with a retry after", result)
+	}
+	if got := l.take(first, RateLimitHit{}, 1, windows).Granted; got != 1 {
+		t.Errorf("granted %d to a known client at the cap, want 1", got)
+	}
+
+	// Draining after Redis recovers makes room again
+	l.drain()
+	if got := l.take(pendingHit{clientID: uuid.New()}, RateLimitHit{}, 1, windows).Granted; got != 1 {
+		t.Errorf("granted %d after the drain, want 1", got)
+	}
+}
+
+func TestLocalLimiterPendingPerRule(t *testing.T) {
+	l := newLocalLimiter(1)
+	windows := []limitWindow{{RateLimitPolicy{"hour", 100, HourWindow}, "hour", 100}}
+	clientID := uuid.New()
+	export := pendingHit{clientID: clientID, rules: "|export"}
+
+	l.take(pendingHit{clientID: clientID}, RateLimitHit{}, 3, windows)
+	l.take(export, RateLimitHit{Endpoint: "/api/export"}, 2, windows)
+
+	pending := l.drain()
+	if len(pending) != 2 || pending[export].n != 2 || pending[export].hit.Endpoint != "/api/export" {
+		t.Errorf("pending = %+v, want the export hits kept apart with their hit", pending)
+	}
+}
+
+func TestRateLimiterReconcilesAfterOutage(t *testing.T) {
+	mr := startRedis(t)
+
+	rl := NewRateLimiter(RateLimiterConfig{Limit: 10, Algorithm: SlidingWindow, FailureMode: FailLocal})
+	clientID := uuid.New()
+	ctx := context.Background()
+
+	mr.Close()
+	waitFor(t, "Redis to be seen as down", func() bool { return !db.IsRedisAvailable(ctx) })
+	if result, err := rl.Take(ctx, clientID, 4); err != nil || result.Granted != 4 {
+		t.Fatalf("Take() during the outage = %+v, %v, want 4 granted locally", result, err)
+	}
+
+	// The prober reconciles in the background once Redis is back
+	if err := mr.Restart(); err != nil {
+		t.Fatalf("failed to restart miniredis: %v", err)
+	}
+	waitFor(t, "local hits to be reconciled", func() bool { return !rl.local.hasPending() })
+
+	results, err := rl.Inspect(ctx, clientID, RateLimitHit{})
+	if err != nil {
+		t.Fatalf("Inspect() error = %v", err)
+	}
+	if results[0].Remaining != 6 {
+		t.Errorf("remaining after the outage = %d, want 6", results[0].Remaining)
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// sleepUntilWindowOffset sleeps until the given fraction of the current
+// window has passed on a clock, or of the next one if that point is behind.
+// Windows are counted from the Unix epoch, as the limiters do.
+func sleepUntilWindowOffset(now time.Time, window time.Duration, fraction float64) {
+	elapsed := time.Duration(now.UnixNano() % int64(window))
+	wait := time.Duration(float64(window)*fraction) - elapsed
+	if wait <= 0 {
+		wait += window
+	}
+	time.Sleep(wait)
+}
@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"nexmedis-golang/db"
+)
+
+// SecurityEventsChannel is the Redis channel security events are published on
+const SecurityEventsChannel = "security_events"
+
+// lockoutLevelTTL is how long past lockouts count towards a longer next lockout
+const lockoutLevelTTL = 24 * time.Hour
+
+// GuardSubject is what attempts are counted against, such as a source IP or an account
+type GuardSubject struct {
+	Kind  string // Subject kind, for example "ip", "key" or "email"
+	Value string // Subject value
+	// BackoffOnly subjects are never refused by Check, only their failed
+	// attempts are answered with the lockout. Use it for subjects anyone can
+	// name, such as the public prefix of an API key, so attempts by others
+	// cannot lock the owner out.
+	BackoffOnly bool
+}
+
+// SecurityEvent reports that a subject crossed the failure threshold of a guard
+type SecurityEvent struct {
+	Type      string    `json:"type"`      // Event type (lockout)
+	Scope     string    `json:"scope"`     // Guarded action, for example "login"
+	Subject   string    `json:"subject"`   // Subject kind
+	Value     string    `json:"value"`     // Subject value
+	IP        string    `json:"ip"`        // Source IP of the request that crossed the threshold
+	Failures  int64     `json:"failures"`  // Attempts counted in the window
+	Lockout   int       `json:"lockout"`   // Lockout duration in seconds
+	Level     int64     `json:"level"`     // Number of lockouts within the last 24 hours
+	Timestamp time.Time `json:"timestamp"` // When the threshold was crossed
+}
+
+// LoginGuardConfig holds the thresholds of a login guard
+type LoginGuardConfig struct {
+	MaxFailures int           // Attempts within Window that lock a subject out
+	Window      time.Duration // How long attempts are remembered after the last one
+	Lockout     time.Duration // Duration of the first lockout, doubled for every further lockout
+	MaxLockout  time.Duration // Upper bound of a lockout
+}
+
+// LoginGuard throttles repeated attempts at a public action, such as failed
+// logins, per source IP and per account. Once a subject reaches MaxFailures it
+// is locked out, for longer with every lockout within a day, and a security
+// event is emitted. Counters live in Redis; without Redis nothing is throttled.
+type LoginGuard struct {
+	scope  string
+	config LoginGuardConfig
+}
+
+// NewLoginGuard creates a guard for an action
+func NewLoginGuard(scope string, config LoginGuardConfig) *LoginGuard {
+	if config.MaxFailures <= 0 {
+		config.MaxFailures = 5
+	}
+	if config.Window <= 0 {
+		config.Window = 15 * time.Minute
+	}
+	if config.Lockout <= 0 {
+		config.Lockout = time.Minute
+	}
+	if config.MaxLockout < config.Lockout {
+		config.MaxLockout = max(config.Lockout, time.Hour)
+	}
+
+	return &LoginGuard{
+		scope:  scope,
+		config: config,
+	}
+}
+
+// Check returns how long the longest lockout of the subjects still lasts, or
+// 0 when none of them is locked out. BackoffOnly subjects are skipped.
+func (g *LoginGuard) Check(ctx context.Context, subjects ...GuardSubject) time.Duration {
+	if !db.IsRedisAvailable(ctx) {
+		return 0
+	}
+
+	var locked time.Duration
+	for _, s := range subjects {
+		if s.Value == "" || s.BackoffOnly {
+			continue
+		}
+		locked = max(locked, g.remaining(ctx, s))
+	}
+
+	return locked
+}
+
+// Record counts an attempt against every subject, such as a failed login,
+// and locks out the subjects that reach the threshold. It returns the longest
+// lockout it started, or that a BackoffOnly subject is still serving.
+func (g *LoginGuard) Record(ctx context.Context, ip string, subjects ...GuardSubject) time.Duration {
+	if !db.IsRedisAvailable(ctx) {
+		return 0
+	}
+
+	var locked time.Duration
+	for _, s := range subjects {
+		if s.Value == "" {
+			continue
+		}
+
+		failures, err := db.IncrementCounterWithTTL(ctx, g.key("fail", s), g.config.Window)
+		if err != nil {
+			log.Printf("Failed to count %s failure: %v", g.scope, err)
+			continue
+		}
+
+		if failures >= int64(g.config.MaxFailures) {
+			locked = max(locked, g.lock(ctx, ip, s, failures))
+		} else if s.BackoffOnly {
+			locked = max(locked, g.remaining(ctx, s))
+		}
+	}
+
+	return locked
+}
+
+// Reset forgets the attempts counted against the subjects, for example after a successful login
+func (g *LoginGuard) Reset(ctx context.Context, subjects ...GuardSubject) {
+	if !db.IsRedisAvailable(ctx) {
+		return
+	}
+
+	keys := make([]string, 0, len(subjects))
+	for _, s := range subjects {
+		if s.Value != "" {
+			keys = append(keys, g.key("fail", s))
+		}
+	}
+
+	if len(keys) > 0 {
+		_ = db.CacheDelete(ctx, keys...)
+	}
+}
+
+// remaining returns how long the lockout of a subject still lasts
+func (g *LoginGuard) remaining(ctx context.Context, s GuardSubject) time.Duration {
+	ttl, err := db.GetTTL(ctx, g.key("lock", s))
+	if err != nil {
+		log.Printf("Failed to check %s lockout: %v", g.scope, err)
+		return 0
+	}
+	return ttl
+}
+
+// lock locks a subject out for a duration that doubles with every lockout
+// within a day, and emits a security event
+func (g *LoginGuard) lock(ctx context.Context, ip string, s GuardSubject, failures int64) time.Duration {
+	level, err := db.IncrementCounterWithTTL(ctx, g.key("level", s), lockoutLevelTTL)
+	if err != nil {
+		level = 1
+	}
+
+	lockout := g.config.MaxLockout
+	if level <= 30 {
+		lockout = min(g.config.Lockout<<(level-1), g.config.MaxLockout)
+	}
+
+	if err := db.CacheSet(ctx, g.key("lock", s), level, lockout); err != nil {
+		log.Printf("Failed to lock out %s %s: %v", s.Kind, s.Value, err)
+		return 0
+	}
+	_ = db.CacheDelete(ctx, g.key("fail", s))
+
+	event := SecurityEvent{
+		Type:      "lockout",
+		Scope:     g.scope,
+		Subject:   s.Kind,
+		Value:     s.Value,
+		IP:        ip,
+		Failures:  failures,
+		Lockout:   int(lockout / time.Second),
+		Level:     level,
+		Timestamp: time.Now().UTC(),
+	}
+	log.Printf("Security event: %s lockout of %s %s for %s after %d attempts (ip %s, level %d)",
+		g.scope, s.Kind, s.Value, lockout, failures, ip, level)
+	_ = db.PublishMessage(ctx, SecurityEventsChannel, event)
+
+	return lockout
+}
+
+// key generates the Redis key of a guard counter
+func (g *LoginGuard) key(kind string, s GuardSubject) string {
+	return fmt.Sprintf("guard:%s:%s:%s:%s", g.scope, kind, s.Kind, s.Value)
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestLoginGuardLocksOut(t *testing.T) {
+	startRedis(t)
+
+	g := NewLoginGuard("test", LoginGuardConfig{MaxFailures: 3, Window: time.Minute, Lockout: 10 * time.Second, MaxLockout: 15 * time.Second})
+	ip := GuardSubject{Kind: "ip", Value: uuid.NewString()}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if locked := g.Record(ctx, ip.Value, ip); locked != 0 {
+			t.Fatalf("attempt %d locked out for %s, want no lockout below the threshold", i+1, locked)
+		}
+	}
+	if locked := g.Check(ctx, ip); locked != 0 {
+		t.Fatalf("Check() = %s before the threshold, want 0", locked)
+	}
+
+	if locked := g.Record(ctx, ip.Value, ip); locked != 10*time.Second {
+		t.Errorf("third attempt locked out for %s, want 10s", locked)
+	}
+	if locked := g.Check(ctx, ip); locked <= 0 || locked > 10*time.Second {
+		t.Errorf("Check() = %s, want the remaining lockout", locked)
+	}
+
+	// The next lockout within a day doubles, up to MaxLockout
+	for i := 0; i < 3; i++ {
+		g.Record(ctx, ip.Value, ip)
+	}
+	if locked := g.Check(ctx, ip); locked <= 10*time.Second || locked > 15*time.Second {
+		t.Errorf("second lockout lasts %s, want it capped at 15s", locked)
+	}
+}
+
+func TestLoginGuardReset(t *testing.T) {
+	startRedis(t)
+
+	g := NewLoginGuard("test", LoginGuardConfig{MaxFailures: 2, Window: time.Minute, Lockout: 10 * time.Second})
+	email := GuardSubject{Kind: "email", Value: uuid.NewString()}
+	ctx := context.Background()
+
+	g.Record(ctx, "", email)
+	g.Reset(ctx, email)
+	if locked := g.Record(ctx, "", email); locked != 0 {
+		t.Errorf("locked out for %s after a reset, want the count to start over", locked)
+	}
+}
+
+func TestLoginGuardBackoffOnly(t *testing.T) {
+	startRedis(t)
+
+	g := NewLoginGuard("test", LoginGuardConfig{MaxFailures: 2, Window: time.Minute, Lockout: 10 * time.Second})
+	key := GuardSubject{Kind: "key", Value: uuid.NewString(), BackoffOnly: true}
+	ctx := context.Background()
+
+	g.Record(ctx, "", key)
+	if locked := g.Record(ctx, "", key); locked != 10*time.Second {
+		t.Fatalf("attempt at the threshold locked out for %s, want 10s", locked)
+	}
+
+	// Anyone can name the subject, so it never refuses the owner
+	if locked := g.Check(ctx, key); locked != 0 {
+		t.Errorf("Check() = %s for a backoff-only subject, want 0", locked)
+	}
+
+	// Further failed attempts are still answered with the running lockout
+	if locked := g.Record(ctx, "", key); locked <= 0 {
+		t.Errorf("failed attempt during the lockout got %s, want the remaining lockout", locked)
+	}
+}
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MailMessage is a plain text email
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends outbound email
+type Mailer interface {
+	Send(ctx context.Context, msg MailMessage) error
+}
+
+// SMTPConfig holds the settings of an SMTP relay
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string // No authentication when empty
+	Password string
+	From     string
+	Timeout  time.Duration // Limit for connecting and sending a message (default 10s)
+}
+
+// SMTPMailer sends email through an SMTP relay. The connection is upgraded
+// with STARTTLS whenever the server offers it, and credentials are only sent
+// over TLS.
+type SMTPMailer struct {
+	config SMTPConfig
+}
+
+// NewSMTPMailer creates a new SMTPMailer
+func NewSMTPMailer(config SMTPConfig) *SMTPMailer {
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	return &SMTPMailer{config: config}
+}
+
+// Send delivers a message to the relay
+func (m *SMTPMailer) Send(ctx context.Context, msg MailMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, m.config.Timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.config.Host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+
+	// smtp.PlainAuth refuses to send credentials over unencrypted connections
+	// to anything but localhost
+	if m.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(m.config.From); err != nil {
+		return fmt.Errorf("SMTP server refused sender: %w", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("SMTP server refused recipient: %w", err)
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if _, err := writer.Write(formatMessage(m.config.From, msg)); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// OutboxMailer writes every message to a .eml file in a directory instead of
+// sending it. It is meant for local development and testing.
+type OutboxMailer struct {
+	dir  string
+	from string
+}
+
+// NewOutboxMailer creates a new OutboxMailer writing to dir
+func NewOutboxMailer(dir, from string) *OutboxMailer {
+	return &OutboxMailer{dir: dir, from: from}
+}
+
+// Send writes a message to the outbox directory
+func (m *OutboxMailer) Send(ctx context.Context, msg MailMessage) error {
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create outbox: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405Z"), uuid.New().String()[:8])
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, formatMessage(m.from, msg), 0o600); err != nil {
+		return fmt.Errorf("failed to write message to outbox: %w", err)
+	}
+
+	log.Printf("Wrote email for %s to %s", msg.To, path)
+	return nil
+}
+
+// formatMessage renders a message with its headers. Line breaks are removed
+// from header values so they cannot inject headers.
+func formatMessage(from string, msg MailMessage) []byte {
+	header := strings.NewReplacer("\r", "", "\n", "")
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", header.Replace(from))
+	fmt.Fprintf(&buf, "To: %s\r\n", header.Replace(msg.To))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", header.Replace(msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return buf.Bytes()
+}
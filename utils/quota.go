@@ -0,0 +1,27 @@
+package utils
+
+import "time"
+
+// BillingPeriod returns the monthly billing period that contains now, for a
+// billing cycle anchored at anchor. Periods start on the anchor's day of the
+// month (the last day in shorter months) at the anchor's time of day, in UTC.
+func BillingPeriod(anchor, now time.Time) (time.Time, time.Time) {
+	anchor, now = anchor.UTC(), now.UTC()
+
+	start := billingDate(anchor, now.Year(), now.Month())
+	if start.After(now) {
+		start = billingDate(anchor, now.Year(), now.Month()-1)
+	}
+
+	return start, billingDate(anchor, start.Year(), start.Month()+1)
+}
+
+// billingDate returns the start of the billing period in a month. Months out
+// of range are normalized, so month 0 is December of the previous year.
+func billingDate(anchor time.Time, year int, month time.Month) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	lastDay := first.AddDate(0, 1, -1).Day()
+
+	return time.Date(first.Year(), first.Month(), min(anchor.Day(), lastDay),
+		anchor.Hour(), anchor.Minute(), anchor.Second(), 0, time.UTC)
+}
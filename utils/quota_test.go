@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBillingPeriod(t *testing.T) {
+	date := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		anchor time.Time
+		now    time.Time
+		start  time.Time
+		end    time.Time
+	}{
+		{
+			name:   "middle of period",
+			anchor: date(2025, time.March, 10, 8),
+			now:    date(2025, time.June, 20, 0),
+			start:  date(2025, time.June, 10, 8),
+			end:    date(2025, time.July, 10, 8),
+		},
+		{
+			name:   "before anchor day",
+			anchor: date(2025, time.March, 10, 8),
+			now:    date(2025, time.June, 5, 0),
+			start:  date(2025, time.May, 10, 8),
+			end:    date(2025, time.June, 10, 8),
+		},
+		{
+			name:   "exactly at period start",
+			anchor: date(2025, time.March, 10, 8),
+			now:    date(2025, time.June, 10, 8),
+			start:  date(2025, time.June, 10, 8),
+			end:    date(2025, time.July, 10, 8),
+		},
+		{
+			name:   "before anchor time of day",
+			anchor: date(2025, time.March, 10, 8),
+			now:    date(2025, time.June, 10, 7),
+			start:  date(2025, time.May, 10, 8),
+			end:    date(2025, time.June, 10, 8),
+		},
+		{
+			name:   "anchor day missing in short month",
+			anchor: date(2025, time.January, 31, 12),
+			now:    date(2025, time.February, 15, 0),
+			start:  date(2025, time.January, 31, 12),
+			end:    date(2025, time.February, 28, 12),
+		},
+		{
+			name:   "period after short month",
+			anchor: date(2025, time.January, 31, 12),
+			now:    date(2025, time.March, 1, 0),
+			start:  date(2025, time.February, 28, 12),
+			end:    date(2025, time.March, 31, 12),
+		},
+		{
+			name:   "leap year",
+			anchor: date(2023, time.August, 30, 0),
+			now:    date(2024, time.February, 29, 1),
+			start:  date(2024, time.February, 29, 0),
+			end:    date(2024, time.March, 30, 0),
+		},
+		{
+			name:   "year boundary",
+			anchor: date(2024, time.December, 20, 0),
+			now:    date(2026, time.January, 5, 0),
+			start:  date(2025, time.December, 20, 0),
+			end:    date(2026, time.January, 20, 0),
+		},
+		{
+			name:   "local times are converted to UTC",
+			anchor: date(2025, time.March, 10, 8).In(time.FixedZone("UTC+9", 9*3600)),
+			now:    date(2025, time.June, 10, 7).In(time.FixedZone("UTC-5", -5*3600)),
+			start:  date(2025, time.May, 10, 8),
+			end:    date(2025, time.June, 10, 8),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := BillingPeriod(tt.anchor, tt.now)
+			if !start.Equal(tt.start) || !end.Equal(tt.end) {
+				t.Errorf("BillingPeriod() = %s - %s, want %s - %s", start, end, tt.start, tt.end)
+			}
+			if start.After(tt.now) || !end.After(tt.now) {
+				t.Errorf("period %s - %s does not contain %s", start, end, tt.now)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// ruleNamePattern restricts rule names to characters that are safe in Redis
+// keys and structured header values
+var ruleNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// RateLimitHit describes the API hit being charged. Rules scoped to an
+// endpoint or source IP only apply when the hit carries that attribute.
+type RateLimitHit struct {
+	IP       string // Source IP of the hit
+	Endpoint string // Endpoint of the hit
+}
+
+// RateLimitRule is an additional limit evaluated for every client next to the
+// limits of its plan
+type RateLimitRule struct {
+	Name     string        // Unique rule name, reported when the rule triggers
+	Limit    int           // Maximum requests per window
+	Window   time.Duration // Length of the window
+	Burst    int           // Maximum burst (GCRA only, defaults to Limit)
+	Endpoint string        // Only count hits whose endpoint matches this route pattern
+	PerIP    bool          // Count each source IP of the client separately
+}
+
+// rateLimitRuleJSON is the configuration format of a rate limit rule
+type rateLimitRuleJSON struct {
+	Name     string `json:"name"`
+	Limit    int    `json:"limit"`
+	Window   string `json:"window"`
+	Burst    int    `json:"burst"`
+	Endpoint string `json:"endpoint"`
+	PerIP    bool   `json:"per_ip"`
+}
+
+// ParseRateLimitRules parses rate limit rules from JSON, for example
+// [{"name":"burst","limit":20,"window":"1s"},{"name":"export","endpoint":"/api/export/*","limit":10,"window":"1m"}]
+func ParseRateLimitRules(data string) ([]RateLimitRule, error) {
+	if data == "" {
+		return nil, nil
+	}
+
+	var raw []rateLimitRuleJSON
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		return nil, fmt.Errorf("invalid rate limit rules: %w", err)
+	}
+
+	seen := map[string]bool{"hour": true, "day": true, "month": true}
+	rules := make([]RateLimitRule, 0, len(raw))
+	for _, r := range raw {
+		if !ruleNamePattern.MatchString(r.Name) {
+			return nil, fmt.Errorf("rate limit rule name %q must be 1-32 characters of a-z, 0-9, _ or -", r.Name)
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("rate limit rule name %q is already used", r.Name)
+		}
+		seen[r.Name] = true
+
+		if r.Limit <= 0 {
+			return nil, fmt.Errorf("rate limit rule %q: limit must be positive", r.Name)
+		}
+
+		window, err := time.ParseDuration(r.Window)
+		if err != nil || window < time.Second {
+			return nil, fmt.Errorf("rate limit rule %q: window must be a duration of at least 1s", r.Name)
+		}
+
+		if r.Endpoint != "" {
+			if err := ValidateRoutePattern(r.Endpoint); err != nil {
+				return nil, fmt.Errorf("rate limit rule %q: %w", r.Name, err)
+			}
+		}
+
+		burst := r.Burst
+		if burst <= 0 || burst > r.Limit {
+			burst = r.Limit
+		}
+
+		rules = append(rules, RateLimitRule{
+			Name:     r.Name,
+			Limit:    r.Limit,
+			Window:   window,
+			Burst:    burst,
+			Endpoint: r.Endpoint,
+			PerIP:    r.PerIP,
+		})
+	}
+
+	return rules, nil
+}
+
+// applies reports whether the rule counts a hit
+func (r RateLimitRule) applies(hit RateLimitHit) bool {
+	if r.PerIP && hit.IP == "" {
+		return false
+	}
+	if r.Endpoint != "" {
+		return hit.Endpoint != "" && MatchRoutePattern(r.Endpoint, StripQuery(hit.Endpoint))
+	}
+	return true
+}
+
+// key returns the counter key of the rule for a hit
+func (r RateLimitRule) key(hit RateLimitHit) string {
+	if r.PerIP {
+		return r.Name + ":" + hit.IP
+	}
+	return r.Name
+}
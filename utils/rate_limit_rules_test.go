@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimitRules(t *testing.T) {
+	rules, err := ParseRateLimitRules(`[
+		{"name":"burst","limit":20,"window":"1s"},
+		{"name":"export","endpoint":"/api/export/*","limit":10,"window":"1m","burst":3},
+		{"name":"per-ip","limit":100,"window":"1h","per_ip":true,"burst":500}
+	]`)
+	if err != nil {
+		t.Fatalf("ParseRateLimitRules() error = %v", err)
+	}
+
+	want := []RateLimitRule{
+		{Name: "burst", Limit: 20, Window: time.Second, Burst: 20},
+		{Name: "export", Limit: 10, Window: time.Minute, Burst: 3, Endpoint: "/api/export/*"},
+		{Name: "per-ip", Limit: 100, Window: time.Hour, Burst: 100, PerIP: true},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("got %d rules, want %d", len(rules), len(want))
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, rules[i], want[i])
+		}
+	}
+}
+
+func TestParseRateLimitRulesEmpty(t *testing.T) {
+	rules, err := ParseRateLimitRules("")
+	if err != nil || rules != nil {
+		t.Errorf("ParseRateLimitRules(\"\") = %v, %v, want no rules", rules, err)
+	}
+}
+
+func TestParseRateLimitRulesInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"malformed JSON", `[{"name":`, "invalid rate limit rules"},
+		{"missing name", `[{"limit":1,"window":"1s"}]`, "must be 1-32 characters"},
+		{"uppercase name", `[{"name":"Burst","limit":1,"window":"1s"}]`, "must be 1-32 characters"},
+		{"plan window name", `[{"name":"hour","limit":1,"window":"1s"}]`, "already used"},
+		{"duplicate name", `[{"name":"a","limit":1,"window":"1s"},{"name":"a","limit":2,"window":"1s"}]`, "already used"},
+		{"zero limit", `[{"name":"a","limit":0,"window":"1s"}]`, "limit must be positive"},
+		{"invalid window", `[{"name":"a","limit":1,"window":"soon"}]`, "window must be a duration"},
+		{"short window", `[{"name":"a","limit":1,"window":"500ms"}]`, "window must be a duration"},
+		{"relative endpoint", `[{"name":"a","limit":1,"window":"1s","endpoint":"api/export"}]`, "must start with '/'"},
+		{"endpoint with query", `[{"name":"a","limit":1,"window":"1s","endpoint":"/api?x=1"}]`, "query string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRateLimitRules(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseRateLimitRules() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitRuleApplies(t *testing.T) {
+	export := RateLimitRule{Name: "export", Endpoint: "/api/export/*"}
+	perIP := RateLimitRule{Name: "per-ip", PerIP: true}
+
+	tests := []struct {
+		rule RateLimitRule
+		hit  RateLimitHit
+		want bool
+	}{
+		{export, RateLimitHit{Endpoint: "/api/export/csv?from=1"}, true},
+		{export, RateLimitHit{Endpoint: "/api/users"}, false},
+		{export, RateLimitHit{}, false},
+		{perIP, RateLimitHit{IP: "203.0.113.7"}, true},
+		{perIP, RateLimitHit{}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.rule.applies(tt.hit); got != tt.want {
+			t.Errorf("%s.applies(%+v) = %v, want %v", tt.rule.Name, tt.hit, got, tt.want)
+		}
+	}
+
+	if a, b := perIP.key(RateLimitHit{IP: "203.0.113.7"}), perIP.key(RateLimitHit{IP: "203.0.113.8"}); a == b {
+		t.Errorf("per-IP rule uses the same key %q for different IPs", a)
+	}
+}
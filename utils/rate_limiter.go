@@ -2,99 +2,623 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"nexmedis-golang/db"
+	"nexmedis-golang/model"
 
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 )
 
+// RateLimitAlgorithm selects how requests are counted against a client's limit
+type RateLimitAlgorithm string
+
+const (
+	// FixedWindow counts requests per clock hour. Cheap, but allows up to twice
+	// the limit across an hour boundary.
+	FixedWindow RateLimitAlgorithm = "fixed"
+	// SlidingWindow weights the previous window's count by how much of it still
+	// overlaps the last hour, which removes the boundary burst.
+	SlidingWindow RateLimitAlgorithm = "sliding"
+	// GCRA spaces requests evenly over the window and allows short bursts of up
+	// to Burst requests (generic cell rate algorithm, a token bucket).
+	GCRA RateLimitAlgorithm = "gcra"
+)
+
+// RateLimitFailureMode selects what happens when Redis is unavailable
+type RateLimitFailureMode string
+
+const (
+	// FailOpen allows every request while Redis is unavailable
+	FailOpen RateLimitFailureMode = "open"
+	// FailClosed refuses every request while Redis is unavailable
+	FailClosed RateLimitFailureMode = "closed"
+	// FailLocal enforces per-instance budgets in memory while Redis is
+	// unavailable and charges the granted requests to Redis once it recovers
+	FailLocal RateLimitFailureMode = "local"
+)
+
+// failClosedRetryAfter is the Retry-After sent while requests are refused in FailClosed mode
+const failClosedRetryAfter = 5 * time.Second
+
+// Rate limit windows. Months are counted as rolling 30-day windows.
+const (
+	HourWindow  = time.Hour
+	DayWindow   = 24 * time.Hour
+	MonthWindow = 30 * 24 * time.Hour
+)
+
+// limitCacheTTL is how long a client's effective limits are cached in Redis
+const limitCacheTTL = 5 * time.Minute
+
+// ErrRateLimitUnavailable is returned when rate limit counters cannot be read from Redis
+var ErrRateLimitUnavailable = errors.New("rate limit counters not available")
+
+// ClientLoader loads a client together with its plan
+type ClientLoader func(id uuid.UUID) (*model.Client, error)
+
+// RateLimiterConfig holds configuration for the rate limiter
+type RateLimiterConfig struct {
+	Limit       int                  // Default requests per hour for clients without a plan
+	Algorithm   RateLimitAlgorithm   // Counting algorithm
+	Burst       int                  // Maximum burst of the hourly limit (GCRA only)
+	FailureMode RateLimitFailureMode // Behaviour while Redis is unavailable
+	Instances   int                  // Number of app instances sharing the limits (sizes local budgets)
+	Rules       []RateLimitRule      // Additional limits evaluated for every client
+}
+
+// RateLimitPolicy is a limit enforced on a client
+type RateLimitPolicy struct {
+	Name   string        // Plan window (hour, day or month) or rule name
+	Limit  int           // Maximum requests per window
+	Window time.Duration // Length of the window
+}
+
+// RateLimitResult is the outcome of charging requests against a client's limits.
+// Policy, Limit, Remaining, RetryAfter and Reset describe the most constraining
+// window, which is the rule that triggered when requests were refused.
+type RateLimitResult struct {
+	Granted    int               // Number of requested units that fit all limits
+	Policy     string            // Name of the most constraining window or rule
+	Limit      int               // Maximum requests per window
+	Window     time.Duration     // Length of the window
+	Remaining  int               // Requests still available after this call
+	RetryAfter time.Duration     // Time until at least one more request fits (0 when Remaining > 0)
+	Reset      time.Duration     // Time until the full limit is available again
+	Policies   []RateLimitPolicy // All limits enforced on the client (empty when not enforced)
+}
+
+// Each algorithm defines check(key, limit, window, burst, now), which reads a
+// window's state and how many requests it still allows, and commit(key, state,
+// granted, now), which charges the granted requests and returns remaining,
+// retry after and reset (µs). limitScriptDriver grants the smallest allowance
+// across all windows and charges it to every window, so a request refused by
+// the monthly limit is not counted against the hourly one. It reads the clock
+// from Redis so that all instances agree on time.
+//
+// KEYS holds one key per window and ARGV is n and force followed by limit,
+// window (µs) and burst per window; n = 0 only reports the current state and
+// force = 1 charges all n requests even beyond the limit. The script returns
+// granted, remaining, retry after (ms), reset (ms) and the index of the most
+// constraining window.
+const limitScriptDriver = `
+local n = tonumber(ARGV[1])
+local force = tonumber(ARGV[2]) == 1
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local states = {}
+local granted = n
+for i = 1, #KEYS do
+	states[i] = check(KEYS[i], tonumber(ARGV[i * 3]), tonumber(ARGV[i * 3 + 1]), tonumber(ARGV[i * 3 + 2]), now)
+	if not force then
+		granted = math.min(granted, states[i].available)
+	end
+end
+
+local result = nil
+for i = 1, #KEYS do
+	local remaining, retry, reset = commit(KEYS[i], states[i], granted, now)
+	remaining = math.max(remaining, 0)
+	if result == nil or remaining < result[2] or (remaining == result[2] and retry > result[3]) then
+		result = {granted, remaining, retry, reset, i - 1}
+	end
+end
+
+result[3] = math.ceil(result[3] / 1000)
+result[4] = math.ceil(result[4] / 1000)
+return result
+`
+
+// fixedWindowScript counts requests in the current clock window
+var fixedWindowScript = redis.NewScript(`
+local function check(key, limit, window, burst, now)
+	local idx = math.floor(now / window)
+	local state = redis.call('HMGET', key, 'idx', 'count')
+	local count = 0
+	if tonumber(state[1]) == idx then
+		count = tonumber(state[2]) or 0
+	end
+	return {window = window, idx = idx, count = count, available = math.max(limit - count, 0)}
+end
+
+local function commit(key, s, granted, now)
+	local count = s.count + granted
+	local windowEnd = (s.idx + 1) * s.window - now
+	if granted > 0 then
+		redis.call('HSET', key, 'idx', s.idx, 'count', count)
+		redis.call('PEXPIRE', key, math.max(math.ceil(windowEnd / 1000), 1))
+	end
+
+	local remaining = s.available - granted
+	local retry = 0
+	if remaining == 0 then
+		retry = windowEnd
+	end
+	local reset = 0
+	if count > 0 then
+		reset = windowEnd
+	end
+	return remaining, retry, reset
+end
+` + limitScriptDriver)
+
+// slidingWindowScript estimates the requests of the last window from the
+// current and previous clock windows
+var slidingWindowScript = redis.NewScript(`
+local function check(key, limit, window, burst, now)
+	local idx = math.floor(now / window)
+	local state = redis.call('HMGET', key, 'idx', 'curr', 'prev')
+	local stateIdx = tonumber(state[1]) or idx
+	local curr = tonumber(state[2]) or 0
+	local prev = tonumber(state[3]) or 0
+	if stateIdx == idx - 1 then
+		prev = curr
+		curr = 0
+	elseif stateIdx < idx - 1 then
+		prev = 0
+		curr = 0
+	end
+
+	-- Share of the previous window that still overlaps the sliding window
+	local weight = 1 - (now - idx * window) / window
+	local available = math.max(math.floor(limit - (prev * weight + curr)), 0)
+	return {limit = limit, window = window, idx = idx, curr = curr, prev = prev, weight = weight, available = available}
+end
+
+local function commit(key, s, granted, now)
+	local curr = s.curr + granted
+	if granted > 0 then
+		redis.call('HSET', key, 'idx', s.idx, 'curr', curr, 'prev', s.prev)
+		redis.call('PEXPIRE', key, math.ceil(2 * s.window / 1000))
+	end
+
+	local windowEnd = (s.idx + 1) * s.window - now
+	local remaining = s.available - granted
+	local retry = 0
+	if remaining == 0 then
+		-- One more request fits once the estimate drops to limit - 1
+		local excess = s.prev * s.weight + curr - (s.limit - 1)
+		if s.prev > 0 and excess <= s.prev * s.weight then
+			retry = excess * s.window / s.prev
+		else
+			retry = windowEnd
+			if curr > s.limit - 1 then
+				retry = retry + (1 - (s.limit - 1) / curr) * s.window
+			end
+		end
+	end
+
+	local reset = 0
+	if curr > 0 then
+		reset = windowEnd + s.window
+	elseif s.prev > 0 then
+		reset = windowEnd
+	end
+	return remaining, retry, reset
+end
+` + limitScriptDriver)
+
+// gcraScript tracks the theoretical arrival time (TAT) of the next request.
+// Each request moves it forward by window/limit, and requests are refused
+// while it is more than burst intervals ahead of now.
+var gcraScript = redis.NewScript(`
+local function check(key, limit, window, burst, now)
+	local interval = window / limit
+	local tolerance = burst * interval
+	local tat = tonumber(redis.call('GET', key)) or now
+	if tat < now then
+		tat = now
+	end
+
+	local available = math.min(math.max(math.floor((now + tolerance - tat) / interval), 0), burst)
+	return {interval = interval, tolerance = tolerance, tat = tat, available = available}
+end
+
+local function commit(key, s, granted, now)
+	local tat = s.tat + granted * s.interval
+	if granted > 0 then
+		redis.call('SET', key, string.format('%.0f', tat), 'PX', math.ceil((tat - now) / 1000) + 1)
+	end
+
+	local remaining = s.available - granted
+	local retry = 0
+	if remaining == 0 then
+		retry = math.max(tat + s.interval - s.tolerance - now, 0)
+	end
+	return remaining, retry, tat - now
+end
+` + limitScriptDriver)
+
+// limitWindow is a single limit enforced by the rate limiter
+type limitWindow struct {
+	RateLimitPolicy
+	key   string // Counter key suffix, unique per client
+	burst int
+}
+
+// pendingHit groups the requests granted locally for a client that the same
+// limits apply to
+type pendingHit struct {
+	clientID uuid.UUID
+	rules    string // RuleKey of the hits
+}
+
+// pendingCharge is the number of requests granted locally for a pendingHit
+type pendingCharge struct {
+	hit RateLimitHit // One of the hits, to look up the limits that apply to all of them
+	n   int
+}
+
+// reconcileTimeout bounds a background reconciliation of local rate limits
+const reconcileTimeout = time.Minute
+
 // RateLimiter handles rate limiting for API clients
 type RateLimiter struct {
-	maxRequestsPerHour int
+	config       RateLimiterConfig
+	script       *redis.Script
+	clientLoader ClientLoader
+	local        *localLimiter
+	reconciling  atomic.Bool
 }
 
 // NewRateLimiter creates a new rate limiter
-func NewRateLimiter(maxRequestsPerHour int) *RateLimiter {
-	return &RateLimiter{
-		maxRequestsPerHour: maxRequestsPerHour,
+func NewRateLimiter(config RateLimiterConfig) *RateLimiter {
+	if config.Limit <= 0 {
+		config.Limit = 1000
+	}
+
+	script := slidingWindowScript
+	switch config.Algorithm {
+	case FixedWindow:
+		script = fixedWindowScript
+	case GCRA:
+		script = gcraScript
+	default:
+		config.Algorithm = SlidingWindow
+	}
+
+	switch config.FailureMode {
+	case FailOpen, FailClosed:
+	default:
+		config.FailureMode = FailLocal
+	}
+
+	rl := &RateLimiter{
+		config: config,
+		script: script,
+		local:  newLocalLimiter(config.Instances),
+	}
+
+	// Charge what was granted locally as soon as Redis is back
+	if config.FailureMode == FailLocal {
+		db.OnRedisRecovered(rl.reconcileLocal)
+	}
+
+	return rl
+}
+
+// ParseRateLimitAlgorithm parses a rate limit algorithm name
+func ParseRateLimitAlgorithm(name string) (RateLimitAlgorithm, error) {
+	switch algorithm := RateLimitAlgorithm(name); algorithm {
+	case FixedWindow, SlidingWindow, GCRA:
+		return algorithm, nil
 	}
+	return "", fmt.Errorf("unknown rate limit algorithm %q (use fixed, sliding or gcra)", name)
 }
 
-// CheckLimit checks if a client has exceeded their rate limit
-func (rl *RateLimiter) CheckLimit(ctx context.Context, clientID uuid.UUID) (bool, int, error) {
-	key := rl.getRateLimitKey(clientID)
+// ParseRateLimitFailureMode parses a rate limit failure mode name
+func ParseRateLimitFailureMode(name string) (RateLimitFailureMode, error) {
+	switch mode := RateLimitFailureMode(name); mode {
+	case FailOpen, FailClosed, FailLocal:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown rate limit failure mode %q (use open, closed or local)", name)
+}
 
-	// Try to get current count from Redis
-	if db.IsRedisAvailable(ctx) {
-		count, err := db.GetCounter(ctx, key)
-		if err != nil {
-			// If error, fallback to allowing the request
-			return true, 0, nil
-		}
+// SetClientLoader registers the function used to look up a client's plan and
+// overrides. Without it every client gets the default hourly limit.
+func (rl *RateLimiter) SetClientLoader(loader ClientLoader) {
+	rl.clientLoader = loader
+}
 
-		if count >= int64(rl.maxRequestsPerHour) {
-			remaining := 0
-			return false, remaining, nil
-		}
+// Algorithm returns the algorithm used by the rate limiter
+func (rl *RateLimiter) Algorithm() RateLimitAlgorithm {
+	return rl.config.Algorithm
+}
 
-		// Increment counter
-		newCount, err := db.IncrementCounter(ctx, key)
-		if err != nil {
-			return true, 0, nil
-		}
+// FailureMode returns the behaviour of the rate limiter while Redis is unavailable
+func (rl *RateLimiter) FailureMode() RateLimitFailureMode {
+	return rl.config.FailureMode
+}
+
+// DefaultLimits returns the limits of clients without a plan
+func (rl *RateLimiter) DefaultLimits() model.RateLimits {
+	return model.RateLimits{Hourly: rl.config.Limit}
+}
+
+// Take atomically charges up to n requests against a client's limits. Requests
+// that do not fit are not charged, so the result may grant fewer than n. A
+// call with n = 0 reports the current state without charging anything. Only
+// rules that are not scoped to an endpoint or IP are evaluated.
+func (rl *RateLimiter) Take(ctx context.Context, clientID uuid.UUID, n int) (RateLimitResult, error) {
+	return rl.TakeHit(ctx, clientID, RateLimitHit{}, n)
+}
 
-		// Set expiry if this is the first request
-		if newCount == 1 {
-			ttl := time.Hour
-			_ = db.RedisClient.Expire(ctx, key, ttl).Err()
+// TakeHit atomically charges up to n hits that share the same source IP and
+// endpoint against every limit that applies to them: the client's plan
+// windows and all matching rules.
+func (rl *RateLimiter) TakeHit(ctx context.Context, clientID uuid.UUID, hit RateLimitHit, n int) (RateLimitResult, error) {
+	n = max(n, 0)
+
+	windows := rl.windows(rl.GetLimits(ctx, clientID), hit)
+	if len(windows) == 0 {
+		return rl.unlimited(n), nil
+	}
+
+	if !db.IsRedisAvailable(ctx) {
+		return rl.fallback(clientID, hit, n, windows), nil
+	}
+
+	// Charge what was granted locally during an outage in the background, in
+	// case the last attempt after the recovery failed
+	if rl.local.hasPending() && !rl.reconciling.Load() {
+		go rl.reconcileLocal()
+	}
+
+	result, err := rl.run(ctx, clientID, n, windows, false)
+	if err != nil {
+		return rl.fallback(clientID, hit, n, windows), err
+	}
+
+	return result, nil
+}
+
+// RuleKey returns a key that is equal for two hits exactly when the same
+// limits apply to them, so hits can be grouped and charged together
+func (rl *RateLimiter) RuleKey(hit RateLimitHit) string {
+	key := ""
+	for _, rule := range rl.config.Rules {
+		if rule.applies(hit) {
+			key += "|" + rule.key(hit)
 		}
+	}
+	return key
+}
+
+// run executes the limit script for the windows of a client
+func (rl *RateLimiter) run(ctx context.Context, clientID uuid.UUID, n int, windows []limitWindow, force bool) (RateLimitResult, error) {
+	forceArg := 0
+	if force {
+		forceArg = 1
+	}
 
-		remaining := rl.maxRequestsPerHour - int(newCount)
-		if remaining < 0 {
-			remaining = 0
+	keys := make([]string, len(windows))
+	args := []interface{}{n, forceArg}
+	policies := make([]RateLimitPolicy, len(windows))
+	for i, w := range windows {
+		keys[i] = rl.getRateLimitKey(clientID, w.key)
+		args = append(args, w.Limit, w.Window.Microseconds(), w.burst)
+		policies[i] = w.RateLimitPolicy
+	}
+
+	values, err := rl.script.Run(ctx, db.RedisClient, keys, args...).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	if len(values) != 5 || int(values[4]) >= len(windows) {
+		return RateLimitResult{}, fmt.Errorf("unexpected rate limit script result")
+	}
+
+	constraining := windows[values[4]]
+	return RateLimitResult{
+		Granted:    int(values[0]),
+		Policy:     constraining.Name,
+		Limit:      constraining.Limit,
+		Window:     constraining.Window,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		Reset:      time.Duration(values[3]) * time.Millisecond,
+		Policies:   policies,
+	}, nil
+}
+
+// fallback decides a request while Redis is unavailable, according to the
+// configured failure mode
+func (rl *RateLimiter) fallback(clientID uuid.UUID, hit RateLimitHit, n int, windows []limitWindow) RateLimitResult {
+	switch rl.config.FailureMode {
+	case FailOpen:
+		return rl.unlimited(n)
+	case FailClosed:
+		return RateLimitResult{
+			Policy:     windows[0].Name,
+			Limit:      windows[0].Limit,
+			Window:     windows[0].Window,
+			RetryAfter: failClosedRetryAfter,
 		}
+	default:
+		return rl.local.take(pendingHit{clientID, rl.RuleKey(hit)}, hit, n, windows)
+	}
+}
 
-		return true, remaining, nil
+// reconcileLocal reconciles the local rate limits in the background, one
+// run at a time
+func (rl *RateLimiter) reconcileLocal() {
+	if !rl.reconciling.CompareAndSwap(false, true) {
+		return
 	}
+	defer rl.reconciling.Store(false)
 
-	// If Redis is not available, allow the request
-	return true, rl.maxRequestsPerHour, nil
+	ctx, cancel := context.WithTimeout(context.Background(), reconcileTimeout)
+	defer cancel()
+	rl.reconcile(ctx)
 }
 
-// GetRemainingRequests gets the remaining requests for a client
-func (rl *RateLimiter) GetRemainingRequests(ctx context.Context, clientID uuid.UUID) (int, error) {
-	key := rl.getRateLimitKey(clientID)
+// reconcile charges the requests granted locally during a Redis outage to
+// the shared Redis counters. They are added to the current windows even if
+// they go over the limit, so the outage cannot be used to exceed it twice.
+func (rl *RateLimiter) reconcile(ctx context.Context) {
+	pending := rl.local.drain()
+	if len(pending) == 0 {
+		return
+	}
+
+	clients := make(map[uuid.UUID]bool)
+	total := 0
+	for p, charge := range pending {
+		windows := rl.windows(rl.GetLimits(ctx, p.clientID), charge.hit)
+		if len(windows) > 0 {
+			if _, err := rl.run(ctx, p.clientID, charge.n, windows, true); err != nil {
+				// Keep what is left for the next attempt
+				rl.local.restore(pending)
+				log.Printf("Failed to reconcile local rate limits: %v", err)
+				return
+			}
+		}
+		total += charge.n
+		clients[p.clientID] = true
+		delete(pending, p)
+	}
+
+	log.Printf("Reconciled %d locally rate limited requests of %d clients", total, len(clients))
+}
 
+// Inspect reports the state of every limit that applies to a hit of a client,
+// one result per window or rule, without charging anything
+func (rl *RateLimiter) Inspect(ctx context.Context, clientID uuid.UUID, hit RateLimitHit) ([]RateLimitResult, error) {
 	if !db.IsRedisAvailable(ctx) {
-		return rl.maxRequestsPerHour, nil
+		return nil, ErrRateLimitUnavailable
 	}
 
-	count, err := db.GetCounter(ctx, key)
+	windows := rl.windows(rl.GetLimits(ctx, clientID), hit)
+	results := make([]RateLimitResult, 0, len(windows))
+	for _, w := range windows {
+		result, err := rl.run(ctx, clientID, 0, []limitWindow{w}, false)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// ResetLimit resets all rate limit counters of a client
+func (rl *RateLimiter) ResetLimit(ctx context.Context, clientID uuid.UUID) error {
+	return db.CacheInvalidatePattern(ctx, fmt.Sprintf("rate_limit:*:%s:*", clientID.String()))
+}
+
+// GetLimits returns the effective limits of a client, cached in Redis
+func (rl *RateLimiter) GetLimits(ctx context.Context, clientID uuid.UUID) model.RateLimits {
+	if rl.clientLoader == nil {
+		return rl.DefaultLimits()
+	}
+
+	cacheKey := rl.getLimitsCacheKey(clientID)
+	if db.IsRedisAvailable(ctx) {
+		var cached model.RateLimits
+		if err := db.CacheGet(ctx, cacheKey, &cached); err == nil {
+			return cached
+		}
+	}
+
+	client, err := rl.clientLoader(clientID)
 	if err != nil {
-		return rl.maxRequestsPerHour, nil
+		return rl.DefaultLimits()
 	}
 
-	remaining := rl.maxRequestsPerHour - int(count)
-	if remaining < 0 {
-		remaining = 0
+	limits := client.EffectiveLimits(rl.DefaultLimits())
+	if db.IsRedisAvailable(ctx) {
+		// Stop serving boosted limits once the first boost expires
+		ttl := limitCacheTTL
+		if expiry, ok := client.NextBoostExpiry(); ok {
+			ttl = min(ttl, max(time.Until(expiry), time.Second))
+		}
+		_ = db.CacheSet(ctx, cacheKey, limits, ttl)
 	}
 
-	return remaining, nil
+	return limits
 }
 
-// ResetLimit resets the rate limit for a client
-func (rl *RateLimiter) ResetLimit(ctx context.Context, clientID uuid.UUID) error {
-	key := rl.getRateLimitKey(clientID)
-	return db.CacheDelete(ctx, key)
+// InvalidateLimits drops the cached limits of a client after its plan or
+// overrides changed
+func (rl *RateLimiter) InvalidateLimits(ctx context.Context, clientID uuid.UUID) error {
+	return db.CacheDelete(ctx, rl.getLimitsCacheKey(clientID))
+}
+
+// windows lists the limits that apply to a hit of a client: the plan windows
+// followed by the matching rules. Under GCRA the hourly limit allows bursts of
+// the configured size (a minute's worth by default), while the daily and
+// monthly limits act as token buckets that refill over their window.
+func (rl *RateLimiter) windows(limits model.RateLimits, hit RateLimitHit) []limitWindow {
+	windows := make([]limitWindow, 0, 3+len(rl.config.Rules))
+
+	if limits.Hourly > 0 {
+		burst := rl.config.Burst
+		if burst <= 0 {
+			burst = limits.Hourly / 60
+		}
+		windows = append(windows, limitWindow{RateLimitPolicy{"hour", limits.Hourly, HourWindow}, "hour", min(max(burst, 1), limits.Hourly)})
+	}
+	if limits.Daily > 0 {
+		windows = append(windows, limitWindow{RateLimitPolicy{"day", limits.Daily, DayWindow}, "day", limits.Daily})
+	}
+	if limits.Monthly > 0 {
+		windows = append(windows, limitWindow{RateLimitPolicy{"month", limits.Monthly, MonthWindow}, "month", limits.Monthly})
+	}
+
+	for _, rule := range rl.config.Rules {
+		if rule.applies(hit) {
+			windows = append(windows, limitWindow{RateLimitPolicy{rule.Name, rule.Limit, rule.Window}, rule.key(hit), rule.Burst})
+		}
+	}
+
+	return windows
+}
+
+// unlimited is the result used when no limit is enforced
+func (rl *RateLimiter) unlimited(n int) RateLimitResult {
+	return RateLimitResult{
+		Granted:   n,
+		Remaining: rl.config.Limit,
+	}
+}
+
+// getRateLimitKey generates the Redis key for rate limiting. The algorithm is
+// part of the key so that switching algorithms never misreads another's state.
+func (rl *RateLimiter) getRateLimitKey(clientID uuid.UUID, key string) string {
+	return fmt.Sprintf("rate_limit:%s:%s:%s", rl.config.Algorithm, clientID.String(), key)
 }
 
-// getRateLimitKey generates the Redis key for rate limiting
-func (rl *RateLimiter) getRateLimitKey(clientID uuid.UUID) string {
-	hour := time.Now().UTC().Format("2006-01-02-15")
-	return fmt.Sprintf("rate_limit:%s:%s", clientID.String(), hour)
+// getLimitsCacheKey generates the cache key for a client's effective limits
+func (rl *RateLimiter) getLimitsCacheKey(clientID uuid.UUID) string {
+	return "rate_limits:" + clientID.String()
 }
 
 // GetDefaultRateLimit returns the default rate limit from environment
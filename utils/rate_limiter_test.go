@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nexmedis-golang/db"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+)
+
+// startRedis points db.RedisClient at an in-memory Redis for the duration of
+// the test. The Redis clock can be set with SetTime, which the limit scripts
+// read through TIME.
+func startRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	if err := db.InitRedis(db.RedisConfig{Host: mr.Host(), Port: mr.Port()}); err != nil {
+		t.Fatalf("failed to connect to miniredis: %v", err)
+	}
+	t.Cleanup(func() { _ = db.CloseRedis() })
+	return mr
+}
+
+// windowOffset returns the time at the given fraction of a window, counted
+// from the Unix epoch as the limiters do
+func windowOffset(window time.Duration, fraction float64) time.Time {
+	start := time.Now().UnixNano() / int64(window) * int64(window)
+	return time.Unix(0, start+int64(float64(window)*fraction))
+}
+
+func TestRateLimiterConcurrentTake(t *testing.T) {
+	startRedis(t)
+
+	for _, algorithm := range []RateLimitAlgorithm{FixedWindow, SlidingWindow, GCRA} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			rl := NewRateLimiter(RateLimiterConfig{Limit: 20, Burst: 20, Algorithm: algorithm})
+			clientID := uuid.New()
+
+			var granted atomic.Int64
+			var wg sync.WaitGroup
+			for i := 0; i < 100; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					result, err := rl.Take(context.Background(), clientID, 1)
+					if err != nil {
+						t.Errorf("Take() error = %v", err)
+						return
+					}
+					granted.Add(int64(result.Granted))
+				}()
+			}
+			wg.Wait()
+
+			if got := granted.Load(); got != 20 {
+				t.Errorf("granted %d requests, want exactly the limit of 20", got)
+			}
+		})
+	}
+}
+
+func TestRateLimiterTakeIsAllOrPartial(t *testing.T) {
+	startRedis(t)
+
+	rl := NewRateLimiter(RateLimiterConfig{
+		Limit:     1000,
+		Algorithm: SlidingWindow,
+		Rules:     []RateLimitRule{{Name: "minute", Limit: 5, Window: time.Minute, Burst: 5}},
+	})
+	clientID := uuid.New()
+	ctx := context.Background()
+
+	result, err := rl.Take(ctx, clientID, 8)
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	if result.Granted != 5 || result.Policy != "minute" || result.Remaining != 0 || result.RetryAfter <= 0 {
+		t.Errorf("Take(8) = %+v, want 5 granted by the minute rule and a retry after", result)
+	}
+
+	// Requests refused by the rule are not charged to the hourly limit
+	results, err := rl.Inspect(ctx, clientID, RateLimitHit{})
+	if err != nil {
+		t.Fatalf("Inspect() error = %v", err)
+	}
+	if results[0].Policy != "hour" || results[0].Remaining != 995 {
+		t.Errorf("hourly state = %+v, want 995 remaining", results[0])
+	}
+}
+
+func TestRateLimiterWindowBoundary(t *testing.T) {
+	mr := startRedis(t)
+
+	const window = 2 * time.Second
+	for _, algorithm := range []RateLimitAlgorithm{SlidingWindow, GCRA} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			rl := NewRateLimiter(RateLimiterConfig{
+				Limit:     100000,
+				Burst:     100000,
+				Algorithm: algorithm,
+				Rules:     []RateLimitRule{{Name: "short", Limit: 10, Window: window, Burst: 10}},
+			})
+			clientID := uuid.New()
+			ctx := context.Background()
+
+			// Use up the limit at the end of a window, then try again right
+			// after the boundary, well within one GCRA emission interval
+			mr.SetTime(windowOffset(window, 0.95))
+			first, err := rl.Take(ctx, clientID, 10)
+			if err != nil {
+				t.Fatalf("Take() error = %v", err)
+			}
+			if first.Granted != 10 {
+				t.Fatalf("granted %d at the end of the window, want 10", first.Granted)
+			}
+
+			mr.SetTime(windowOffset(window, 1.02))
+			second, err := rl.Take(ctx, clientID, 10)
+			if err != nil {
+				t.Fatalf("Take() error = %v", err)
+			}
+			if second.Granted > 1 {
+				t.Errorf("granted %d right after the window boundary, want at most 1 (no double burst)", second.Granted)
+			}
+		})
+	}
+}
+
+func TestRateLimiterFixedWindowResetsAtBoundary(t *testing.T) {
+	mr := startRedis(t)
+
+	const window = 2 * time.Second
+	rl := NewRateLimiter(RateLimiterConfig{
+		Limit:     100000,
+		Algorithm: FixedWindow,
+		Rules:     []RateLimitRule{{Name: "short", Limit: 10, Window: window, Burst: 10}},
+	})
+	clientID := uuid.New()
+	ctx := context.Background()
+
+	// Fixed windows are documented to allow the boundary burst
+	mr.SetTime(windowOffset(window, 0.95))
+	if result, err := rl.Take(ctx, clientID, 10); err != nil || result.Granted != 10 {
+		t.Fatalf("Take() = %+v, %v, want 10 granted", result, err)
+	}
+	mr.SetTime(windowOffset(window, 1.02))
+	if result, err := rl.Take(ctx, clientID, 10); err != nil || result.Granted != 10 {
+		t.Errorf("Take() = %+v, %v, want 10 granted in the new window", result, err)
+	}
+}
+
+func TestRateLimiterGCRABurst(t *testing.T) {
+	startRedis(t)
+
+	ctx := context.Background()
+
+	t.Run("configured burst", func(t *testing.T) {
+		rl := NewRateLimiter(RateLimiterConfig{Limit: 3600, Burst: 7, Algorithm: GCRA})
+		clientID := uuid.New()
+
+		result, err := rl.Take(ctx, clientID, 20)
+		if err != nil {
+			t.Fatalf("Take() error = %v", err)
+		}
+		if result.Granted != 7 || result.Remaining != 0 {
+			t.Errorf("Take(20) = %+v, want the burst of 7", result)
+		}
+
+		// The next request fits after one emission interval (3600/h = 1s)
+		if result.RetryAfter <= 0 || result.RetryAfter > time.Second {
+			t.Errorf("retry after %s, want at most 1s", result.RetryAfter)
+		}
+		if result, _ := rl.Take(ctx, clientID, 1); result.Granted != 0 {
+			t.Errorf("granted %d right after the burst, want 0", result.Granted)
+		}
+	})
+
+	t.Run("default burst is a minute's worth", func(t *testing.T) {
+		rl := NewRateLimiter(RateLimiterConfig{Limit: 600, Algorithm: GCRA})
+
+		result, err := rl.Take(ctx, uuid.New(), 100)
+		if err != nil {
+			t.Fatalf("Take() error = %v", err)
+		}
+		if result.Granted != 10 {
+			t.Errorf("granted %d, want 10 (600/h over a minute)", result.Granted)
+		}
+	})
+
+	t.Run("rule burst", func(t *testing.T) {
+		rl := NewRateLimiter(RateLimiterConfig{
+			Limit:     100000,
+			Burst:     100000,
+			Algorithm: GCRA,
+			Rules:     []RateLimitRule{{Name: "minute", Limit: 60, Window: time.Minute, Burst: 5}},
+		})
+
+		result, err := rl.Take(ctx, uuid.New(), 60)
+		if err != nil {
+			t.Fatalf("Take() error = %v", err)
+		}
+		if result.Granted != 5 || result.Policy != "minute" {
+			t.Errorf("Take(60) = %+v, want the rule's burst of 5", result)
+		}
+	})
+}
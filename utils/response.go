@@ -79,6 +79,11 @@ func CreatedResponse(c echo.Context, message string, data interface{}) error {
 	return SuccessResponse(c, http.StatusCreated, message, data)
 }
 
+// AcceptedResponse sends a 202 Accepted response
+func AcceptedResponse(c echo.Context, message string, data interface{}) error {
+	return SuccessResponse(c, http.StatusAccepted, message, data)
+}
+
 // OKResponse sends a 200 OK response
 func OKResponse(c echo.Context, message string, data interface{}) error {
 	return SuccessResponse(c, http.StatusOK, message, data)
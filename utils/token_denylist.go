@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"nexmedis-golang/db"
+
+	"github.com/google/uuid"
+)
+
+// ErrDenylistUnavailable is returned when revoked tokens cannot be recorded in Redis
+var ErrDenylistUnavailable = fmt.Errorf("token denylist not available")
+
+// RevokeToken adds a token to the denylist until it expires
+func RevokeToken(ctx context.Context, claims *JWTClaims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return fmt.Errorf("token cannot be revoked individually")
+	}
+
+	ttl := time.Until(claims.ExpiresAt.Time)
+	if ttl <= 0 {
+		return nil
+	}
+
+	if !db.IsRedisAvailable(ctx) {
+		return ErrDenylistUnavailable
+	}
+
+	return db.RedisClient.Set(ctx, getDenylistKey(claims.ID), 1, ttl).Err()
+}
+
+// RevokeClientTokens revokes every token issued to a client up to now. The
+// marker is kept for the lifetime of a token, after which all of them expired.
+func RevokeClientTokens(ctx context.Context, clientID uuid.UUID) error {
+	if !db.IsRedisAvailable(ctx) {
+		return ErrDenylistUnavailable
+	}
+
+	revokedAt := strconv.FormatInt(time.Now().Unix(), 10)
+	return db.RedisClient.Set(ctx, getRevokedBeforeKey(clientID), revokedAt, TokenLifetime()).Err()
+}
+
+// IsTokenRevoked reports whether a token was revoked on its own or together
+// with all tokens of its client. Tokens issued in the same second as a
+// revocation of all tokens are revoked as well.
+func IsTokenRevoked(ctx context.Context, claims *JWTClaims) (bool, error) {
+	if !db.IsRedisAvailable(ctx) {
+		return false, ErrDenylistUnavailable
+	}
+
+	keys := []string{getRevokedBeforeKey(claims.ClientID)}
+	if claims.ID != "" {
+		keys = append(keys, getDenylistKey(claims.ID))
+	}
+
+	values, err := db.RedisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if len(values) > 1 && values[1] != nil {
+		return true, nil
+	}
+
+	if revokedAt, ok := values[0].(string); ok && claims.IssuedAt != nil {
+		before, err := strconv.ParseInt(revokedAt, 10, 64)
+		if err == nil && claims.IssuedAt.Unix() <= before {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// getDenylistKey generates the Redis key of a revoked token
+func getDenylistKey(jti string) string {
+	return fmt.Sprintf("jwt_denylist:%s", jti)
+}
+
+// getRevokedBeforeKey generates the Redis key holding when all tokens of a client were revoked
+func getRevokedBeforeKey(clientID uuid.UUID) string {
+	return fmt.Sprintf("jwt_revoked_before:%s", clientID.String())
+}
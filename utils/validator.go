@@ -2,9 +2,12 @@ package utils
 
 import (
 	"fmt"
+	"math"
 	"net"
 	"net/mail"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 // ValidateEmail validates an email address
@@ -85,9 +88,70 @@ func ValidateEndpoint(endpoint string) error {
 	return nil
 }
 
+// ValidateHTTPMethod validates an HTTP method
+func ValidateHTTPMethod(method string) error {
+	switch strings.ToUpper(method) {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE":
+		return nil
+	}
+	return fmt.Errorf("invalid HTTP method")
+}
+
+// ValidateStatusCode validates an HTTP status code
+func ValidateStatusCode(code int) error {
+	if code < 100 || code > 599 {
+		return fmt.Errorf("status code must be between 100 and 599")
+	}
+	return nil
+}
+
+// ValidateDuration validates a reported request duration in milliseconds
+func ValidateDuration(durationMs float64) error {
+	if math.IsNaN(durationMs) || durationMs < 0 || durationMs > MaxDurationMs {
+		return fmt.Errorf("duration_ms must be between 0 and %d", MaxDurationMs)
+	}
+	return nil
+}
+
+// ValidateTimestamp validates that a reported timestamp is not in the future
+func ValidateTimestamp(ts time.Time) error {
+	// Allow a small clock skew between the reporter and the server
+	if ts.After(time.Now().UTC().Add(5 * time.Minute)) {
+		return fmt.Errorf("timestamp must not be in the future")
+	}
+
+	return nil
+}
+
+// ValidateIdempotencyKey validates an idempotency key or event ID
+func ValidateIdempotencyKey(key string) error {
+	if err := ValidateRequired(key, "idempotency key"); err != nil {
+		return err
+	}
+
+	if len(key) > 255 {
+		return fmt.Errorf("idempotency key must not exceed 255 characters")
+	}
+
+	return nil
+}
+
 // SanitizeString removes dangerous characters from a string
 func SanitizeString(input string) string {
 	// Remove null bytes and trim spaces
 	sanitized := strings.ReplaceAll(input, "\x00", "")
 	return strings.TrimSpace(sanitized)
 }
+
+// TruncateString shortens a string to at most maxBytes bytes without splitting a character
+func TruncateString(input string, maxBytes int) string {
+	if len(input) <= maxBytes {
+		return input
+	}
+
+	truncated := input[:maxBytes]
+	for len(truncated) > 0 && !utf8.ValidString(truncated) {
+		truncated = truncated[:len(truncated)-1]
+	}
+	return truncated
+}